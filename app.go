@@ -29,7 +29,11 @@ type App struct {
 	groups []*RouterGroup
 	server *http.Server
 
-	trees methodTrees
+	trees     methodTrees
+	routeMeta map[string]Map
+
+	cookieKeys     []cookieKey
+	trustedProxies []*net.IPNet
 
 	pool *sync.Pool
 
@@ -64,27 +68,20 @@ func (a *App) allocateContext() *Ctx {
 }
 
 func (a *App) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
-	var (
-		err error
-		c   = a.pool.Get().(*Ctx)
-		nfe = new(Err)
-	)
+	c := a.pool.Get().(*Ctx)
 
 	c.reset(writer, request)
 
-	if err = c.verify(); err != nil {
-		if errors.As(err, nfe) {
-			_ = c.Status(nfe.Status).SendString(nfe.Msg)
-			return
+	a.handleHTTPRequest(c)
+
+	if !c.detached {
+		// the server only cleans up the form of the request it created
+		if form := c.Request.MultipartForm; form != nil {
+			_ = form.RemoveAll()
 		}
 
-		_ = c.Status(500).SendString(err.Error())
-		return
+		a.pool.Put(c)
 	}
-
-	a.handleHTTPRequest(c)
-
-	a.pool.Put(c)
 }
 
 func (a *App) run(ln net.Listener) error {
@@ -127,28 +124,38 @@ func (a *App) Run(address string) error {
 		return err
 	}
 
-	return a.run(ln)
+	return a.run(a.wrapListener(ln))
 }
 
 func (a *App) RunTLS(address string, tlsConfig *tls.Config) error {
-	ln, err := tls.Listen("tcp", address, tlsConfig)
+	ln, err := net.Listen("tcp", address)
 	if err != nil {
 		return err
 	}
 
-	return a.run(ln)
+	return a.run(tls.NewListener(a.wrapListener(ln), tlsConfig))
 }
 
 func (a *App) RunListener(ln net.Listener) error {
 	a.server = &http.Server{Addr: ln.Addr().String()}
 
-	return a.run(ln)
+	return a.run(a.wrapListener(ln))
 }
 
 func (a *App) RunListenerTls(ln net.Listener, tlsConfig *tls.Config) error {
 	a.server = &http.Server{Addr: ln.Addr().String()}
 
-	return a.run(tls.NewListener(ln, tlsConfig))
+	return a.run(tls.NewListener(a.wrapListener(ln), tlsConfig))
+}
+
+// wrapListener decodes the PROXY protocol when Config.ProxyProtocol is set,
+// beneath TLS as the header precedes the handshake
+func (a *App) wrapListener(ln net.Listener) net.Listener {
+	if a.config.ProxyProtocol == nil {
+		return ln
+	}
+
+	return NewProxyProtocolListener(ln, *a.config.ProxyProtocol)
 }
 
 func (a *App) Shutdown(ctx context.Context) error {
@@ -160,6 +167,7 @@ type RouteInfo struct {
 	Path        string
 	Handler     string
 	HandlerFunc HandlerFunc
+	Meta        Map
 }
 
 // RoutesInfo defines a RouteInfo slice.
@@ -168,6 +176,10 @@ func (a *App) GetRoutes() (routes []RouteInfo) {
 		routes = iterate("", tree.method, routes, tree.root)
 	}
 
+	for i := range routes {
+		routes[i].Meta = a.getRouteMeta(routes[i].Method, routes[i].Path)
+	}
+
 	return routes
 }
 
@@ -214,6 +226,18 @@ func (a *App) addRoute(method, path string, handlers ...HandlerFunc) {
 	}
 }
 
+func (a *App) setRouteMeta(method, path string, meta Map) {
+	if a.routeMeta == nil {
+		a.routeMeta = make(map[string]Map)
+	}
+
+	a.routeMeta[method+" "+path] = meta
+}
+
+func (a *App) getRouteMeta(method, path string) Map {
+	return a.routeMeta[method+" "+path]
+}
+
 func (a *App) handleHTTPRequest(c *Ctx) {
 	var err error
 
@@ -246,8 +270,17 @@ func (a *App) handleHTTPRequest(c *Ctx) {
 			c.handlers = value.handlers
 			c.fullPath = value.fullPath
 
-			if err = c.Next(); err != nil {
-				serveError(c, errorHandler)
+			if err = c.verify(); err == nil {
+				err = c.Next()
+			}
+
+			// the handler may have swallowed the read error of the body
+			if c.bodyExceeded {
+				err = NewNFError(413, "Content Too Large")
+			}
+
+			if err != nil {
+				serveError(c, err)
 			}
 
 			return
@@ -302,15 +335,20 @@ func errorHandler(c *Ctx) error {
 	return c.Status(500).SendString(_500)
 }
 
-func serveError(c *Ctx, handler HandlerFunc) {
-	err := c.Next()
-
+// serveError writes a response for the error returned by the handler chain,
+// unless the chain already wrote one. The chain is never re-entered.
+func serveError(c *Ctx, err error) {
 	if c.writermem.Written() {
 		return
 	}
 
-	_ = handler(c)
-	_ = err
+	var nfe Err
+	if errors.As(err, &nfe) {
+		_ = c.Status(nfe.Status).SendString(nfe.Msg)
+		return
+	}
+
+	_ = errorHandler(c)
 }
 
 func redirectTrailingSlash(c *Ctx) {
@@ -0,0 +1,55 @@
+package ursa
+
+import "io"
+
+// MetaBodyLimit is the route metadata key overriding Config.BodyLimit for
+// a single route or group, e.g. large for uploads and small for JSON APIs.
+// The value must be an int64 or an int, a negative value disables the
+// limit for the route.
+//
+//	app.Group("/upload").WithMeta(ursa.MetaBodyLimit, int64(1<<30)).Post("/", upload)
+const MetaBodyLimit = "ursa.body_limit"
+
+// bodyReader fails with a 413 Err once more than limit bytes are read, a
+// negative limit disabling the check. Bodies without a Content-Length are
+// limited while they stream in.
+type bodyReader struct {
+	c     *Ctx
+	r     io.Reader
+	limit int64
+	read  int64
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	if b.limit < 0 {
+		return b.r.Read(p)
+	}
+
+	if b.read > b.limit {
+		return 0, NewNFError(413, "Content Too Large")
+	}
+
+	// read one byte past the limit to tell a body of exactly limit bytes
+	// from a larger one
+	if remaining := b.limit - b.read + 1; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+
+	n, err := b.r.Read(p)
+	b.read += int64(n)
+
+	if b.read > b.limit {
+		b.c.bodyExceeded = true
+		return n - int(b.read-b.limit), NewNFError(413, "Content Too Large")
+	}
+
+	return n, err
+}
+
+func (b *bodyReader) Close() error {
+	if closer, ok := b.r.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
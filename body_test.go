@@ -0,0 +1,154 @@
+package ursa
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+// chunkedReader hides the length of a body, as a chunked upload does
+type chunkedReader struct{ io.Reader }
+
+// TestBodyLimit tests streaming enforcement and per route limits
+func TestBodyLimit(t *testing.T) {
+	app := New(Config{DisableLogger: true, BodyLimit: 16})
+
+	var handled bool
+	app.Post("/json", func(c *Ctx) error {
+		handled = true
+		var out map[string]string
+		if err := c.BodyParser(&out); err != nil {
+			return err
+		}
+		return c.SendString(out["k"])
+	})
+	app.Post("/raw", func(c *Ctx) error {
+		bs, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			return err
+		}
+		return c.SendString(string(bs))
+	})
+	app.Post("/swallow", func(c *Ctx) error {
+		_, _ = io.Copy(io.Discard, c.Request.Body)
+		return nil
+	})
+	app.Post("/form", func(c *Ctx) error {
+		var out struct {
+			K string `form:"k"`
+		}
+		if err := c.BodyParser(&out); err != nil {
+			return err
+		}
+		return c.SendString(out.K)
+	})
+	app.WithMeta(MetaBodyLimit, int64(64)).Post("/large", func(c *Ctx) error {
+		bs, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			return err
+		}
+		return c.SendString(string(bs))
+	})
+	app.Group("/unlimited").WithMeta(MetaBodyLimit, -1).Post("/big", func(c *Ctx) error {
+		bs, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			return err
+		}
+		return c.SendString(string(bs))
+	})
+
+	small := `{"k":"v"}`
+	large := `{"k":"` + strings.Repeat("v", 32) + `"}`
+
+	cases := []struct {
+		name  string
+		path  string
+		ctype string
+		body  io.Reader
+		want  int
+	}{
+		{"within limit", "/json", MIMEApplicationJSON, strings.NewReader(small), 200},
+		{"chunked within limit", "/json", MIMEApplicationJSON, chunkedReader{strings.NewReader(small)}, 200},
+		{"chunked over limit", "/json", MIMEApplicationJSON, chunkedReader{strings.NewReader(large)}, 413},
+		{"swallowed read error", "/swallow", MIMETextPlain, chunkedReader{strings.NewReader(large)}, 413},
+		{"form over limit", "/form", MIMEApplicationForm, chunkedReader{strings.NewReader("k=" + strings.Repeat("v", 32))}, 413},
+		{"route limit", "/large", MIMEApplicationJSON, chunkedReader{strings.NewReader(large)}, 200},
+		{"over route limit", "/large", MIMEApplicationJSON, chunkedReader{strings.NewReader(strings.Repeat(large, 3))}, 413},
+		{"group without limit", "/unlimited/big", MIMEApplicationJSON, chunkedReader{strings.NewReader(strings.Repeat(large, 10))}, 200},
+	}
+
+	for _, tc := range cases {
+		if w := doRequest(app, http.MethodPost, tc.path, tc.body, "Content-Type", tc.ctype); w.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d (%s)", tc.name, tc.want, w.Code, w.Body.String())
+		}
+	}
+
+	// a declared Content-Length over the limit is rejected before the handler
+	handled = false
+	if w := doRequest(app, http.MethodPost, "/json", strings.NewReader(large), "Content-Type", MIMEApplicationJSON); w.Code != 413 || handled {
+		t.Errorf("Expected 413 without running the handler, got %d (handled: %v)", w.Code, handled)
+	}
+
+	// exactly the limit is allowed
+	if w := doRequest(app, http.MethodPost, "/raw", chunkedReader{strings.NewReader(strings.Repeat("x", 16))}, "Content-Type", MIMETextPlain); w.Code != 200 || w.Body.Len() != 16 {
+		t.Errorf("Expected body of exactly the limit, got %d (%s)", w.Code, w.Body.String())
+	}
+}
+
+// TestMultipartMemory tests that large files are stored on disk and removed
+func TestMultipartMemory(t *testing.T) {
+	app := New(Config{DisableLogger: true, BodyLimit: 1 << 20, MultipartMemory: 1024})
+
+	var tmpFile string
+	app.Post("/upload", func(c *Ctx) error {
+		form, err := c.MultipartForm()
+		if err != nil {
+			return err
+		}
+
+		f, err := form.File["file"][0].Open()
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if osFile, ok := f.(*os.File); ok {
+			tmpFile = osFile.Name()
+		}
+
+		n, _ := io.Copy(io.Discard, f)
+		return c.JSON(Map{"size": n, "name": form.Value["name"][0]})
+	})
+
+	build := func(size int) (string, *bytes.Buffer) {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		_ = mw.WriteField("name", "report")
+		fw, _ := mw.CreateFormFile("file", "report.bin")
+		_, _ = fw.Write(bytes.Repeat([]byte("x"), size))
+		_ = mw.Close()
+		return mw.FormDataContentType(), &buf
+	}
+
+	ctype, body := build(64 * 1024)
+	w := doRequest(app, http.MethodPost, "/upload", chunkedReader{body}, "Content-Type", ctype)
+	if w.Code != 200 || strings.TrimSpace(w.Body.String()) != `{"name":"report","size":65536}` {
+		t.Fatalf("Expected upload, got %d (%s)", w.Code, w.Body.String())
+	}
+
+	if tmpFile == "" {
+		t.Fatal("Expected file stored on disk")
+	}
+	if _, err := os.Stat(tmpFile); !os.IsNotExist(err) {
+		t.Errorf("Expected temporary file removed after the request, got %v", err)
+	}
+
+	ctype, body = build(2 << 20)
+	if w = doRequest(app, http.MethodPost, "/upload", chunkedReader{body}, "Content-Type", ctype); w.Code != 413 {
+		t.Errorf("Expected 413 for an upload over the body limit, got %d", w.Code)
+	}
+}
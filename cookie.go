@@ -0,0 +1,288 @@
+package ursa
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	CookieSameSiteLax    = "Lax"
+	CookieSameSiteStrict = "Strict"
+	CookieSameSiteNone   = "None"
+	// CookieSameSiteDisabled omits the SameSite attribute
+	CookieSameSiteDisabled = "disabled"
+)
+
+var (
+	errCookieKeys    = errors.New("cookie keys are not configured, see Config.CookieKeys")
+	errCookieInvalid = errors.New("invalid cookie value")
+)
+
+// Cookie is a response cookie written by Ctx.Cookie.
+//
+// Secure defaults are applied when writing it: Path defaults to "/",
+// SameSite to Lax, and Secure is forced for HTTPS requests, including those
+// reported by a trusted proxy (see Ctx.Scheme), SameSite=None, Partitioned,
+// and the "__Secure-" and "__Host-" name prefixes.
+type Cookie struct {
+	Name     string
+	Value    string
+	Path     string
+	Domain   string
+	Expires  time.Time
+	MaxAge   int // < 0 deletes the cookie, 0 leaves Max-Age unset
+	Secure   bool
+	HTTPOnly bool
+
+	// SameSite is one of CookieSameSiteLax, CookieSameSiteStrict,
+	// CookieSameSiteNone or CookieSameSiteDisabled.
+	// Default: CookieSameSiteLax
+	SameSite string
+
+	// Partitioned stores the cookie in partitioned storage (CHIPS).
+	Partitioned bool
+}
+
+// Cookie sets a response cookie.
+func (c *Ctx) Cookie(cookie *Cookie) {
+	hc := &http.Cookie{
+		Name:     cookie.Name,
+		Value:    cookie.Value,
+		Path:     cookie.Path,
+		Domain:   cookie.Domain,
+		Expires:  cookie.Expires,
+		MaxAge:   cookie.MaxAge,
+		Secure:   cookie.Secure || c.Scheme() == "https" || cookie.Partitioned,
+		HttpOnly: cookie.HTTPOnly,
+	}
+
+	if hc.Path == "" {
+		hc.Path = "/"
+	}
+
+	switch {
+	case strings.EqualFold(cookie.SameSite, CookieSameSiteStrict):
+		hc.SameSite = http.SameSiteStrictMode
+	case strings.EqualFold(cookie.SameSite, CookieSameSiteNone):
+		hc.SameSite = http.SameSiteNoneMode
+		hc.Secure = true
+	case strings.EqualFold(cookie.SameSite, CookieSameSiteDisabled):
+	default:
+		hc.SameSite = http.SameSiteLaxMode
+	}
+
+	if strings.HasPrefix(hc.Name, "__Secure-") {
+		hc.Secure = true
+	}
+
+	if strings.HasPrefix(hc.Name, "__Host-") {
+		hc.Secure = true
+		hc.Path = "/"
+		hc.Domain = ""
+	}
+
+	v := hc.String()
+	if v == "" {
+		return
+	}
+
+	if cookie.Partitioned {
+		v += "; Partitioned"
+	}
+
+	c.Writer.Header().Add("Set-Cookie", v)
+}
+
+// ClearCookie expires the named cookies on the client, or all the request
+// cookies when no name is given. Cookies set with a Path or Domain other
+// than the defaults must be cleared with Cookie and a negative MaxAge.
+func (c *Ctx) ClearCookie(names ...string) {
+	if len(names) == 0 {
+		for _, cookie := range c.Request.Cookies() {
+			names = append(names, cookie.Name)
+		}
+	}
+
+	for _, name := range names {
+		c.Cookie(&Cookie{
+			Name:    name,
+			Expires: time.Unix(0, 0),
+			MaxAge:  -1,
+		})
+	}
+}
+
+// SignedCookie sets a cookie whose value is authenticated with HMAC-SHA256
+// under the first of Config.CookieKeys. The value stays readable by the
+// client, use EncryptedCookie to hide it.
+func (c *Ctx) SignedCookie(cookie *Cookie) error {
+	keys := c.app.cookieKeys
+	if len(keys) == 0 {
+		return errCookieKeys
+	}
+
+	signed := *cookie
+	signed.Value = keys[0].sign(cookie.Name, cookie.Value)
+	c.Cookie(&signed)
+
+	return nil
+}
+
+// SignedCookies returns the value of a cookie set by SignedCookie, trying
+// all of Config.CookieKeys, or the default value when it is missing or
+// its signature is invalid.
+func (c *Ctx) SignedCookies(key string, defaultValue ...string) string {
+	raw := c.Cookies(key)
+	if raw == "" {
+		return defaultString("", defaultValue)
+	}
+
+	for _, k := range c.app.cookieKeys {
+		if value, err := k.verify(key, raw); err == nil {
+			return value
+		}
+	}
+
+	return defaultString("", defaultValue)
+}
+
+// EncryptedCookie sets a cookie whose value is encrypted and authenticated
+// with AES-256-GCM under the first of Config.CookieKeys.
+func (c *Ctx) EncryptedCookie(cookie *Cookie) error {
+	keys := c.app.cookieKeys
+	if len(keys) == 0 {
+		return errCookieKeys
+	}
+
+	value, err := keys[0].encrypt(cookie.Name, cookie.Value)
+	if err != nil {
+		return err
+	}
+
+	encrypted := *cookie
+	encrypted.Value = value
+	c.Cookie(&encrypted)
+
+	return nil
+}
+
+// EncryptedCookies returns the decrypted value of a cookie set by
+// EncryptedCookie, trying all of Config.CookieKeys, or the default value
+// when it is missing or cannot be decrypted.
+func (c *Ctx) EncryptedCookies(key string, defaultValue ...string) string {
+	raw := c.Cookies(key)
+	if raw == "" {
+		return defaultString("", defaultValue)
+	}
+
+	for _, k := range c.app.cookieKeys {
+		if value, err := k.decrypt(key, raw); err == nil {
+			return value
+		}
+	}
+
+	return defaultString("", defaultValue)
+}
+
+// cookieKey holds the signing and encryption keys derived from one of
+// Config.CookieKeys, so the same secret is never used for both.
+type cookieKey struct {
+	signKey []byte
+	aead    cipher.AEAD
+}
+
+func newCookieKeys(secrets []string) []cookieKey {
+	keys := make([]cookieKey, 0, len(secrets))
+
+	for _, secret := range secrets {
+		elsePanic(len(secret) >= 16, "cookie keys must be at least 16 bytes long")
+
+		block, err := aes.NewCipher(deriveKey(secret, "ursa cookie encryption"))
+		elsePanic(err == nil, "invalid cookie key")
+
+		aead, err := cipher.NewGCM(block)
+		elsePanic(err == nil, "invalid cookie key")
+
+		keys = append(keys, cookieKey{
+			signKey: deriveKey(secret, "ursa cookie signature"),
+			aead:    aead,
+		})
+	}
+
+	return keys
+}
+
+func deriveKey(secret, purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// sign returns base64(value) + "." + base64(mac), the cookie name is part
+// of the mac so that a value cannot be replayed under another name.
+func (k cookieKey) sign(name, value string) string {
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(value))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(k.mac(name, encoded))
+}
+
+func (k cookieKey) verify(name, raw string) (string, error) {
+	encoded, sig, ok := strings.Cut(raw, ".")
+	if !ok {
+		return "", errCookieInvalid
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, k.mac(name, encoded)) {
+		return "", errCookieInvalid
+	}
+
+	value, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", errCookieInvalid
+	}
+
+	return string(value), nil
+}
+
+func (k cookieKey) mac(name, encoded string) []byte {
+	mac := hmac.New(sha256.New, k.signKey)
+	mac.Write([]byte(name))
+	mac.Write([]byte{'='})
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
+
+func (k cookieKey) encrypt(name, value string) (string, error) {
+	nonce := make([]byte, k.aead.NonceSize(), k.aead.NonceSize()+len(value)+k.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := k.aead.Seal(nonce, nonce, []byte(value), []byte(name))
+
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+func (k cookieKey) decrypt(name, raw string) (string, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil || len(sealed) < k.aead.NonceSize() {
+		return "", errCookieInvalid
+	}
+
+	nonce, ciphertext := sealed[:k.aead.NonceSize()], sealed[k.aead.NonceSize():]
+
+	value, err := k.aead.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return "", errCookieInvalid
+	}
+
+	return string(value), nil
+}
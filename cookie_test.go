@@ -0,0 +1,138 @@
+package ursa
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestCtxCookie tests cookie writing with secure defaults
+func TestCtxCookie(t *testing.T) {
+	app := New()
+
+	app.Get("/set", func(c *Ctx) error {
+		c.Cookie(&Cookie{Name: "theme", Value: "dark", HTTPOnly: true})
+		c.Cookie(&Cookie{Name: "__Host-id", Value: "1", Path: "/app", Domain: "example.com"})
+		c.Cookie(&Cookie{Name: "embed", Value: "1", SameSite: CookieSameSiteNone, Partitioned: true})
+		return c.SendString("ok")
+	})
+
+	app.Get("/clear", func(c *Ctx) error {
+		c.ClearCookie()
+		return c.SendString("ok")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/set", nil)
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+
+	cookies := w.Header().Values("Set-Cookie")
+	if len(cookies) != 3 {
+		t.Fatalf("Expected 3 cookies, got %v", cookies)
+	}
+	if cookies[0] != "theme=dark; Path=/; HttpOnly; SameSite=Lax" {
+		t.Errorf("Unexpected cookie '%s'", cookies[0])
+	}
+	if cookies[1] != "__Host-id=1; Path=/; Secure; SameSite=Lax" {
+		t.Errorf("Unexpected __Host- cookie '%s'", cookies[1])
+	}
+	if cookies[2] != "embed=1; Path=/; Secure; SameSite=None; Partitioned" {
+		t.Errorf("Unexpected partitioned cookie '%s'", cookies[2])
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/clear", nil)
+	req.TLS = &tls.ConnectionState{}
+	req.Header.Set("Cookie", "a=1; b=2")
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+
+	cookies = w.Header().Values("Set-Cookie")
+	if len(cookies) != 2 || !strings.Contains(cookies[0], "Max-Age=0") || !strings.Contains(cookies[1], "Secure") {
+		t.Errorf("Expected 2 secure expired cookies, got %v", cookies)
+	}
+
+	// HTTPS terminated by a trusted proxy
+	app = New(Config{TrustedProxies: []string{"10.0.0.1"}})
+	app.Get("/set", func(c *Ctx) error {
+		c.Cookie(&Cookie{Name: "theme", Value: "dark"})
+		return c.SendString("ok")
+	})
+
+	req = httptest.NewRequest(http.MethodGet, "/set", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+
+	if cookie := w.Header().Get("Set-Cookie"); !strings.Contains(cookie, "Secure") {
+		t.Errorf("Expected a secure cookie behind an HTTPS proxy, got '%s'", cookie)
+	}
+}
+
+// TestCtxSignedAndEncryptedCookie tests signed and encrypted cookies with key rotation
+func TestCtxSignedAndEncryptedCookie(t *testing.T) {
+	oldKey := "old-secret-key-0123456789"
+	newKey := "new-secret-key-0123456789"
+
+	setApp := New(Config{CookieKeys: []string{oldKey}})
+	setApp.Get("/set", func(c *Ctx) error {
+		if err := c.SignedCookie(&Cookie{Name: "user", Value: "alice"}); err != nil {
+			return err
+		}
+		return c.EncryptedCookie(&Cookie{Name: "secret", Value: "s3cr3t"})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/set", nil)
+	w := httptest.NewRecorder()
+	setApp.ServeHTTP(w, req)
+
+	var pairs []string
+	for _, v := range w.Header().Values("Set-Cookie") {
+		pair, _, _ := strings.Cut(v, ";")
+		if strings.Contains(pair, "s3cr3t") {
+			t.Errorf("Expected encrypted cookie value, got '%s'", pair)
+		}
+		pairs = append(pairs, pair)
+	}
+
+	// rotated keys: the old key is still accepted for reading
+	getApp := New(Config{CookieKeys: []string{newKey, oldKey}})
+	getApp.Get("/get", func(c *Ctx) error {
+		return c.SendString(c.SignedCookies("user") + "," + c.EncryptedCookies("secret") + "," + c.SignedCookies("secret", "invalid"))
+	})
+
+	req = httptest.NewRequest(http.MethodGet, "/get", nil)
+	req.Header.Set("Cookie", strings.Join(pairs, "; "))
+	w = httptest.NewRecorder()
+	getApp.ServeHTTP(w, req)
+
+	if w.Body.String() != "alice,s3cr3t,invalid" {
+		t.Errorf("Expected 'alice,s3cr3t,invalid', got '%s'", w.Body.String())
+	}
+
+	// tampered value
+	req = httptest.NewRequest(http.MethodGet, "/get", nil)
+	req.Header.Set("Cookie", strings.Replace(pairs[0], "user=", "user=Y", 1))
+	w = httptest.NewRecorder()
+	getApp.ServeHTTP(w, req)
+
+	if strings.HasPrefix(w.Body.String(), "alice") {
+		t.Error("Expected tampered signed cookie to be rejected")
+	}
+
+	noKeys := New()
+	noKeys.Get("/set", func(c *Ctx) error {
+		return c.SignedCookie(&Cookie{Name: "user", Value: "alice"})
+	})
+
+	req = httptest.NewRequest(http.MethodGet, "/set", nil)
+	w = httptest.NewRecorder()
+	noKeys.ServeHTTP(w, req)
+
+	if w.Code != 500 {
+		t.Errorf("Expected status 500 without cookie keys, got %d", w.Code)
+	}
+}
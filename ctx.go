@@ -14,15 +14,15 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/loveuer/ursa/internal/sse"
 )
 
-var forwardHeaders = []string{"CF-Connecting-IP", "X-Forwarded-For", "X-Real-Ip"}
-
 type Ctx struct {
 	lock       sync.Mutex
 	writermem  responseWriter
@@ -39,6 +39,14 @@ type Ctx struct {
 	locals       map[string]interface{}
 	skippedNodes *[]skippedNode
 	fullPath     string
+
+	// body limits the request body, bodyExceeded is set once it was hit
+	body         bodyReader
+	bodyExceeded bool
+
+	// detached is set when a handler goroutine may outlive ServeHTTP,
+	// in which case the Ctx must not go back to the pool.
+	detached bool
 }
 
 func (c *Ctx) reset(w http.ResponseWriter, r *http.Request) {
@@ -58,6 +66,13 @@ func (c *Ctx) reset(w http.ResponseWriter, r *http.Request) {
 	c.StatusCode = 200
 
 	c.fullPath = ""
+	c.detached = false
+
+	c.body = bodyReader{c: c, r: r.Body, limit: c.app.config.BodyLimit}
+	c.bodyExceeded = false
+	if r.Body != nil && r.Body != http.NoBody {
+		c.Request.Body = &c.body
+	}
 	*c.params = (*c.params)[:0]
 	*c.skippedNodes = (*c.skippedNodes)[:0]
 	for key := range c.locals {
@@ -68,7 +83,10 @@ func (c *Ctx) reset(w http.ResponseWriter, r *http.Request) {
 
 func (c *Ctx) Drop() error {
 	if h, ok := c.Writer.(http.Hijacker); ok {
-		conn, _, _ := h.Hijack()
+		conn, _, err := h.Hijack()
+		if err != nil {
+			return err
+		}
 		return conn.Close()
 	}
 
@@ -118,6 +136,18 @@ func (c *Ctx) Cookies(key string, defaultValue ...string) string {
 	return cookie.Value
 }
 
+// FullPath returns the matched route pattern, e.g. "/user/:id",
+// or "" when no route matched.
+func (c *Ctx) FullPath() string {
+	return c.fullPath
+}
+
+// RouteMeta returns the metadata declared for the matched route with
+// RouterGroup.WithMeta, or nil when it is not set.
+func (c *Ctx) RouteMeta(key string) any {
+	return c.app.getRouteMeta(c.method, c.fullPath)[key]
+}
+
 func (c *Ctx) Context() context.Context {
 	return c.Request.Context()
 }
@@ -126,44 +156,94 @@ func (c *Ctx) SetContext(ctx context.Context) {
 	c.Request = c.Request.WithContext(ctx)
 }
 
+// Next runs the next handler in the chain. A handler that returns
+// without calling Next ends the chain, as does Abort.
 func (c *Ctx) Next() error {
-	c.index++
-
-	if c.index >= len(c.handlers) {
+	if c.IsAborted() {
 		return nil
 	}
 
-	var (
-		err     error
-		handler = c.handlers[c.index]
-	)
+	c.index++
 
-	if handler != nil {
-		if err = handler(c); err != nil {
-			return err
+	for c.index < len(c.handlers) {
+		if handler := c.handlers[c.index]; handler != nil {
+			return handler(c)
 		}
-	}
 
-	c.index++
+		c.index++
+	}
 
 	return nil
 }
 
+// Abort prevents pending handlers from being called. It does not stop
+// the current handler, and handlers already running keep their
+// post-processing after their own Next call returns.
+func (c *Ctx) Abort() {
+	c.index = int(abortIndex)
+}
+
+// AbortWithStatus calls Abort and writes the headers with the given status code.
+func (c *Ctx) AbortWithStatus(code int) error {
+	c.Abort()
+	return c.SendStatus(code)
+}
+
+// AbortWithError calls AbortWithStatus and returns err, so that it can be
+// reported by outer middlewares such as the logger.
+func (c *Ctx) AbortWithError(code int, err error) error {
+	_ = c.AbortWithStatus(code)
+	return err
+}
+
+// IsAborted returns true if the current context was aborted.
+func (c *Ctx) IsAborted() bool {
+	return c.index >= int(abortIndex)
+}
+
 /* ===============================================================
 || Handle Ctx Request Part
 =============================================================== */
 
+// verify applies the body limit of the matched route, and rejects bodies
+// declaring a larger Content-Length before any handler runs
 func (c *Ctx) verify() error {
-	// 验证 body size
-	if c.app.config.BodyLimit != -1 && c.Request.ContentLength > c.app.config.BodyLimit {
+	limit := c.app.config.BodyLimit
+	switch v := c.RouteMeta(MetaBodyLimit).(type) {
+	case int64:
+		limit = v
+	case int:
+		limit = int64(v)
+	}
+
+	c.body.limit = limit
+	if limit >= 0 && c.Request.ContentLength > limit {
+		c.bodyExceeded = true
 		return NewNFError(413, "Content Too Large")
 	}
 
 	return nil
 }
 
+// bodyError returns the 413 Err when reading the body hit its limit, and
+// a 400 Err of err otherwise
+func (c *Ctx) bodyError(err error) error {
+	if c.bodyExceeded {
+		return NewNFError(413, "Content Too Large")
+	}
+
+	return NewNFError(400, err.Error())
+}
+
+// Body reads the request body, it returns nil when the body exceeds its
+// limit, the request then being answered with 413 unless the handler
+// already responded.
 func (c *Ctx) Body() []byte {
-	bs, _ := io.ReadAll(c.Request.Body)
+	bs, err := io.ReadAll(c.Request.Body)
+	if err != nil && c.bodyExceeded {
+		return nil
+	}
+
 	return bs
 }
 
@@ -193,8 +273,13 @@ func (c *Ctx) FormFile(key string) (*multipart.FileHeader, error) {
 	return fh, err
 }
 
+// MultipartForm parses a multipart body, keeping up to
+// Config.MultipartMemory bytes in memory and the rest in temporary files.
 func (c *Ctx) MultipartForm() (*multipart.Form, error) {
-	if err := c.Request.ParseMultipartForm(c.app.config.BodyLimit); err != nil {
+	if err := c.Request.ParseMultipartForm(c.app.config.MultipartMemory); err != nil {
+		if c.bodyExceeded {
+			return nil, NewNFError(413, "Content Too Large")
+		}
 		return nil, err
 	}
 
@@ -224,37 +309,75 @@ func (c *Ctx) Get(key string, defaultValue ...string) string {
 	return value
 }
 
+// Scheme returns "https" or "http". Behind a trusted proxy, see
+// Config.TrustedProxies, it is the scheme of the client request reported
+// by the Forwarded or X-Forwarded-Proto header.
 func (c *Ctx) Scheme() string {
 	if c.Request.TLS != nil {
 		return "https"
 	}
-	if scheme := c.Get("X-Forwarded-Proto"); scheme != "" {
-		return scheme
+
+	if hops, client := c.resolveProxy(); hops != nil {
+		if proto := forwarded(hops, client, func(hop proxyHop) string { return hop.proto }); proto == "https" || proto == "http" {
+			return proto
+		}
 	}
+
 	return "http"
 }
 
+// Host returns the host requested by the client, with its port if any.
+// Behind a trusted proxy, see Config.TrustedProxies, it is reported by the
+// Forwarded or X-Forwarded-Host header.
+func (c *Ctx) Host() string {
+	if hops, client := c.resolveProxy(); hops != nil {
+		if host := forwarded(hops, client, func(hop proxyHop) string { return hop.host }); host != "" {
+			return host
+		}
+	}
+
+	return c.Request.Host
+}
+
+// Hostname returns Host without its port
+func (c *Ctx) Hostname() string {
+	host := c.Host()
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+
+	return strings.Trim(host, "[]")
+}
+
 func (c *Ctx) Protocol() string {
 	return c.Request.Proto
 }
 
+// IP returns the address of the peer. With useProxyHeader, and when the
+// peer is a trusted proxy, see Config.TrustedProxies, it returns the client
+// address reported by Config.ProxyHeader, or else by the Forwarded,
+// X-Forwarded-For or X-Real-Ip headers, walked from the right and skipping
+// trusted proxies. Headers sent by untrusted peers are ignored, as they
+// can be forged.
 func (c *Ctx) IP(useProxyHeader ...bool) string {
-	ip, _, err := net.SplitHostPort(strings.TrimSpace(c.Request.RemoteAddr))
-	if err != nil {
-		return ""
-	}
-
-	if len(useProxyHeader) > 0 && useProxyHeader[0] {
-		for _, h := range forwardHeaders {
-			if rip := c.Request.Header.Get(h); rip != "" {
-				for _, part := range strings.Split(rip, ",") {
-					realIP := strings.TrimSpace(part)
-					if check := net.ParseIP(realIP); check != nil {
-						return realIP
-					}
-				}
-			}
+	ip := c.remoteIP()
+
+	if len(useProxyHeader) == 0 || !useProxyHeader[0] {
+		return ip
+	}
+
+	if header := c.app.config.ProxyHeader; header != "" {
+		if !c.app.isTrustedProxy(net.ParseIP(ip)) {
+			return ip
+		}
+		if clientIP := net.ParseIP(strings.TrimSpace(c.Request.Header.Get(header))); clientIP != nil {
+			return clientIP.String()
 		}
+		return ip
+	}
+
+	if hops, client := c.resolveProxy(); hops != nil && hops[client].ip != nil {
+		return hops[client].ip.String()
 	}
 
 	return ip
@@ -300,14 +423,14 @@ func (c *Ctx) BodyParser(out interface{}) error {
 
 	if strings.HasPrefix(ctype, MIMEApplicationForm) {
 		if err = c.Request.ParseForm(); err != nil {
-			return NewNFError(400, err.Error())
+			return c.bodyError(err)
 		}
 		return parseToStruct("form", out, c.Request.Form)
 	}
 
 	if strings.HasPrefix(ctype, MIMEMultipartForm) {
-		if err = c.Request.ParseMultipartForm(c.app.config.BodyLimit); err != nil {
-			return NewNFError(400, err.Error())
+		if err = c.Request.ParseMultipartForm(c.app.config.MultipartMemory); err != nil {
+			return c.bodyError(err)
 		}
 		return parseToStruct("form", out, c.Request.PostForm)
 	}
@@ -319,6 +442,8 @@ func (c *Ctx) QueryParser(out interface{}) error {
 	return parseToStruct("query", out, c.Request.URL.Query())
 }
 
+// SaveFile stores fh at path, which must not be derived from the request,
+// see SaveFileTo for uploads named by the server.
 func (c *Ctx) SaveFile(fh *multipart.FileHeader, path string) (err error) {
 	var (
 		f  multipart.File
@@ -352,7 +477,7 @@ func (c *Ctx) Status(code int) *Ctx {
 	defer c.lock.Unlock()
 
 	c.Writer.WriteHeader(code)
-	c.StatusCode = c.writermem.status
+	c.StatusCode = c.Writer.Status()
 
 	return c
 }
@@ -401,10 +526,10 @@ func (c *Ctx) JSON(data interface{}) error {
 	return nil
 }
 
+// SSEvent writes a single server-sent event, see SSEStream for streams
 func (c *Ctx) SSEvent(event string, data interface{}) error {
-	c.Set("Content-Type", "text/event-stream")
+	c.Set("Content-Type", sse.ContentType)
 	c.Set("Cache-Control", "no-cache")
-	c.Set("Transfer-Encoding", "chunked")
 
 	return sse.Encode(c.Writer, sse.Event{Event: event, Data: data})
 }
@@ -439,12 +564,16 @@ func (c *Ctx) Redirect(url string, code int) error {
 	return nil
 }
 
+// SendStream sends stream, or only its first size bytes with a matching
+// Content-Length when size is given.
 func (c *Ctx) SendStream(stream io.Reader, size ...int) (err error) {
 	if len(size) > 0 && size[0] > 0 {
-		_, err = io.CopyN(c.Writer, stream, int64(size[0]))
+		c.Set("Content-Length", strconv.Itoa(size[0]))
+		_, err = copyZeroAlloc(c.Writer, io.LimitReader(stream, int64(size[0])))
+		return err
 	}
 
-	_, err = io.Copy(c.Writer, stream)
+	_, err = copyZeroAlloc(c.Writer, stream)
 
 	return err
 }
@@ -458,3 +587,104 @@ func (c *Ctx) SendStreamWriter(streamWriter func(*bufio.Writer)) error {
 func (c *Ctx) Write(data []byte) (int, error) {
 	return c.Writer.Write(data)
 }
+
+/* ===============================================================
+|| Handle Ctx Conditional Request Part
+=============================================================== */
+
+// LastModified sets the Last-Modified response header, used as validator
+// by Fresh and CheckPreconditions.
+func (c *Ctx) LastModified(t time.Time) {
+	if t.IsZero() {
+		return
+	}
+
+	c.Set("Last-Modified", t.UTC().Format(http.TimeFormat))
+}
+
+// Fresh reports whether the client cache is still valid for a GET or HEAD
+// request, comparing If-None-Match and If-Modified-Since with the ETag and
+// Last-Modified response headers set so far. A fresh request can be
+// answered with c.SendStatus(304).
+func (c *Ctx) Fresh() bool {
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		return false
+	}
+
+	if status := c.Writer.Status(); (status < 200 || status >= 300) && status != http.StatusNotModified {
+		return false
+	}
+
+	var (
+		inm = c.Get("If-None-Match")
+		ims = c.Get("If-Modified-Since")
+	)
+
+	if inm == "" && ims == "" {
+		return false
+	}
+
+	if strings.Contains(c.Get("Cache-Control"), "no-cache") {
+		return false
+	}
+
+	// If-Modified-Since is ignored when If-None-Match is present, RFC 9110 13.1.3
+	if inm != "" {
+		return etagMatch(inm, c.Writer.Header().Get("ETag"), false)
+	}
+
+	lastModified, err := http.ParseTime(c.Writer.Header().Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+
+	return !lastModified.Truncate(time.Second).After(since)
+}
+
+// Stale is the opposite of Fresh.
+func (c *Ctx) Stale() bool {
+	return !c.Fresh()
+}
+
+// CheckPreconditions evaluates If-Match, If-Unmodified-Since and, for
+// state changing methods, If-None-Match against the ETag and Last-Modified
+// response headers describing the current resource, following RFC 9110
+// section 13.2.2. It returns a 412 Err when a precondition fails, which
+// makes optimistic concurrency control a matter of:
+//
+//	c.Set("ETag", item.ETag())
+//	if err := c.CheckPreconditions(); err != nil {
+//		return err
+//	}
+func (c *Ctx) CheckPreconditions() error {
+	var (
+		h     = c.Writer.Header()
+		etag  = h.Get("ETag")
+		match = c.Get("If-Match")
+	)
+
+	if match != "" {
+		if !etagMatch(match, etag, true) {
+			return NewNFError(http.StatusPreconditionFailed, "Precondition Failed")
+		}
+	} else if ius := c.Get("If-Unmodified-Since"); ius != "" {
+		since, err := http.ParseTime(ius)
+		lastModified, lerr := http.ParseTime(h.Get("Last-Modified"))
+		if err == nil && lerr == nil && lastModified.Truncate(time.Second).After(since) {
+			return NewNFError(http.StatusPreconditionFailed, "Precondition Failed")
+		}
+	}
+
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		if inm := c.Get("If-None-Match"); inm != "" && etagMatch(inm, etag, false) {
+			return NewNFError(http.StatusPreconditionFailed, "Precondition Failed")
+		}
+	}
+
+	return nil
+}
@@ -7,10 +7,9 @@ require (
 	github.com/go-git/go-git/v5 v5.12.0
 	github.com/google/uuid v1.6.0
 	github.com/spf13/cobra v1.8.1
+	golang.org/x/sync v0.7.0
 )
 
-require golang.org/x/sync v0.7.0 // indirect
-
 require (
 	dario.cat/mergo v1.0.0 // indirect
 	github.com/Microsoft/go-winio v0.6.1 // indirect
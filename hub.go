@@ -0,0 +1,549 @@
+package ursa
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrHubClosed is returned when registering to a closed Hub, and passed
+	// to the onDisconnect of its clients when it closes
+	ErrHubClosed = errors.New("hub: closed")
+
+	// ErrHubSlowClient is passed to onDisconnect when a client is dropped
+	// by the HubDisconnect policy
+	ErrHubSlowClient = errors.New("hub: slow client")
+)
+
+// HubPolicy is what a Hub does when the buffer of a client is full
+type HubPolicy int
+
+const (
+	// HubDropOldest drops the oldest buffered message to make room
+	HubDropOldest HubPolicy = iota
+	// HubDropNewest drops the message being delivered
+	HubDropNewest
+	// HubDisconnect disconnects the client
+	HubDisconnect
+)
+
+// HubMessage is a message published through a Broker. It is delivered to
+// the clients in Room, or else of User, or else to every client; with both
+// Room and User, to the clients of User in Room.
+type HubMessage struct {
+	Room string `json:"room,omitempty"`
+	User string `json:"user,omitempty"`
+
+	// Except is the ID of a client skipped, e.g. the sender
+	Except string `json:"except,omitempty"`
+
+	Data []byte `json:"data"`
+}
+
+// Broker fans messages out to the hubs of every instance. Publish must
+// deliver the message to all the subscribers, on every instance, the
+// publishing one included. Implement it over an external bus (Redis
+// pub/sub, NATS...) to broadcast across instances.
+type Broker interface {
+	Publish(msg HubMessage) error
+
+	// Subscribe calls handler with every published message until
+	// unsubscribe is called.
+	Subscribe(handler func(msg HubMessage)) (unsubscribe func(), err error)
+}
+
+// MemoryBroker is an in-process Broker, for a single instance
+type MemoryBroker struct {
+	lock     sync.RWMutex
+	handlers map[int]func(msg HubMessage)
+	next     int
+}
+
+var _ Broker = (*MemoryBroker)(nil)
+
+// NewMemoryBroker returns a MemoryBroker without subscribers
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{handlers: make(map[int]func(msg HubMessage))}
+}
+
+func (b *MemoryBroker) Publish(msg HubMessage) error {
+	b.lock.RLock()
+	handlers := make([]func(msg HubMessage), 0, len(b.handlers))
+	for _, handler := range b.handlers {
+		handlers = append(handlers, handler)
+	}
+	b.lock.RUnlock()
+
+	for _, handler := range handlers {
+		handler(msg)
+	}
+
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(handler func(msg HubMessage)) (func(), error) {
+	b.lock.Lock()
+	id := b.next
+	b.next++
+	b.handlers[id] = handler
+	b.lock.Unlock()
+
+	return func() {
+		b.lock.Lock()
+		delete(b.handlers, id)
+		b.lock.Unlock()
+	}, nil
+}
+
+// HubConfig defines the config of a Hub
+type HubConfig struct {
+	// Broker distributes the published messages.
+	// Default: NewMemoryBroker()
+	Broker Broker
+
+	// BufferSize is the number of messages buffered for each client.
+	// Default: 64
+	BufferSize int
+
+	// Policy applies to clients whose buffer is full.
+	// Default: HubDropOldest
+	Policy HubPolicy
+
+	// OnDrop is called with the messages dropped by the policy.
+	// Default: nil
+	OnDrop func(client *HubClient, data []byte)
+}
+
+// DefaultHubConfig is the default Hub config
+var DefaultHubConfig = HubConfig{
+	BufferSize: 64,
+	Policy:     HubDropOldest,
+}
+
+// Hub tracks real-time clients, such as WebSocket connections or SSE
+// streams, and the rooms they joined, and delivers the messages published
+// through its Broker to them. Each client has a buffer, so that a slow
+// client never blocks the others.
+type Hub struct {
+	config      HubConfig
+	unsubscribe func()
+
+	lock    sync.RWMutex
+	closed  bool
+	clients map[*HubClient]struct{}
+	rooms   map[string]map[*HubClient]struct{}
+	users   map[string]map[*HubClient]struct{}
+}
+
+// HubClient is a client registered to a Hub
+type HubClient struct {
+	// ID identifies the client, see HubMessage.Except
+	ID string
+
+	// User is the user the client was registered for, may be empty
+	User string
+
+	hub          *Hub
+	messages     chan []byte
+	onDisconnect func(err error)
+	rooms        map[string]struct{} // guarded by the hub lock
+
+	lock    sync.Mutex
+	closed  bool
+	dropped uint64
+}
+
+// NewHub returns a Hub subscribed to its Broker
+func NewHub(config ...HubConfig) (*Hub, error) {
+	cfg := DefaultHubConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	// Set defaults
+	if cfg.Broker == nil {
+		cfg.Broker = NewMemoryBroker()
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = DefaultHubConfig.BufferSize
+	}
+
+	h := &Hub{
+		config:  cfg,
+		clients: make(map[*HubClient]struct{}),
+		rooms:   make(map[string]map[*HubClient]struct{}),
+		users:   make(map[string]map[*HubClient]struct{}),
+	}
+
+	unsubscribe, err := cfg.Broker.Subscribe(h.deliver)
+	if err != nil {
+		return nil, err
+	}
+	h.unsubscribe = unsubscribe
+
+	return h, nil
+}
+
+// Register adds a client for user, which may be empty. Its messages are
+// received from Messages, and it must be closed once gone. onDisconnect,
+// when not nil, is called in its own goroutine when the hub drops the
+// client, with ErrHubSlowClient or ErrHubClosed.
+func (h *Hub) Register(user string, onDisconnect func(err error)) (*HubClient, error) {
+	cl := &HubClient{
+		ID:           uuid.NewString(),
+		User:         user,
+		hub:          h,
+		messages:     make(chan []byte, h.config.BufferSize),
+		onDisconnect: onDisconnect,
+		rooms:        make(map[string]struct{}),
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.closed {
+		return nil, ErrHubClosed
+	}
+
+	h.clients[cl] = struct{}{}
+	if user != "" {
+		addHubMember(h.users, user, cl)
+	}
+
+	return cl, nil
+}
+
+// RegisterWS registers ws for user and writes the messages of the client
+// to it, as text messages when they are valid UTF-8 and binary otherwise.
+// The client is closed with the connection, which is closed when the hub
+// drops the client.
+//
+//	app.Get("/chat/:room", auth, ursa.WebSocket(func(ws *ursa.WSConn) {
+//		client, err := hub.RegisterWS(ws, ws.Locals("user").(string))
+//		if err != nil {
+//			return
+//		}
+//		defer client.Close()
+//
+//		client.Join(ws.Param("room"))
+//
+//		for {
+//			_, msg, err := ws.ReadMessage()
+//			if err != nil {
+//				return
+//			}
+//			_ = hub.BroadcastRoom(ws.Param("room"), msg)
+//		}
+//	}))
+func (h *Hub) RegisterWS(ws *WSConn, user string) (*HubClient, error) {
+	cl, err := h.Register(user, func(err error) {
+		code := WSClosePolicyViolation
+		if errors.Is(err, ErrHubClosed) {
+			code = WSCloseGoingAway
+		}
+		_ = ws.Close(code, err.Error())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		defer cl.Close()
+
+		for {
+			select {
+			case <-ws.done:
+				return
+			case data, ok := <-cl.messages:
+				if !ok {
+					return
+				}
+
+				messageType := WSBinaryMessage
+				if utf8.Valid(data) {
+					messageType = WSTextMessage
+				}
+
+				if err := ws.WriteMessage(messageType, data); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	return cl, nil
+}
+
+// Publish publishes msg through the Broker
+func (h *Hub) Publish(msg HubMessage) error {
+	return h.config.Broker.Publish(msg)
+}
+
+// Broadcast publishes data to every client
+func (h *Hub) Broadcast(data []byte) error {
+	return h.Publish(HubMessage{Data: data})
+}
+
+// BroadcastRoom publishes data to the clients in room
+func (h *Hub) BroadcastRoom(room string, data []byte) error {
+	return h.Publish(HubMessage{Room: room, Data: data})
+}
+
+// SendUser publishes data to the clients of user
+func (h *Hub) SendUser(user string, data []byte) error {
+	return h.Publish(HubMessage{User: user, Data: data})
+}
+
+// Clients returns the number of clients registered to this instance
+func (h *Hub) Clients() int {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	return len(h.clients)
+}
+
+// Rooms returns the rooms having clients on this instance, sorted
+func (h *Hub) Rooms() []string {
+	h.lock.RLock()
+	rooms := make([]string, 0, len(h.rooms))
+	for room := range h.rooms {
+		rooms = append(rooms, room)
+	}
+	h.lock.RUnlock()
+
+	sort.Strings(rooms)
+
+	return rooms
+}
+
+// RoomSize returns the number of clients in room on this instance
+func (h *Hub) RoomSize(room string) int {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	return len(h.rooms[room])
+}
+
+// Close unsubscribes from the Broker and disconnects all the clients
+func (h *Hub) Close() error {
+	h.lock.Lock()
+	if h.closed {
+		h.lock.Unlock()
+		return nil
+	}
+	h.closed = true
+
+	clients := make([]*HubClient, 0, len(h.clients))
+	for cl := range h.clients {
+		clients = append(clients, cl)
+	}
+	h.lock.Unlock()
+
+	h.unsubscribe()
+
+	for _, cl := range clients {
+		cl.close(ErrHubClosed)
+	}
+
+	return nil
+}
+
+// deliver enqueues msg to the local clients it targets
+func (h *Hub) deliver(msg HubMessage) {
+	type drop struct {
+		client *HubClient
+		data   []byte
+	}
+
+	var (
+		drops []drop
+		slow  []*HubClient
+	)
+
+	h.lock.RLock()
+
+	targets := h.clients
+	switch {
+	case msg.Room != "":
+		targets = h.rooms[msg.Room]
+	case msg.User != "":
+		targets = h.users[msg.User]
+	}
+
+	for cl := range targets {
+		if cl.ID == msg.Except || (msg.User != "" && cl.User != msg.User) {
+			continue
+		}
+
+		dropped, ok := cl.enqueue(msg.Data, h.config.Policy)
+		if !ok {
+			slow = append(slow, cl)
+		} else if dropped != nil && h.config.OnDrop != nil {
+			drops = append(drops, drop{client: cl, data: dropped})
+		}
+	}
+
+	h.lock.RUnlock()
+
+	for _, d := range drops {
+		h.config.OnDrop(d.client, d.data)
+	}
+
+	for _, cl := range slow {
+		cl.close(ErrHubSlowClient)
+	}
+}
+
+func addHubMember(sets map[string]map[*HubClient]struct{}, key string, cl *HubClient) {
+	set, ok := sets[key]
+	if !ok {
+		set = make(map[*HubClient]struct{})
+		sets[key] = set
+	}
+	set[cl] = struct{}{}
+}
+
+func removeHubMember(sets map[string]map[*HubClient]struct{}, key string, cl *HubClient) {
+	if set, ok := sets[key]; ok {
+		delete(set, cl)
+		if len(set) == 0 {
+			delete(sets, key)
+		}
+	}
+}
+
+// Messages returns the channel of the messages delivered to the client,
+// closed when the client is closed
+func (cl *HubClient) Messages() <-chan []byte {
+	return cl.messages
+}
+
+// Join adds the client to rooms
+func (cl *HubClient) Join(rooms ...string) {
+	h := cl.hub
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if _, ok := h.clients[cl]; !ok {
+		return
+	}
+
+	for _, room := range rooms {
+		cl.rooms[room] = struct{}{}
+		addHubMember(h.rooms, room, cl)
+	}
+}
+
+// Leave removes the client from rooms
+func (cl *HubClient) Leave(rooms ...string) {
+	h := cl.hub
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for _, room := range rooms {
+		delete(cl.rooms, room)
+		removeHubMember(h.rooms, room, cl)
+	}
+}
+
+// Rooms returns the rooms the client joined, sorted
+func (cl *HubClient) Rooms() []string {
+	cl.hub.lock.RLock()
+	rooms := make([]string, 0, len(cl.rooms))
+	for room := range cl.rooms {
+		rooms = append(rooms, room)
+	}
+	cl.hub.lock.RUnlock()
+
+	sort.Strings(rooms)
+
+	return rooms
+}
+
+// Dropped returns the number of messages dropped for the client
+func (cl *HubClient) Dropped() uint64 {
+	cl.lock.Lock()
+	defer cl.lock.Unlock()
+
+	return cl.dropped
+}
+
+// Close unregisters the client and closes its Messages channel
+func (cl *HubClient) Close() {
+	cl.close(nil)
+}
+
+// enqueue buffers data, returning the message dropped to do so if any, or
+// false when the client must be disconnected
+func (cl *HubClient) enqueue(data []byte, policy HubPolicy) (dropped []byte, ok bool) {
+	cl.lock.Lock()
+	defer cl.lock.Unlock()
+
+	if cl.closed {
+		return nil, true
+	}
+
+	select {
+	case cl.messages <- data:
+		return nil, true
+	default:
+	}
+
+	switch policy {
+	case HubDisconnect:
+		return nil, false
+	case HubDropOldest:
+		select {
+		case dropped = <-cl.messages:
+		default:
+		}
+
+		select {
+		case cl.messages <- data:
+		default:
+			dropped = data
+		}
+	default:
+		dropped = data
+	}
+
+	cl.dropped++
+
+	return dropped, true
+}
+
+func (cl *HubClient) close(err error) {
+	cl.lock.Lock()
+	if cl.closed {
+		cl.lock.Unlock()
+		return
+	}
+	cl.closed = true
+	close(cl.messages)
+	cl.lock.Unlock()
+
+	h := cl.hub
+
+	h.lock.Lock()
+	delete(h.clients, cl)
+	if cl.User != "" {
+		removeHubMember(h.users, cl.User, cl)
+	}
+	for room := range cl.rooms {
+		removeHubMember(h.rooms, room, cl)
+	}
+	cl.rooms = make(map[string]struct{})
+	h.lock.Unlock()
+
+	// the callback may block, e.g. on the write lock of a stalled
+	// WebSocket, which must not hold up the publisher
+	if err != nil && cl.onDisconnect != nil {
+		go cl.onDisconnect(err)
+	}
+}
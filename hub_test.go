@@ -0,0 +1,293 @@
+package ursa
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func receiveHub(t *testing.T, cl *HubClient) string {
+	t.Helper()
+
+	select {
+	case data := <-cl.Messages():
+		return string(data)
+	case <-time.After(time.Second):
+		t.Fatal("Expected a message")
+		return ""
+	}
+}
+
+func expectNoHubMessage(t *testing.T, cl *HubClient) {
+	t.Helper()
+
+	select {
+	case data := <-cl.Messages():
+		t.Fatalf("Unexpected message '%s'", data)
+	default:
+	}
+}
+
+// TestHubRooms tests broadcasts to everyone, rooms and users
+func TestHubRooms(t *testing.T) {
+	hub, err := NewHub()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hub.Close()
+
+	alice, _ := hub.Register("alice", nil)
+	bob, _ := hub.Register("bob", nil)
+	alice2, _ := hub.Register("alice", nil)
+
+	alice.Join("lobby", "games")
+	bob.Join("lobby")
+
+	if rooms := hub.Rooms(); !reflect.DeepEqual(rooms, []string{"games", "lobby"}) {
+		t.Errorf("Unexpected rooms %v", rooms)
+	}
+	if hub.Clients() != 3 || hub.RoomSize("lobby") != 2 {
+		t.Errorf("Unexpected counts %d %d", hub.Clients(), hub.RoomSize("lobby"))
+	}
+
+	_ = hub.Broadcast([]byte("all"))
+	for _, cl := range []*HubClient{alice, bob, alice2} {
+		if msg := receiveHub(t, cl); msg != "all" {
+			t.Errorf("Expected broadcast, got '%s'", msg)
+		}
+	}
+
+	_ = hub.BroadcastRoom("games", []byte("games"))
+	if msg := receiveHub(t, alice); msg != "games" {
+		t.Errorf("Expected room message, got '%s'", msg)
+	}
+	expectNoHubMessage(t, bob)
+	expectNoHubMessage(t, alice2)
+
+	_ = hub.SendUser("alice", []byte("dm"))
+	if receiveHub(t, alice) != "dm" || receiveHub(t, alice2) != "dm" {
+		t.Error("Expected the message on every client of the user")
+	}
+	expectNoHubMessage(t, bob)
+
+	_ = hub.Publish(HubMessage{Room: "lobby", Except: alice.ID, Data: []byte("from alice")})
+	if msg := receiveHub(t, bob); msg != "from alice" {
+		t.Errorf("Expected room message, got '%s'", msg)
+	}
+	expectNoHubMessage(t, alice)
+
+	bob.Leave("lobby")
+	alice.Close()
+	if _, ok := <-alice.Messages(); ok {
+		t.Error("Expected the channel closed")
+	}
+	if hub.RoomSize("lobby") != 0 || hub.Clients() != 2 {
+		t.Errorf("Unexpected counts %d %d", hub.RoomSize("lobby"), hub.Clients())
+	}
+	if rooms := hub.Rooms(); len(rooms) != 0 {
+		t.Errorf("Expected empty rooms removed, got %v", rooms)
+	}
+
+	// after close, onDisconnect is called and registering fails
+	disconnected := make(chan error, 1)
+	carol, _ := hub.Register("", func(err error) { disconnected <- err })
+	_ = hub.Close()
+	if err = <-disconnected; err != ErrHubClosed {
+		t.Errorf("Expected ErrHubClosed, got %v", err)
+	}
+	if _, ok := <-carol.Messages(); ok {
+		t.Error("Expected the channel closed")
+	}
+	if _, err = hub.Register("", nil); err != ErrHubClosed {
+		t.Errorf("Expected ErrHubClosed, got %v", err)
+	}
+}
+
+// TestHubBackpressure tests the policies for full buffers
+func TestHubBackpressure(t *testing.T) {
+	var dropped []string
+
+	oldest, _ := NewHub(HubConfig{BufferSize: 2, OnDrop: func(client *HubClient, data []byte) {
+		dropped = append(dropped, string(data))
+	}})
+	cl, _ := oldest.Register("", nil)
+	for _, msg := range []string{"1", "2", "3"} {
+		_ = oldest.Broadcast([]byte(msg))
+	}
+	if receiveHub(t, cl) != "2" || receiveHub(t, cl) != "3" || cl.Dropped() != 1 || !reflect.DeepEqual(dropped, []string{"1"}) {
+		t.Errorf("Expected the oldest message dropped, dropped %v", dropped)
+	}
+
+	newest, _ := NewHub(HubConfig{BufferSize: 2, Policy: HubDropNewest})
+	cl, _ = newest.Register("", nil)
+	for _, msg := range []string{"1", "2", "3"} {
+		_ = newest.Broadcast([]byte(msg))
+	}
+	if receiveHub(t, cl) != "1" || receiveHub(t, cl) != "2" || cl.Dropped() != 1 {
+		t.Error("Expected the newest message dropped")
+	}
+
+	disconnect, _ := NewHub(HubConfig{BufferSize: 1, Policy: HubDisconnect})
+	disconnected := make(chan error, 1)
+	slow, _ := disconnect.Register("", func(err error) { disconnected <- err })
+	fast, _ := disconnect.Register("", nil)
+	_ = disconnect.Broadcast([]byte("1"))
+	receiveHub(t, fast)
+	_ = disconnect.Broadcast([]byte("2"))
+
+	if err := <-disconnected; err != ErrHubSlowClient {
+		t.Errorf("Expected ErrHubSlowClient, got %v", err)
+	}
+	if receiveHub(t, fast) != "2" || disconnect.Clients() != 1 {
+		t.Error("Expected only the slow client disconnected")
+	}
+	if receiveHub(t, slow) != "1" {
+		t.Error("Expected the buffered message kept")
+	}
+	if _, ok := <-slow.Messages(); ok {
+		t.Error("Expected the channel closed")
+	}
+}
+
+// TestHubBroker tests hubs of several instances sharing a broker
+func TestHubBroker(t *testing.T) {
+	broker := NewMemoryBroker()
+	hub1, _ := NewHub(HubConfig{Broker: broker})
+	hub2, _ := NewHub(HubConfig{Broker: broker})
+
+	cl1, _ := hub1.Register("alice", nil)
+	cl2, _ := hub2.Register("alice", nil)
+	cl2.Join("lobby")
+
+	_ = hub1.SendUser("alice", []byte("dm"))
+	if receiveHub(t, cl1) != "dm" || receiveHub(t, cl2) != "dm" {
+		t.Error("Expected the message on both instances")
+	}
+
+	_ = hub1.BroadcastRoom("lobby", []byte("lobby"))
+	if receiveHub(t, cl2) != "lobby" {
+		t.Error("Expected the room message on the other instance")
+	}
+	expectNoHubMessage(t, cl1)
+
+	_ = hub2.Close()
+	_ = hub1.Broadcast([]byte("after"))
+	if receiveHub(t, cl1) != "after" {
+		t.Error("Expected the message on the open instance")
+	}
+	_ = hub1.Close()
+}
+
+// TestHubWebSocket tests WebSocket clients of a hub
+func TestHubWebSocket(t *testing.T) {
+	hub, _ := NewHub()
+	defer hub.Close()
+
+	app := New(Config{DisableLogger: true})
+	app.Get("/chat/:room", WebSocket(func(ws *WSConn) {
+		client, err := hub.RegisterWS(ws, ws.Query("user"))
+		if err != nil {
+			return
+		}
+		defer client.Close()
+
+		client.Join(ws.Param("room"))
+
+		for {
+			_, msg, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			_ = hub.Publish(HubMessage{Room: ws.Param("room"), Except: client.ID, Data: msg})
+		}
+	}))
+
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	alice := dialWS(t, srv, "/chat/lobby?user=alice")
+	bob := dialWS(t, srv, "/chat/lobby?user=bob")
+	if alice.resp.StatusCode != http.StatusSwitchingProtocols || bob.resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatal("Expected 101")
+	}
+
+	for hub.RoomSize("lobby") != 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	alice.writeFrame(0x81, []byte("hi bob"))
+	if first, payload := bob.readFrame(t); first != 0x81 || string(payload) != "hi bob" {
+		t.Errorf("Unexpected message %x '%s'", first, payload)
+	}
+
+	_ = hub.SendUser("alice", []byte{0xff})
+	if first, payload := alice.readFrame(t); first != 0x82 || len(payload) != 1 {
+		t.Errorf("Expected a binary message, got %x %v", first, payload)
+	}
+
+	// the client is unregistered with its connection
+	bob.writeFrame(0x88, nil)
+	bob.readFrame(t)
+	for hub.Clients() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestHubStalledWebSocket tests that a peer which stopped reading does not
+// hold up the publisher
+func TestHubStalledWebSocket(t *testing.T) {
+	hub, _ := NewHub(HubConfig{BufferSize: 1, Policy: HubDisconnect})
+	defer hub.Close()
+
+	clients := make(chan *HubClient, 1)
+	app := New(Config{DisableLogger: true})
+	app.Get("/feed", WebSocket(func(ws *WSConn) {
+		client, err := hub.RegisterWS(ws, "")
+		if err != nil {
+			return
+		}
+		defer client.Close()
+		clients <- client
+
+		for {
+			if _, _, err = ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}, WebSocketConfig{WriteTimeout: 3 * time.Second}))
+
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	// the peer never reads
+	if ws := dialWS(t, srv, "/feed"); ws.resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatal("Expected 101")
+	}
+	client := <-clients
+
+	// fill the socket buffers until the writer blocks
+	data := make([]byte, 256<<10)
+	for stalled := false; !stalled; {
+		_ = hub.Broadcast(data)
+
+		stalled = true
+		for deadline := time.Now().Add(100 * time.Millisecond); time.Now().Before(deadline); {
+			if len(client.messages) == 0 {
+				stalled = false
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	start := time.Now()
+	_ = hub.Broadcast(data)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected Broadcast not to wait for the stalled writer, took %s", elapsed)
+	}
+	if hub.Clients() != 0 {
+		t.Error("Expected the stalled client dropped")
+	}
+}
@@ -23,10 +23,6 @@ var fieldReplacer = strings.NewReplacer(
 	"\n", "\\n",
 	"\r", "\\r")
 
-var dataReplacer = strings.NewReplacer(
-	"\n", "\ndata:",
-	"\r", "\\r")
-
 type Event struct {
 	Event string
 	Id    string
@@ -45,6 +41,9 @@ func Encode(writer io.Writer, event Event) error {
 func writeId(w stringWriter, id string) {
 	if len(id) > 0 {
 		w.WriteString("id:")
+		if strings.HasPrefix(id, " ") {
+			w.WriteString(" ")
+		}
 		fieldReplacer.WriteString(w, id)
 		w.WriteString("\n")
 	}
@@ -53,6 +52,9 @@ func writeId(w stringWriter, id string) {
 func writeEvent(w stringWriter, event string) {
 	if len(event) > 0 {
 		w.WriteString("event:")
+		if strings.HasPrefix(event, " ") {
+			w.WriteString(" ")
+		}
 		fieldReplacer.WriteString(w, event)
 		w.WriteString("\n")
 	}
@@ -66,22 +68,54 @@ func writeRetry(w stringWriter, retry uint) {
 	}
 }
 
+// writeData writes data as one "data:" line per line of its text, lines
+// being split on CRLF, LF and CR, followed by the blank line ending the
+// event. Strings, []byte and numbers are written as is, other values as
+// JSON.
 func writeData(w stringWriter, data interface{}) error {
-	w.WriteString("data:")
-	switch kindOfData(data) {
-	case reflect.Struct, reflect.Slice, reflect.Map:
-		err := json.NewEncoder(w).Encode(data)
-		if err != nil {
-			return err
+	text, err := dataText(data)
+	if err != nil {
+		return err
+	}
+
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	for _, line := range strings.Split(text, "\n") {
+		w.WriteString("data:")
+		// the space after the colon is removed by clients
+		if strings.HasPrefix(line, " ") {
+			w.WriteString(" ")
 		}
+		w.WriteString(line)
 		w.WriteString("\n")
-	default:
-		dataReplacer.WriteString(w, fmt.Sprint(data))
-		w.WriteString("\n\n")
 	}
+	w.WriteString("\n")
+
 	return nil
 }
 
+func dataText(data interface{}) (string, error) {
+	switch v := data.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case json.RawMessage:
+		return string(v), nil
+	}
+
+	switch kindOfData(data) {
+	case reflect.Struct, reflect.Slice, reflect.Array, reflect.Map:
+		bs, err := json.Marshal(data)
+		return string(bs), err
+	default:
+		return fmt.Sprint(data), nil
+	}
+}
+
 func (r Event) Render(w http.ResponseWriter) error {
 	r.WriteContentType(w)
 	return Encode(w, r)
@@ -0,0 +1,34 @@
+package sse
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name     string
+		event    Event
+		expected string
+	}{
+		{"string", Event{Event: "e", Id: "1", Retry: 10, Data: "hi"}, "id:1\nevent:e\nretry:10\ndata:hi\n\n"},
+		{"lines", Event{Data: "a\r\nb\rc\n"}, "data:a\ndata:b\ndata:c\ndata:\n\n"},
+		{"leading space", Event{Id: " 1", Data: " a\n  b"}, "id:  1\ndata:  a\ndata:   b\n\n"},
+		{"json", Event{Data: map[string]int{"n": 1}}, "data:{\"n\":1}\n\n"},
+		{"bytes", Event{Data: []byte("raw")}, "data:raw\n\n"},
+		{"number", Event{Data: 42}, "data:42\n\n"},
+		{"nil", Event{Event: "ping"}, "event:ping\ndata:\n\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Encode(&buf, tt.event); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, buf.String())
+			}
+		})
+	}
+}
@@ -34,7 +34,7 @@ func NewLogger() HandlerFunc {
 		var (
 			now   = time.Now()
 			logFn func(msg string, data ...any)
-			ip    = c.IP()
+			ip    = c.IP(true)
 		)
 
 		err := c.Next()
@@ -0,0 +1,282 @@
+package ursa
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// BasicAuthUserKey is the Locals key of the user authenticated by BasicAuth
+	BasicAuthUserKey = "ursa.basicauth.user"
+	// KeyAuthKey is the Locals key of the key validated by KeyAuth
+	KeyAuthKey = "ursa.keyauth.key"
+	// ClientCertAuthKey is the Locals key of the ClientIdentity accepted by ClientCertAuth
+	ClientCertAuthKey = "ursa.clientcert"
+)
+
+var (
+	// ErrMissingCredentials is passed to Unauthorized handlers when the
+	// request carries no credentials.
+	ErrMissingCredentials = errors.New("missing or malformed credentials")
+	// ErrInvalidCredentials is passed to Unauthorized handlers when the
+	// credentials are rejected.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// DefaultUnauthorized responds 401 "Unauthorized". Unauthorized handlers
+// share its signature, so that resp.Resp401 can be plugged in:
+//
+//	Unauthorized: func(c *ursa.Ctx, err error) error {
+//		return resp.Resp401(c, nil, err.Error())
+//	}
+func DefaultUnauthorized(c *Ctx, err error) error {
+	return c.Status(http.StatusUnauthorized).SendString("Unauthorized")
+}
+
+// BasicAuthConfig defines the config for BasicAuth middleware
+type BasicAuthConfig struct {
+	// Users maps user names to passwords, compared in constant time.
+	// Default: nil
+	Users map[string]string
+
+	// Authorizer checks the credentials instead of Users, e.g. against a
+	// database of password hashes.
+	// Default: nil
+	Authorizer func(c *Ctx, user, password string) bool
+
+	// Realm is the realm of the WWW-Authenticate challenge.
+	// Default: "Restricted"
+	Realm string
+
+	// Next defines a function to skip this middleware when returning true.
+	// Default: nil
+	Next func(c *Ctx) bool
+
+	// Unauthorized is called, after the WWW-Authenticate header is set,
+	// when the credentials are missing or invalid.
+	// Default: DefaultUnauthorized
+	Unauthorized func(c *Ctx, err error) error
+}
+
+// DefaultBasicAuthConfig is the default BasicAuth middleware config
+var DefaultBasicAuthConfig = BasicAuthConfig{
+	Realm:        "Restricted",
+	Unauthorized: DefaultUnauthorized,
+}
+
+// NewBasicAuth returns a BasicAuth middleware accepting the given users
+func NewBasicAuth(users map[string]string) HandlerFunc {
+	config := DefaultBasicAuthConfig
+	config.Users = users
+
+	return NewBasicAuthWithConfig(config)
+}
+
+// NewBasicAuthWithConfig returns a BasicAuth middleware with custom config.
+// The authenticated user name is stored in Locals under BasicAuthUserKey.
+func NewBasicAuthWithConfig(config BasicAuthConfig) HandlerFunc {
+	// Set defaults
+	if config.Realm == "" {
+		config.Realm = DefaultBasicAuthConfig.Realm
+	}
+	if config.Unauthorized == nil {
+		config.Unauthorized = DefaultBasicAuthConfig.Unauthorized
+	}
+	if config.Authorizer == nil {
+		users := make(map[string][32]byte, len(config.Users))
+		for user, password := range config.Users {
+			users[user] = sha256.Sum256([]byte(password))
+		}
+
+		config.Authorizer = func(_ *Ctx, user, password string) bool {
+			expected, ok := users[user]
+			// compare hashes, so that the time taken tells nothing
+			// about the password length or the user existence
+			given := sha256.Sum256([]byte(password))
+			return subtle.ConstantTimeCompare(given[:], expected[:]) == 1 && ok
+		}
+	}
+
+	challenge := "Basic realm=" + strconv.Quote(config.Realm) + `, charset="UTF-8"`
+
+	return func(c *Ctx) error {
+		if config.Next != nil && config.Next(c) {
+			return c.Next()
+		}
+
+		user, password, ok := c.Request.BasicAuth()
+		if !ok {
+			c.Set("WWW-Authenticate", challenge)
+			return config.Unauthorized(c, ErrMissingCredentials)
+		}
+
+		if !config.Authorizer(c, user, password) {
+			c.Set("WWW-Authenticate", challenge)
+			return config.Unauthorized(c, ErrInvalidCredentials)
+		}
+
+		c.Locals(BasicAuthUserKey, user)
+
+		return c.Next()
+	}
+}
+
+// KeyAuthConfig defines the config for KeyAuth middleware
+type KeyAuthConfig struct {
+	// KeyLookup lists where requests carry the key, as comma-separated
+	// "<source>:<name>" pairs tried in order, the sources being "header",
+	// "query", "form" and "cookie".
+	// Default: "header:Authorization"
+	KeyLookup string
+
+	// AuthScheme is the scheme preceding keys read from headers.
+	// Default: "Bearer" with the default KeyLookup, "" otherwise
+	AuthScheme string
+
+	// Validator checks the key. Returning an error rejects the request
+	// with it, otherwise ErrInvalidCredentials is used. Compare keys with
+	// crypto/subtle.ConstantTimeCompare.
+	// Required.
+	Validator func(c *Ctx, key string) (bool, error)
+
+	// Next defines a function to skip this middleware when returning true.
+	// Default: nil
+	Next func(c *Ctx) bool
+
+	// Unauthorized is called when the key is missing or invalid.
+	// Default: DefaultUnauthorized
+	Unauthorized func(c *Ctx, err error) error
+}
+
+// DefaultKeyAuthConfig is the default KeyAuth middleware config
+var DefaultKeyAuthConfig = KeyAuthConfig{
+	KeyLookup:    "header:Authorization",
+	AuthScheme:   "Bearer",
+	Unauthorized: DefaultUnauthorized,
+}
+
+// NewKeyAuth returns a KeyAuth middleware reading bearer keys from the
+// Authorization header
+func NewKeyAuth(validator func(c *Ctx, key string) (bool, error)) HandlerFunc {
+	config := DefaultKeyAuthConfig
+	config.Validator = validator
+
+	return NewKeyAuthWithConfig(config)
+}
+
+// NewKeyAuthWithConfig returns a KeyAuth middleware with custom config.
+// The validated key is stored in Locals under KeyAuthKey.
+func NewKeyAuthWithConfig(config KeyAuthConfig) HandlerFunc {
+	elsePanic(config.Validator != nil, "key auth: Validator is required")
+
+	// Set defaults
+	if config.KeyLookup == "" {
+		config.KeyLookup = DefaultKeyAuthConfig.KeyLookup
+		if config.AuthScheme == "" {
+			config.AuthScheme = DefaultKeyAuthConfig.AuthScheme
+		}
+	}
+	if config.Unauthorized == nil {
+		config.Unauthorized = DefaultKeyAuthConfig.Unauthorized
+	}
+
+	var (
+		extractors = parseKeyLookup(config.KeyLookup, config.AuthScheme)
+		challenge  = bearerChallenge(config.AuthScheme, config.KeyLookup)
+	)
+
+	return func(c *Ctx) error {
+		if config.Next != nil && config.Next(c) {
+			return c.Next()
+		}
+
+		key := lookupKey(c, extractors)
+		if key == "" {
+			if challenge != "" {
+				c.Set("WWW-Authenticate", challenge)
+			}
+			return config.Unauthorized(c, ErrMissingCredentials)
+		}
+
+		valid, err := config.Validator(c, key)
+		if !valid || err != nil {
+			if err == nil {
+				err = ErrInvalidCredentials
+			}
+			if challenge != "" {
+				c.Set("WWW-Authenticate", challenge+`, error="invalid_token"`)
+			}
+			return config.Unauthorized(c, err)
+		}
+
+		c.Locals(KeyAuthKey, key)
+
+		return c.Next()
+	}
+}
+
+// bearerChallenge returns the RFC 6750 challenge when keys are read from
+// the Authorization header with the Bearer scheme, "" otherwise
+func bearerChallenge(scheme, lookup string) string {
+	if !strings.EqualFold(scheme, "Bearer") || !strings.Contains(strings.ToLower(lookup), "header:authorization") {
+		return ""
+	}
+
+	return "Bearer"
+}
+
+// ClientCertAuthConfig defines the config for ClientCertAuth middleware
+type ClientCertAuthConfig struct {
+	// Authorizer checks the identity of the verified client certificate,
+	// e.g. its SPIFFE ID.
+	// Default: nil (any verified certificate)
+	Authorizer func(c *Ctx, id *ClientIdentity) bool
+
+	// Next defines a function to skip this middleware when returning true.
+	// Default: nil
+	Next func(c *Ctx) bool
+
+	// Unauthorized is called when the certificate is missing or rejected.
+	// Default: DefaultUnauthorized
+	Unauthorized func(c *Ctx, err error) error
+}
+
+// NewClientCertAuth returns a ClientCertAuth middleware accepting the
+// client certificates for which authorizer returns true
+func NewClientCertAuth(authorizer func(c *Ctx, id *ClientIdentity) bool) HandlerFunc {
+	return NewClientCertAuthWithConfig(ClientCertAuthConfig{Authorizer: authorizer})
+}
+
+// NewClientCertAuthWithConfig returns a ClientCertAuth middleware with
+// custom config. It requires a client certificate verified during the TLS
+// handshake, see TLSFiles.ClientCAFile, and stores its identity in Locals
+// under ClientCertAuthKey.
+func NewClientCertAuthWithConfig(config ClientCertAuthConfig) HandlerFunc {
+	// Set defaults
+	if config.Unauthorized == nil {
+		config.Unauthorized = DefaultUnauthorized
+	}
+
+	return func(c *Ctx) error {
+		if config.Next != nil && config.Next(c) {
+			return c.Next()
+		}
+
+		id := c.ClientCert()
+		if id == nil {
+			return config.Unauthorized(c, ErrMissingCredentials)
+		}
+
+		if config.Authorizer != nil && !config.Authorizer(c, id) {
+			return config.Unauthorized(c, ErrInvalidCredentials)
+		}
+
+		c.Locals(ClientCertAuthKey, id)
+
+		return c.Next()
+	}
+}
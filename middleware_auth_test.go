@@ -0,0 +1,115 @@
+package ursa
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestBasicAuth tests credentials checking and the challenge header
+func TestBasicAuth(t *testing.T) {
+	app := New()
+	app.Use(NewBasicAuth(map[string]string{"admin": "s3cret"}))
+	app.Get("/", func(c *Ctx) error {
+		return c.SendString(c.Locals(BasicAuthUserKey).(string))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("Expected 401 with challenge, got %d '%s'", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+
+	for _, creds := range [][2]string{{"admin", "wrong"}, {"nobody", "s3cret"}} {
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(creds[0], creds[1])
+		w = httptest.NewRecorder()
+		app.ServeHTTP(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for %s:%s, got %d", creds[0], creds[1], w.Code)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.SetBasicAuth("admin", "s3cret")
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || w.Body.String() != "admin" {
+		t.Errorf("Expected 200 'admin', got %d '%s'", w.Code, w.Body.String())
+	}
+}
+
+// TestKeyAuth tests key lookup, validation and custom unauthorized handlers
+func TestKeyAuth(t *testing.T) {
+	errRevoked := errors.New("revoked")
+
+	app := New()
+	app.Use(NewKeyAuthWithConfig(KeyAuthConfig{
+		KeyLookup: "header:X-API-Key,query:api_key",
+		Validator: func(c *Ctx, key string) (bool, error) {
+			if key == "old" {
+				return false, errRevoked
+			}
+			return subtle.ConstantTimeCompare([]byte(key), []byte("valid")) == 1, nil
+		},
+		Unauthorized: func(c *Ctx, err error) error {
+			return c.Status(http.StatusUnauthorized).SendString(err.Error())
+		},
+	}))
+	app.Get("/", func(c *Ctx) error {
+		return c.SendString("ok")
+	})
+
+	cases := []struct {
+		path, header string
+		code         int
+		body         string
+	}{
+		{"/", "", http.StatusUnauthorized, ErrMissingCredentials.Error()},
+		{"/", "invalid", http.StatusUnauthorized, ErrInvalidCredentials.Error()},
+		{"/", "old", http.StatusUnauthorized, "revoked"},
+		{"/", "valid", http.StatusOK, "ok"},
+		{"/?api_key=valid", "", http.StatusOK, "ok"},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		if tc.header != "" {
+			req.Header.Set("X-API-Key", tc.header)
+		}
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, req)
+
+		if w.Code != tc.code || w.Body.String() != tc.body {
+			t.Errorf("%s %s: expected %d '%s', got %d '%s'", tc.path, tc.header, tc.code, tc.body, w.Code, w.Body.String())
+		}
+	}
+
+	app = New()
+	app.Use(NewKeyAuth(func(c *Ctx, key string) (bool, error) { return key == "valid", nil }))
+	app.Get("/", func(c *Ctx) error { return c.SendString("ok") })
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer valid")
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200 with bearer key, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "valid")
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != "Bearer" {
+		t.Errorf("Expected 401 with Bearer challenge, got %d '%s'", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+}
@@ -0,0 +1,426 @@
+package ursa
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Route metadata keys read by the Authz middleware, their values are a
+// string or a []string:
+//
+//	app.WithMeta(ursa.MetaPermissions, "orders:write").Post("/orders", create)
+const (
+	// MetaRoles requires any of the roles, directly or through inheritance
+	MetaRoles = "ursa.authz.roles"
+	// MetaPermissions requires all the permissions
+	MetaPermissions = "ursa.authz.permissions"
+	// MetaPolicies requires all the named predicates of the Policy to pass
+	MetaPolicies = "ursa.authz.policies"
+	// MetaPublic, set to true, exempts a route when DefaultDeny is enabled
+	MetaPublic = "ursa.authz.public"
+)
+
+// ErrForbidden is wrapped by the errors passed to Forbidden handlers
+var ErrForbidden = errors.New("forbidden")
+
+// Policy holds role based and attribute based access rules. Roles are
+// granted permissions and may inherit other roles; a permission ending
+// with "*" matches any permission with that prefix, e.g. "orders:*".
+// Predicates are named functions over the request, e.g. an ownership
+// check. A Policy is safe for concurrent use and may be changed at runtime.
+type Policy struct {
+	lock       sync.RWMutex
+	grants     map[string][]string
+	parents    map[string][]string
+	predicates map[string]func(c *Ctx) bool
+}
+
+// NewPolicy returns an empty Policy
+func NewPolicy() *Policy {
+	return &Policy{
+		grants:     make(map[string][]string),
+		parents:    make(map[string][]string),
+		predicates: make(map[string]func(c *Ctx) bool),
+	}
+}
+
+// Grant gives permissions to role
+func (p *Policy) Grant(role string, permissions ...string) *Policy {
+	p.lock.Lock()
+	p.grants[role] = append(p.grants[role], permissions...)
+	p.lock.Unlock()
+
+	return p
+}
+
+// Inherit makes role inherit the roles and permissions of parents, e.g.
+// Inherit("admin", "editor") lets admins do all that editors do.
+func (p *Policy) Inherit(role string, parents ...string) *Policy {
+	p.lock.Lock()
+	p.parents[role] = append(p.parents[role], parents...)
+	p.lock.Unlock()
+
+	return p
+}
+
+// Predicate registers a named predicate for MetaPolicies
+func (p *Policy) Predicate(name string, fn func(c *Ctx) bool) *Policy {
+	p.lock.Lock()
+	p.predicates[name] = fn
+	p.lock.Unlock()
+
+	return p
+}
+
+// Roles returns the sorted roles held through roles, inherited ones included
+func (p *Policy) Roles(roles ...string) []string {
+	p.lock.RLock()
+	expanded := p.expand(roles)
+	p.lock.RUnlock()
+
+	result := make([]string, 0, len(expanded))
+	for role := range expanded {
+		result = append(result, role)
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+// HasRole reports whether roles hold role, directly or through inheritance
+func (p *Policy) HasRole(roles []string, role string) bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	_, ok := p.expand(roles)[role]
+	return ok
+}
+
+// Can reports whether roles are granted permission
+func (p *Policy) Can(roles []string, permission string) bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return p.can(p.expand(roles), permission)
+}
+
+// expand returns the closure of roles over inheritance, cycles are ignored
+func (p *Policy) expand(roles []string) map[string]struct{} {
+	expanded := make(map[string]struct{}, len(roles))
+	stack := append([]string(nil), roles...)
+
+	for len(stack) > 0 {
+		role := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if _, ok := expanded[role]; ok {
+			continue
+		}
+		expanded[role] = struct{}{}
+		stack = append(stack, p.parents[role]...)
+	}
+
+	return expanded
+}
+
+func (p *Policy) can(expanded map[string]struct{}, permission string) bool {
+	for role := range expanded {
+		for _, granted := range p.grants[role] {
+			if granted == permission {
+				return true
+			}
+			if prefix, ok := strings.CutSuffix(granted, "*"); ok && strings.HasPrefix(permission, prefix) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// AuthzRequirement is the access requirement of a route
+type AuthzRequirement struct {
+	Roles       []string // any of
+	Permissions []string // all of
+	Policies    []string // all of
+	Public      bool
+}
+
+// Empty reports whether the requirement has no rule
+func (r AuthzRequirement) Empty() bool {
+	return len(r.Roles) == 0 && len(r.Permissions) == 0 && len(r.Policies) == 0
+}
+
+// RouteRequirement returns the requirement declared in route metadata
+func RouteRequirement(meta Map) AuthzRequirement {
+	public, _ := meta[MetaPublic].(bool)
+
+	return AuthzRequirement{
+		Roles:       metaStrings(meta[MetaRoles]),
+		Permissions: metaStrings(meta[MetaPermissions]),
+		Policies:    metaStrings(meta[MetaPolicies]),
+		Public:      public,
+	}
+}
+
+func metaStrings(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	}
+
+	return nil
+}
+
+// Check returns nil when roles, and the request for predicates, meet the
+// requirement, or an error wrapping ErrForbidden.
+func (p *Policy) Check(c *Ctx, roles []string, req AuthzRequirement) error {
+	p.lock.RLock()
+	expanded := p.expand(roles)
+
+	var err error
+
+	if len(req.Roles) > 0 {
+		err = fmt.Errorf("%w: requires one of roles %s", ErrForbidden, strings.Join(req.Roles, ", "))
+		for _, role := range req.Roles {
+			if _, ok := expanded[role]; ok {
+				err = nil
+				break
+			}
+		}
+	}
+
+	for _, permission := range req.Permissions {
+		if err == nil && !p.can(expanded, permission) {
+			err = fmt.Errorf("%w: requires permission %s", ErrForbidden, permission)
+		}
+	}
+
+	predicates := make([]func(c *Ctx) bool, len(req.Policies))
+	for i, name := range req.Policies {
+		predicates[i] = p.predicates[name]
+	}
+	p.lock.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	// predicates run unlocked, they may be slow or use the policy
+	for i, fn := range predicates {
+		if fn == nil || !fn(c) {
+			return fmt.Errorf("%w: policy %s denied", ErrForbidden, req.Policies[i])
+		}
+	}
+
+	return nil
+}
+
+// AuthzRoute is an entry of the Policy.Report
+type AuthzRoute struct {
+	Method      string   `json:"method"`
+	Path        string   `json:"path"`
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	Policies    []string `json:"policies,omitempty"`
+	// Allowed lists the roles of the policy meeting the role and
+	// permission requirements, predicates aside.
+	Allowed []string `json:"allowed,omitempty"`
+	// Unprotected is set for routes without requirement, denied by the
+	// Authz middleware with DefaultDeny unless Public.
+	Unprotected bool `json:"unprotected,omitempty"`
+	Public      bool `json:"public,omitempty"`
+}
+
+// Report returns the access requirements of routes, as returned by
+// App.GetRoutes, sorted by path and method, for audits.
+func (p *Policy) Report(routes []RouteInfo) []AuthzRoute {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	known := make(map[string]struct{})
+	for role, parents := range p.parents {
+		known[role] = struct{}{}
+		for _, parent := range parents {
+			known[parent] = struct{}{}
+		}
+	}
+	for role := range p.grants {
+		known[role] = struct{}{}
+	}
+
+	report := make([]AuthzRoute, 0, len(routes))
+
+	for _, route := range routes {
+		req := RouteRequirement(route.Meta)
+		entry := AuthzRoute{
+			Method:      route.Method,
+			Path:        route.Path,
+			Roles:       req.Roles,
+			Permissions: req.Permissions,
+			Policies:    req.Policies,
+			Unprotected: req.Empty(),
+			Public:      req.Public,
+		}
+
+		if len(req.Roles) > 0 || len(req.Permissions) > 0 {
+			for role := range known {
+				if p.allows(role, req) {
+					entry.Allowed = append(entry.Allowed, role)
+				}
+			}
+			for _, role := range req.Roles {
+				if _, ok := known[role]; !ok && p.allows(role, req) {
+					entry.Allowed = append(entry.Allowed, role)
+				}
+			}
+			sort.Strings(entry.Allowed)
+		}
+
+		report = append(report, entry)
+	}
+
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Path != report[j].Path {
+			return report[i].Path < report[j].Path
+		}
+		return report[i].Method < report[j].Method
+	})
+
+	return report
+}
+
+func (p *Policy) allows(role string, req AuthzRequirement) bool {
+	expanded := p.expand([]string{role})
+
+	if len(req.Roles) > 0 {
+		found := false
+		for _, r := range req.Roles {
+			if _, found = expanded[r]; found {
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	for _, permission := range req.Permissions {
+		if !p.can(expanded, permission) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// AuthzConfig defines the config for Authz middleware
+type AuthzConfig struct {
+	// Policy holds the access rules.
+	// Required.
+	Policy *Policy
+
+	// Roles returns the roles of the request user.
+	// Default: the "roles" (list) or "role" (string) claim of the
+	// JWTClaims stored under JWTClaimsKey
+	Roles func(c *Ctx) []string
+
+	// DefaultDeny denies the routes declaring no requirement, unless they
+	// set MetaPublic. Requests matching no route are not denied.
+	// Default: false
+	DefaultDeny bool
+
+	// Next defines a function to skip this middleware when returning true.
+	// Default: nil
+	Next func(c *Ctx) bool
+
+	// Forbidden is called when access is denied, with an error wrapping
+	// ErrForbidden.
+	// Default: responds 403 "Forbidden"
+	Forbidden func(c *Ctx, err error) error
+}
+
+// DefaultAuthzConfig is the default Authz middleware config
+var DefaultAuthzConfig = AuthzConfig{
+	Roles: func(c *Ctx) []string {
+		claims, _ := c.Locals(JWTClaimsKey).(JWTClaims)
+
+		switch roles := claims["roles"].(type) {
+		case []any:
+			result := make([]string, 0, len(roles))
+			for _, role := range roles {
+				if s, ok := role.(string); ok {
+					result = append(result, s)
+				}
+			}
+			return result
+		case string:
+			return strings.Fields(roles)
+		}
+
+		if role, ok := claims["role"].(string); ok {
+			return []string{role}
+		}
+
+		return nil
+	},
+	Forbidden: func(c *Ctx, err error) error {
+		return c.Status(http.StatusForbidden).SendString("Forbidden")
+	},
+}
+
+// NewAuthz returns an Authz middleware enforcing policy with default config
+func NewAuthz(policy *Policy) HandlerFunc {
+	config := DefaultAuthzConfig
+	config.Policy = policy
+
+	return NewAuthzWithConfig(config)
+}
+
+// NewAuthzWithConfig returns an Authz middleware with custom config. It
+// enforces the requirements declared in the metadata of the matched route,
+// see MetaRoles, MetaPermissions and MetaPolicies, and must run after the
+// authentication middleware.
+func NewAuthzWithConfig(config AuthzConfig) HandlerFunc {
+	elsePanic(config.Policy != nil, "authz: Policy is required")
+
+	// Set defaults
+	if config.Roles == nil {
+		config.Roles = DefaultAuthzConfig.Roles
+	}
+	if config.Forbidden == nil {
+		config.Forbidden = DefaultAuthzConfig.Forbidden
+	}
+
+	return func(c *Ctx) error {
+		if config.Next != nil && config.Next(c) {
+			return c.Next()
+		}
+
+		// unmatched requests are left to the 404 and 405 handlers
+		if c.fullPath == "" {
+			return c.Next()
+		}
+
+		req := RouteRequirement(c.app.getRouteMeta(c.method, c.fullPath))
+
+		if req.Empty() {
+			if config.DefaultDeny && !req.Public {
+				return config.Forbidden(c, fmt.Errorf("%w: route declares no requirement", ErrForbidden))
+			}
+			return c.Next()
+		}
+
+		if err := config.Policy.Check(c, config.Roles(c), req); err != nil {
+			return config.Forbidden(c, err)
+		}
+
+		return c.Next()
+	}
+}
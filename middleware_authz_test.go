@@ -0,0 +1,141 @@
+package ursa
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newAuthzPolicy() *Policy {
+	return NewPolicy().
+		Grant("viewer", "orders:read").
+		Grant("editor", "orders:write").
+		Grant("admin", "users:*").
+		Inherit("editor", "viewer").
+		Inherit("admin", "editor").
+		Predicate("owner", func(c *Ctx) bool {
+			return c.Param("user") == c.Get("X-User")
+		})
+}
+
+// TestPolicy tests role inheritance and permission wildcards
+func TestPolicy(t *testing.T) {
+	p := newAuthzPolicy()
+
+	if got := p.Roles("admin"); !reflect.DeepEqual(got, []string{"admin", "editor", "viewer"}) {
+		t.Errorf("Expected admin to inherit editor and viewer, got %v", got)
+	}
+
+	if !p.HasRole([]string{"editor"}, "viewer") || p.HasRole([]string{"viewer"}, "editor") {
+		t.Error("Expected editor to inherit viewer only")
+	}
+
+	if !p.Can([]string{"admin"}, "orders:read") || !p.Can([]string{"admin"}, "users:delete") {
+		t.Error("Expected admin to read orders and delete users")
+	}
+
+	if p.Can([]string{"editor"}, "users:delete") || p.Can(nil, "orders:read") {
+		t.Error("Expected editor and anonymous not to delete users")
+	}
+
+	// cycles must not hang
+	p.Inherit("viewer", "admin")
+	if !p.Can([]string{"viewer"}, "users:list") {
+		t.Error("Expected cyclic inheritance to be resolved")
+	}
+}
+
+// TestAuthzMiddleware tests route requirements declared in metadata
+func TestAuthzMiddleware(t *testing.T) {
+	app := New()
+	app.Use(NewAuthzWithConfig(AuthzConfig{
+		Policy: newAuthzPolicy(),
+		Roles: func(c *Ctx) []string {
+			return strings.Fields(c.Get("X-Roles"))
+		},
+		DefaultDeny: true,
+		Forbidden: func(c *Ctx, err error) error {
+			if !errors.Is(err, ErrForbidden) {
+				t.Errorf("Expected ErrForbidden, got %v", err)
+			}
+			return c.Status(http.StatusForbidden).SendString(err.Error())
+		},
+	}))
+
+	ok := func(c *Ctx) error { return c.SendString("ok") }
+	app.WithMeta(MetaPublic, true).Get("/health", ok)
+	app.Get("/forgotten", ok)
+	app.WithMeta(MetaPermissions, "orders:read").Get("/orders", ok)
+	app.WithMeta(MetaPermissions, []string{"orders:read", "orders:write"}).Post("/orders", ok)
+	app.WithMeta(MetaRoles, "admin").Get("/admin", ok)
+	app.WithMeta(MetaRoles, "viewer").WithMeta(MetaPolicies, "owner").Get("/users/:user", ok)
+
+	cases := []struct {
+		method, path, roles, user string
+		code                      int
+	}{
+		{http.MethodGet, "/health", "", "", http.StatusOK},
+		{http.MethodGet, "/forgotten", "admin", "", http.StatusForbidden},
+		{http.MethodGet, "/missing", "", "", http.StatusNotFound},
+		{http.MethodGet, "/orders", "viewer", "", http.StatusOK},
+		{http.MethodGet, "/orders", "", "", http.StatusForbidden},
+		{http.MethodPost, "/orders", "viewer", "", http.StatusForbidden},
+		{http.MethodPost, "/orders", "editor", "", http.StatusOK},
+		{http.MethodGet, "/admin", "editor", "", http.StatusForbidden},
+		{http.MethodGet, "/admin", "viewer admin", "", http.StatusOK},
+		{http.MethodGet, "/users/alice", "viewer", "alice", http.StatusOK},
+		{http.MethodGet, "/users/alice", "admin", "bob", http.StatusForbidden},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		req.Header.Set("X-Roles", tc.roles)
+		req.Header.Set("X-User", tc.user)
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, req)
+
+		if w.Code != tc.code {
+			t.Errorf("%s %s as '%s': expected %d, got %d '%s'", tc.method, tc.path, tc.roles, tc.code, w.Code, w.Body.String())
+		}
+	}
+
+	report := newAuthzPolicy().Report(app.GetRoutes())
+	byRoute := make(map[string]AuthzRoute)
+	for _, entry := range report {
+		byRoute[entry.Method+" "+entry.Path] = entry
+	}
+
+	if got := byRoute["POST /orders"].Allowed; !reflect.DeepEqual(got, []string{"admin", "editor"}) {
+		t.Errorf("Expected admin and editor allowed to POST /orders, got %v", got)
+	}
+	if !byRoute["GET /forgotten"].Unprotected || !byRoute["GET /health"].Public {
+		t.Errorf("Expected unprotected and public routes to be reported, got %+v", report)
+	}
+}
+
+// TestAuthzJWTRoles tests the default roles lookup from JWT claims
+func TestAuthzJWTRoles(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+
+	app := New()
+	app.Use(NewJWT(secret), NewAuthz(newAuthzPolicy()))
+	app.WithMeta(MetaPermissions, "orders:write").Post("/orders", func(c *Ctx) error {
+		return c.SendString("ok")
+	})
+
+	for roles, code := range map[string]int{"editor": http.StatusOK, "viewer": http.StatusForbidden} {
+		token, _ := SignJWT(JWTAlgHS256, secret, Map{"sub": "alice", "roles": []string{roles}})
+
+		req := httptest.NewRequest(http.MethodPost, "/orders", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, req)
+
+		if w.Code != code {
+			t.Errorf("%s: expected %d, got %d", roles, code, w.Code)
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package ursa
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// CacheConfig defines the config for Cache middleware
+type CacheConfig struct {
+	// Expiration is the time to live of cached responses which do not
+	// carry a max-age or s-maxage Cache-Control directive.
+	// Default: 1 minute
+	Expiration time.Duration
+
+	// MaxExpiration caps the time to live taken from the response
+	// Cache-Control header.
+	// Default: 1 hour
+	MaxExpiration time.Duration
+
+	// KeyGenerator returns the base cache key of a request. Cache.Invalidate
+	// takes the same key.
+	// Default: method and request URI, e.g. "GET /items?page=2"
+	KeyGenerator func(c *Ctx) string
+
+	// VaryHeaders lists request headers whose values are part of the cache
+	// key, e.g. "Accept-Language".
+	// Default: []string{"Accept-Encoding"}
+	VaryHeaders []string
+
+	// Storage keeps the responses and the invalidation markers. It must not
+	// evict markers before they expire, the default LRU storage keeps its
+	// markers apart for that reason.
+	// Default: NewLRUStorage(1024)
+	Storage Storage
+
+	// CacheHeader is the response header reporting HIT, MISS or BYPASS.
+	// Default: "X-Cache"
+	CacheHeader string
+
+	// DisableCacheHeader disables the CacheHeader response header.
+	// Default: false
+	DisableCacheHeader bool
+
+	// Next defines a function to skip this middleware when returning true.
+	// Default: nil
+	Next func(c *Ctx) bool
+}
+
+// DefaultCacheConfig is the default Cache middleware config
+var DefaultCacheConfig = CacheConfig{
+	Expiration:    time.Minute,
+	MaxExpiration: time.Hour,
+	KeyGenerator: func(c *Ctx) string {
+		return c.Request.Method + " " + c.Request.URL.RequestURI()
+	},
+	VaryHeaders: []string{"Accept-Encoding"},
+	CacheHeader: "X-Cache",
+}
+
+// Cache is a server-side response cache for GET requests. Use its Handle
+// method as middleware:
+//
+//	cache := ursa.NewCache(ursa.CacheConfig{Expiration: 5 * time.Minute})
+//	app.Get("/items", cache.Handle, listItems)
+//
+// Only 200 responses are stored, unless the request or the response
+// Cache-Control forbids it (no-store, private, no-cache) or the response
+// sets a cookie. Concurrent misses of the same key are coalesced into a
+// single handler call.
+type Cache struct {
+	config  CacheConfig
+	markers Storage
+	group   singleflight.Group
+}
+
+const cacheTagsKey = "ursa.cache.tags"
+
+type cacheEntry struct {
+	Status  int         `json:"status"`
+	Header  http.Header `json:"header"`
+	Body    []byte      `json:"body"`
+	Created int64       `json:"created"`
+	Expire  int64       `json:"expire"`
+	Tags    []string    `json:"tags,omitempty"`
+}
+
+// NewCache returns a Cache with custom config
+func NewCache(config CacheConfig) *Cache {
+	// Set defaults
+	if config.Expiration <= 0 {
+		config.Expiration = DefaultCacheConfig.Expiration
+	}
+	if config.MaxExpiration <= 0 {
+		config.MaxExpiration = DefaultCacheConfig.MaxExpiration
+	}
+	if config.MaxExpiration < config.Expiration {
+		config.MaxExpiration = config.Expiration
+	}
+	if config.KeyGenerator == nil {
+		config.KeyGenerator = DefaultCacheConfig.KeyGenerator
+	}
+	if config.VaryHeaders == nil {
+		config.VaryHeaders = DefaultCacheConfig.VaryHeaders
+	}
+	if config.CacheHeader == "" {
+		config.CacheHeader = DefaultCacheConfig.CacheHeader
+	}
+
+	cache := &Cache{config: config, markers: config.Storage}
+	if config.Storage == nil {
+		cache.config.Storage = NewLRUStorage(1024)
+		cache.markers = NewMemoryStorage()
+	}
+
+	return cache
+}
+
+// NewCacheHandler returns a Cache middleware with default config
+func NewCacheHandler() HandlerFunc {
+	return NewCache(DefaultCacheConfig).Handle
+}
+
+// Tag attaches tags to the response being cached, so that it can later be
+// dropped with InvalidateTag.
+func (ch *Cache) Tag(c *Ctx, tags ...string) {
+	existing, _ := c.Locals(cacheTagsKey).([]string)
+	c.Locals(cacheTagsKey, append(existing, tags...))
+}
+
+// Invalidate drops the cached responses of a base key, as returned by
+// KeyGenerator, for all the VaryHeaders values.
+func (ch *Cache) Invalidate(key string) error {
+	return ch.markers.Set("cache:marker:key:"+key, strconv.AppendInt(nil, time.Now().UnixNano(), 10), ch.config.MaxExpiration)
+}
+
+// InvalidateTag drops the cached responses tagged with tag.
+func (ch *Cache) InvalidateTag(tag string) error {
+	return ch.markers.Set("cache:marker:tag:"+tag, strconv.AppendInt(nil, time.Now().UnixNano(), 10), ch.config.MaxExpiration)
+}
+
+// Handle is the Cache middleware
+func (ch *Cache) Handle(c *Ctx) error {
+	config := &ch.config
+
+	if config.Next != nil && config.Next(c) {
+		return c.Next()
+	}
+
+	if c.Request.Method != http.MethodGet {
+		return c.Next()
+	}
+
+	reqCC := parseCacheControl(c.Get("Cache-Control"))
+	if _, ok := reqCC["no-store"]; ok {
+		ch.setStatusHeader(c, "BYPASS")
+		return c.Next()
+	}
+
+	var (
+		baseKey = config.KeyGenerator(c)
+		key     = ch.storageKey(c, baseKey)
+	)
+
+	if _, noCache := reqCC["no-cache"]; !noCache {
+		entry, err := ch.load(key, baseKey)
+		if err != nil {
+			return err
+		}
+
+		if entry != nil {
+			age := time.Duration(time.Now().UnixNano() - entry.Created)
+			if maxAge, ok := reqCC["max-age"]; !ok || age <= parseSeconds(maxAge) {
+				ch.setStatusHeader(c, "HIT")
+				return ch.send(c, entry, age)
+			}
+		}
+	}
+
+	leader := false
+	v, err, _ := ch.group.Do(key, func() (any, error) {
+		leader = true
+		return ch.fill(c, key, baseKey)
+	})
+
+	if leader {
+		return err
+	}
+
+	// followers reuse the leader response only when it was cacheable,
+	// otherwise it may be private to the leader's client
+	if entry, ok := v.(*cacheEntry); ok && err == nil && entry != nil {
+		ch.setStatusHeader(c, "HIT")
+		return ch.send(c, entry, time.Duration(time.Now().UnixNano()-entry.Created))
+	}
+
+	ch.setStatusHeader(c, "MISS")
+	return c.Next()
+}
+
+// fill runs the handler chain, sends its response and stores it when
+// cacheable. It returns the stored entry, or nil.
+func (ch *Cache) fill(c *Ctx, key, baseKey string) (*cacheEntry, error) {
+	ch.setStatusHeader(c, "MISS")
+
+	bw := newBufferWriter(c.Writer)
+	c.Writer = bw
+	defer func() {
+		c.Writer = bw.ResponseWriter
+	}()
+
+	// taken before the handler runs, so that an invalidation made while
+	// it runs is newer than the entry
+	created := time.Now().UnixNano()
+
+	err := c.Next()
+	if err != nil || bw.passthrough {
+		_ = bw.send(true)
+		return nil, err
+	}
+
+	entry, ttl := ch.cacheable(c, bw, created)
+	_ = bw.send(true)
+
+	if entry == nil {
+		return nil, nil
+	}
+
+	bs, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = ch.config.Storage.Set(key, bs, ttl); err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+func (ch *Cache) cacheable(c *Ctx, bw *bufferWriter, created int64) (*cacheEntry, time.Duration) {
+	if bw.status != http.StatusOK {
+		return nil, 0
+	}
+
+	h := bw.Header()
+	if h.Get("Set-Cookie") != "" {
+		return nil, 0
+	}
+
+	cc := parseCacheControl(h.Get("Cache-Control"))
+	for _, directive := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := cc[directive]; ok {
+			return nil, 0
+		}
+	}
+
+	ttl := ch.config.Expiration
+	if v, ok := cc["s-maxage"]; ok {
+		ttl = parseSeconds(v)
+	} else if v, ok = cc["max-age"]; ok {
+		ttl = parseSeconds(v)
+	}
+
+	if ttl <= 0 {
+		return nil, 0
+	}
+	if ttl > ch.config.MaxExpiration {
+		ttl = ch.config.MaxExpiration
+	}
+
+	header := h.Clone()
+	for _, k := range []string{TraceKey, "Date", "Connection", "Keep-Alive", "Transfer-Encoding"} {
+		header.Del(k)
+	}
+	header.Del(ch.config.CacheHeader)
+
+	tags, _ := c.Locals(cacheTagsKey).([]string)
+
+	return &cacheEntry{
+		Status:  bw.status,
+		Header:  header,
+		Body:    append([]byte(nil), bw.Body()...),
+		Created: created,
+		Expire:  created + int64(ttl),
+		Tags:    tags,
+	}, ttl
+}
+
+// load returns the stored entry of key, or nil when it is missing,
+// expired or invalidated.
+func (ch *Cache) load(key, baseKey string) (*cacheEntry, error) {
+	bs, err := ch.config.Storage.Get(key)
+	if err != nil || bs == nil {
+		return nil, err
+	}
+
+	entry := new(cacheEntry)
+	if err = json.Unmarshal(bs, entry); err != nil {
+		return nil, nil
+	}
+
+	if entry.Expire <= time.Now().UnixNano() {
+		return nil, nil
+	}
+
+	markers := make([]string, 0, len(entry.Tags)+1)
+	markers = append(markers, "cache:marker:key:"+baseKey)
+	for _, tag := range entry.Tags {
+		markers = append(markers, "cache:marker:tag:"+tag)
+	}
+
+	for _, marker := range markers {
+		v, err := ch.markers.Get(marker)
+		if err != nil {
+			return nil, err
+		}
+
+		if at, _ := strconv.ParseInt(string(v), 10, 64); at >= entry.Created {
+			_ = ch.config.Storage.Delete(key)
+			return nil, nil
+		}
+	}
+
+	return entry, nil
+}
+
+func (ch *Cache) send(c *Ctx, entry *cacheEntry, age time.Duration) error {
+	h := c.Writer.Header()
+	for k, vv := range entry.Header {
+		h[k] = vv
+	}
+	h.Set("Age", strconv.FormatInt(int64(age/time.Second), 10))
+
+	_, err := c.Status(entry.Status).Write(entry.Body)
+	return err
+}
+
+func (ch *Cache) storageKey(c *Ctx, baseKey string) string {
+	var sb strings.Builder
+
+	sb.WriteString("cache:")
+	sb.WriteString(baseKey)
+	for _, name := range ch.config.VaryHeaders {
+		sb.WriteString("\x00")
+		sb.WriteString(c.Get(name))
+	}
+
+	return sb.String()
+}
+
+func (ch *Cache) setStatusHeader(c *Ctx, status string) {
+	if !ch.config.DisableCacheHeader {
+		c.Set(ch.config.CacheHeader, status)
+	}
+}
+
+// parseCacheControl parses a Cache-Control header into its lowercase
+// directives and their (unquoted) values.
+func parseCacheControl(header string) map[string]string {
+	directives := make(map[string]string)
+
+	for _, part := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if name == "" {
+			continue
+		}
+
+		directives[strings.ToLower(name)] = strings.Trim(value, `"`)
+	}
+
+	return directives
+}
+
+func parseSeconds(value string) time.Duration {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+
+	return time.Duration(n) * time.Second
+}
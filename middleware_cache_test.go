@@ -0,0 +1,162 @@
+package ursa
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestCacheMiddleware tests cache hits, vary headers and Cache-Control handling
+func TestCacheMiddleware(t *testing.T) {
+	app := New()
+	cache := NewCache(CacheConfig{VaryHeaders: []string{"Accept-Language"}})
+
+	var count int32
+	app.Get("/items", cache.Handle, func(c *Ctx) error {
+		n := atomic.AddInt32(&count, 1)
+		c.Set("X-Count", strconv.Itoa(int(n)))
+		return c.SendString("items " + c.Get("Accept-Language"))
+	})
+
+	app.Get("/private", cache.Handle, func(c *Ctx) error {
+		atomic.AddInt32(&count, 1)
+		c.Set("Cache-Control", "private")
+		return c.SendString("private")
+	})
+
+	w := doRequest(app, http.MethodGet, "/items", nil)
+	if w.Header().Get("X-Cache") != "MISS" || w.Body.String() != "items " {
+		t.Fatalf("Expected MISS 'items ', got %s '%s'", w.Header().Get("X-Cache"), w.Body.String())
+	}
+
+	w = doRequest(app, http.MethodGet, "/items", nil)
+	if w.Header().Get("X-Cache") != "HIT" || w.Header().Get("X-Count") != "1" {
+		t.Errorf("Expected HIT of first response, got %s count %s", w.Header().Get("X-Cache"), w.Header().Get("X-Count"))
+	}
+	if w.Header().Get("Age") == "" {
+		t.Error("Expected Age header on cache hit")
+	}
+
+	w = doRequest(app, http.MethodGet, "/items", nil, "Accept-Language", "fr")
+	if w.Header().Get("X-Cache") != "MISS" || w.Body.String() != "items fr" {
+		t.Errorf("Expected MISS for another language, got %s '%s'", w.Header().Get("X-Cache"), w.Body.String())
+	}
+
+	w = doRequest(app, http.MethodGet, "/items", nil, "Cache-Control", "no-cache")
+	if w.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("Expected request no-cache to skip the cache, got %s", w.Header().Get("X-Cache"))
+	}
+
+	doRequest(app, http.MethodGet, "/private", nil)
+	if w = doRequest(app, http.MethodGet, "/private", nil); w.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("Expected private response not to be cached, got %s", w.Header().Get("X-Cache"))
+	}
+}
+
+// TestCacheInvalidate tests invalidation by key and by tag
+func TestCacheInvalidate(t *testing.T) {
+	app := New()
+	cache := NewCache(CacheConfig{Expiration: time.Hour})
+
+	app.Get("/users/:id", cache.Handle, func(c *Ctx) error {
+		cache.Tag(c, "users")
+		return c.SendString("user " + c.Param("id"))
+	})
+
+	doRequest(app, http.MethodGet, "/users/1", nil)
+	doRequest(app, http.MethodGet, "/users/2", nil)
+
+	if w := doRequest(app, http.MethodGet, "/users/1", nil); w.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("Expected HIT, got %s", w.Header().Get("X-Cache"))
+	}
+
+	_ = cache.Invalidate("GET /users/1")
+	if w := doRequest(app, http.MethodGet, "/users/1", nil); w.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("Expected MISS after key invalidation, got %s", w.Header().Get("X-Cache"))
+	}
+	if w := doRequest(app, http.MethodGet, "/users/2", nil); w.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("Expected other key to stay cached, got %s", w.Header().Get("X-Cache"))
+	}
+
+	time.Sleep(time.Millisecond)
+	_ = cache.InvalidateTag("users")
+	if w := doRequest(app, http.MethodGet, "/users/2", nil); w.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("Expected MISS after tag invalidation, got %s", w.Header().Get("X-Cache"))
+	}
+}
+
+// TestCacheInvalidateDuringFill tests that an invalidation made while the
+// handler runs drops the response it produces
+func TestCacheInvalidateDuringFill(t *testing.T) {
+	app := New()
+	cache := NewCache(CacheConfig{Expiration: time.Hour})
+
+	var invalidate int32 = 1
+	app.Get("/users/:id", cache.Handle, func(c *Ctx) error {
+		cache.Tag(c, "users")
+		if atomic.CompareAndSwapInt32(&invalidate, 1, 0) {
+			_ = cache.InvalidateTag("users")
+		}
+		return c.SendString("user " + c.Param("id"))
+	})
+
+	doRequest(app, http.MethodGet, "/users/1", nil)
+	if w := doRequest(app, http.MethodGet, "/users/1", nil); w.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("Expected MISS after invalidation during the handler, got %s", w.Header().Get("X-Cache"))
+	}
+	if w := doRequest(app, http.MethodGet, "/users/1", nil); w.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("Expected HIT once refilled, got %s", w.Header().Get("X-Cache"))
+	}
+}
+
+// TestCacheSingleflight tests that concurrent misses run the handler once
+func TestCacheSingleflight(t *testing.T) {
+	app := New()
+	cache := NewCache(CacheConfig{})
+
+	var count int32
+	app.Get("/slow", cache.Handle, func(c *Ctx) error {
+		atomic.AddInt32(&count, 1)
+		time.Sleep(50 * time.Millisecond)
+		return c.SendString("slow")
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if w := doRequest(app, http.MethodGet, "/slow", nil); w.Body.String() != "slow" {
+				t.Errorf("Expected body 'slow', got '%s'", w.Body.String())
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&count); n != 1 {
+		t.Errorf("Expected handler to run once, ran %d times", n)
+	}
+}
+
+// TestLRUStorage tests least recently used eviction
+func TestLRUStorage(t *testing.T) {
+	s := NewLRUStorage(2)
+
+	_ = s.Set("a", []byte("1"), 0)
+	_ = s.Set("b", []byte("2"), 0)
+	_, _ = s.Get("a")
+	_ = s.Set("c", []byte("3"), 0)
+
+	if v, _ := s.Get("b"); v != nil {
+		t.Errorf("Expected 'b' to be evicted, got '%s'", v)
+	}
+	if v, _ := s.Get("a"); string(v) != "1" {
+		t.Errorf("Expected 'a' to be kept, got '%s'", v)
+	}
+	if s.Len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", s.Len())
+	}
+}
@@ -0,0 +1,418 @@
+package ursa
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CompressLevel selects the speed/ratio trade-off of the Compress middleware
+type CompressLevel int
+
+const (
+	CompressLevelDefault CompressLevel = iota
+	CompressLevelBestSpeed
+	CompressLevelBestCompression
+)
+
+const (
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+)
+
+// CompressConfig defines the config for Compress middleware
+type CompressConfig struct {
+	// Level is the compression level.
+	// Default: CompressLevelDefault
+	Level CompressLevel
+
+	// MinLength is the minimum body size, in bytes, worth compressing.
+	// Smaller responses are sent as is, unless they are flushed early.
+	// Default: 1024
+	MinLength int
+
+	// Encodings lists the supported encodings in server preference order,
+	// used to break ties between equally weighted Accept-Encoding values.
+	// Encodings other than gzip and deflate, e.g. "zstd", need an encoder
+	// in Encoders.
+	// Default: []string{"gzip", "deflate"}
+	Encodings []string
+
+	// Encoders adds encoders to the built-in gzip and deflate ones, keyed
+	// by Content-Encoding, e.g. "zstd" from github.com/klauspost/compress.
+	// They are used once listed in Encodings.
+	// Default: nil
+	Encoders map[string]func(level CompressLevel) CompressEncoder
+
+	// ContentTypes lists the compressible media types. Types ending with
+	// "/" match as prefix, e.g. "text/". Types with a "+json" or "+xml"
+	// suffix are always compressible.
+	// Default: text/*, JSON, JavaScript, XML and SVG
+	ContentTypes []string
+
+	// Next defines a function to skip this middleware when returning true.
+	// Default: nil
+	Next func(c *Ctx) bool
+}
+
+// DefaultCompressConfig is the default Compress middleware config
+var DefaultCompressConfig = CompressConfig{
+	Level:     CompressLevelDefault,
+	MinLength: 1024,
+	Encodings: []string{EncodingGzip, EncodingDeflate},
+	ContentTypes: []string{
+		"text/",
+		MIMEApplicationJSON,
+		MIMEApplicationXML,
+		"application/javascript",
+		"application/x-javascript",
+		"image/svg+xml",
+	},
+}
+
+// NewCompress returns a Compress middleware with default config
+func NewCompress() HandlerFunc {
+	return NewCompressWithConfig(DefaultCompressConfig)
+}
+
+// NewCompressWithConfig returns a Compress middleware with custom config.
+//
+// The response is compressed with the best encoding accepted by the client
+// once it exceeds MinLength or is flushed. Responses that already have a
+// Content-Encoding, partial content and non compressible types are sent
+// untouched.
+func NewCompressWithConfig(config CompressConfig) HandlerFunc {
+	// Set defaults
+	if config.Level < CompressLevelDefault || config.Level > CompressLevelBestCompression {
+		config.Level = DefaultCompressConfig.Level
+	}
+	if config.MinLength <= 0 {
+		config.MinLength = DefaultCompressConfig.MinLength
+	}
+	if len(config.Encodings) == 0 {
+		config.Encodings = DefaultCompressConfig.Encodings
+	}
+	if len(config.ContentTypes) == 0 {
+		config.ContentTypes = DefaultCompressConfig.ContentTypes
+	}
+
+	pools := make(map[string]*sync.Pool, len(config.Encodings))
+	for _, encoding := range config.Encodings {
+		newEncoder := config.Encoders[encoding]
+		if newEncoder == nil {
+			newEncoder = compressEncoders[encoding]
+		}
+		elsePanic(newEncoder != nil, "unsupported compress encoding: "+encoding)
+
+		level := config.Level
+		pools[encoding] = &sync.Pool{New: func() any { return newEncoder(level) }}
+	}
+
+	return func(c *Ctx) error {
+		if config.Next != nil && config.Next(c) {
+			return c.Next()
+		}
+
+		addVary(c.Writer.Header(), "Accept-Encoding")
+
+		if c.Request.Method == http.MethodHead || c.Get("Range") != "" {
+			return c.Next()
+		}
+
+		encoding := negotiateEncoding(c.Get("Accept-Encoding"), config.Encodings)
+		if encoding == "" {
+			return c.Next()
+		}
+
+		cw := &compressWriter{
+			bufferWriter: newBufferWriter(c.Writer),
+			config:       &config,
+			pool:         pools[encoding],
+			encoding:     encoding,
+		}
+		cw.limit = config.MinLength
+		cw.prepare = cw.decide
+
+		c.Writer = cw
+		defer func() {
+			c.Writer = cw.ResponseWriter
+			cw.close()
+		}()
+
+		return c.Next()
+	}
+}
+
+// CompressEncoder is a streaming encoder of the Compress middleware. Each
+// one is pooled and Reset onto the response it compresses.
+type CompressEncoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+var compressEncoders = map[string]func(level CompressLevel) CompressEncoder{
+	EncodingGzip: func(level CompressLevel) CompressEncoder {
+		w, _ := gzip.NewWriterLevel(nil, [...]int{gzip.DefaultCompression, gzip.BestSpeed, gzip.BestCompression}[level])
+		return w
+	},
+	EncodingDeflate: func(level CompressLevel) CompressEncoder {
+		w, _ := zlib.NewWriterLevel(nil, [...]int{zlib.DefaultCompression, zlib.BestSpeed, zlib.BestCompression}[level])
+		return w
+	},
+}
+
+// negotiateEncoding returns the supported encoding with the highest
+// q-value in the Accept-Encoding header, or "" if none is acceptable.
+func negotiateEncoding(accept string, supported []string) string {
+	if accept == "" {
+		return ""
+	}
+
+	var (
+		qs       = make(map[string]float64, len(supported))
+		wildcard = -1.0
+	)
+
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+
+		if name == "*" {
+			wildcard = q
+		} else {
+			qs[name] = q
+		}
+	}
+
+	var (
+		best  string
+		bestQ float64
+	)
+
+	for _, encoding := range supported {
+		q, ok := qs[encoding]
+		if !ok {
+			q = wildcard
+		}
+
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+
+	return best
+}
+
+// compressWriter buffers the first MinLength bytes of the response to
+// decide whether it is worth compressing, then streams through an encoder.
+type compressWriter struct {
+	*bufferWriter
+
+	config   *CompressConfig
+	pool     *sync.Pool
+	encoding string
+	encoder  CompressEncoder
+}
+
+var _ ResponseWriter = (*compressWriter)(nil)
+
+// decide sets the headers as the response is sent and returns the encoder
+// of the body, if any. Complete bodies shorter than MinLength are not
+// compressed, flushed ones are so that streams such as SSE are compressed
+// from the start.
+func (w *compressWriter) decide(final bool) io.Writer {
+	if !w.compressible(final) {
+		return nil
+	}
+
+	h := w.Header()
+	if h.Get("Content-Type") == "" {
+		h.Set("Content-Type", http.DetectContentType(w.buf.Bytes()))
+	}
+	h.Del("Content-Length")
+	h.Set("Content-Encoding", w.encoding)
+
+	w.encoder = w.pool.Get().(CompressEncoder)
+	w.encoder.Reset(w.ResponseWriter)
+
+	return w.encoder
+}
+
+func (w *compressWriter) compressible(final bool) bool {
+	if final && w.buf.Len() < w.config.MinLength {
+		return false
+	}
+
+	switch {
+	case w.status < 200,
+		w.status == http.StatusNoContent,
+		w.status == http.StatusPartialContent,
+		w.status == http.StatusNotModified:
+		return false
+	}
+
+	h := w.Header()
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+
+	ctype := h.Get("Content-Type")
+	if ctype == "" {
+		ctype = http.DetectContentType(w.buf.Bytes())
+	}
+
+	return compressibleType(ctype, w.config.ContentTypes)
+}
+
+func (w *compressWriter) close() {
+	_ = w.send(true)
+
+	if w.encoder != nil {
+		_ = w.encoder.Close()
+		w.encoder.Reset(nil)
+		w.pool.Put(w.encoder)
+		w.encoder = nil
+	}
+}
+
+func compressibleType(ctype string, types []string) bool {
+	ctype, _, _ = strings.Cut(ctype, ";")
+	ctype = strings.ToLower(strings.TrimSpace(ctype))
+
+	if strings.HasSuffix(ctype, "+json") || strings.HasSuffix(ctype, "+xml") {
+		return true
+	}
+
+	for _, t := range types {
+		if strings.HasSuffix(t, "/") {
+			if strings.HasPrefix(ctype, t) {
+				return true
+			}
+		} else if ctype == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// addVary adds value to the Vary header unless it is already listed
+func addVary(h http.Header, value string) {
+	for _, v := range h.Values("Vary") {
+		for _, token := range strings.Split(v, ",") {
+			token = strings.TrimSpace(token)
+			if token == "*" || strings.EqualFold(token, value) {
+				return
+			}
+		}
+	}
+
+	h.Add("Vary", value)
+}
+
+/* ===============================================================
+|| Request body decompression
+=============================================================== */
+
+// DecompressConfig defines the config for Decompress middleware
+type DecompressConfig struct {
+	// Decoders adds decoders to the built-in gzip and deflate ones, keyed
+	// by Content-Encoding, e.g. "zstd" from github.com/klauspost/compress.
+	// Default: nil
+	Decoders map[string]func(r io.Reader) (io.ReadCloser, error)
+
+	// Next defines a function to skip this middleware when returning true.
+	// Default: nil
+	Next func(c *Ctx) bool
+}
+
+// DefaultDecompressConfig is the default Decompress middleware config
+var DefaultDecompressConfig = DecompressConfig{}
+
+var decompressDecoders = map[string]func(r io.Reader) (io.ReadCloser, error){
+	EncodingGzip:    func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+	"x-gzip":        func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+	EncodingDeflate: zlib.NewReader,
+}
+
+// NewDecompress returns a Decompress middleware with default config
+func NewDecompress() HandlerFunc {
+	return NewDecompressWithConfig(DefaultDecompressConfig)
+}
+
+// NewDecompressWithConfig returns a middleware that transparently decodes
+// gzip and deflate request bodies, plus those of config.Decoders, so that
+// BodyParser and friends read plain content. Unsupported encodings are
+// answered with 415, and bodies inflating beyond the body limit of the
+// route fail with 413.
+func NewDecompressWithConfig(config DecompressConfig) HandlerFunc {
+	decoders := make(map[string]func(r io.Reader) (io.ReadCloser, error), len(decompressDecoders)+len(config.Decoders))
+	for encoding, decoder := range decompressDecoders {
+		decoders[encoding] = decoder
+	}
+	for encoding, decoder := range config.Decoders {
+		decoders[strings.ToLower(encoding)] = decoder
+	}
+
+	return func(c *Ctx) error {
+		if config.Next != nil && config.Next(c) {
+			return c.Next()
+		}
+
+		encodings := strings.Split(c.Get("Content-Encoding"), ",")
+		if len(encodings) == 1 && strings.TrimSpace(encodings[0]) == "" {
+			return c.Next()
+		}
+
+		if c.Request.Body == nil || c.Request.Body == http.NoBody {
+			return c.Next()
+		}
+
+		var body io.Reader = c.Request.Body
+
+		// encodings are listed in the order they were applied
+		for i := len(encodings) - 1; i >= 0; i-- {
+			encoding := strings.ToLower(strings.TrimSpace(encodings[i]))
+			if encoding == "identity" {
+				continue
+			}
+
+			decoder := decoders[encoding]
+			if decoder == nil {
+				return c.Status(http.StatusUnsupportedMediaType).SendString("Unsupported Media Type")
+			}
+
+			dec, err := decoder(body)
+			if err != nil {
+				return c.Status(http.StatusBadRequest).SendString("Bad Request")
+			}
+			defer dec.Close()
+
+			body = dec
+		}
+
+		body = &bodyReader{c: c, r: body, limit: c.body.limit}
+
+		c.Request.Body = struct {
+			io.Reader
+			io.Closer
+		}{body, c.Request.Body}
+		c.Request.Header.Del("Content-Encoding")
+		c.Request.Header.Del("Content-Length")
+		c.Request.ContentLength = -1
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,194 @@
+package ursa
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestEncoder plugs gzip as the "x-test" encoding
+func newTestEncoder(level CompressLevel) CompressEncoder {
+	return gzip.NewWriter(nil)
+}
+
+// TestCompressMiddleware tests response compression negotiation
+func TestCompressMiddleware(t *testing.T) {
+	app := New()
+	app.Use(NewCompressWithConfig(CompressConfig{
+		Encodings: []string{"x-test", EncodingGzip, EncodingDeflate},
+		Encoders:  map[string]func(level CompressLevel) CompressEncoder{"x-test": newTestEncoder},
+	}))
+
+	large := strings.Repeat("ursa compress ", 200)
+
+	app.Get("/large", func(c *Ctx) error {
+		return c.SendString(large)
+	})
+
+	app.Get("/small", func(c *Ctx) error {
+		return c.SendString("small")
+	})
+
+	app.Get("/image", func(c *Ctx) error {
+		c.Set("Content-Type", "image/png")
+		_, err := c.Write([]byte(large))
+		return err
+	})
+
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		"gzip":    func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"deflate": func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) },
+		"x-test":  func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+	}
+
+	for accept, expected := range map[string]string{
+		"gzip":                      "gzip",
+		"deflate, gzip;q=0.5":       "deflate",
+		"gzip, deflate, br, x-test": "x-test",
+		"*":                         "x-test",
+		"x-test;q=0, *;q=0.1":       "gzip",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/large", nil)
+		req.Header.Set("Accept-Encoding", accept)
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, req)
+
+		if w.Header().Get("Content-Encoding") != expected {
+			t.Errorf("%s: expected encoding %s, got '%s'", accept, expected, w.Header().Get("Content-Encoding"))
+			continue
+		}
+		if w.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("%s: expected Vary header, got '%s'", accept, w.Header().Get("Vary"))
+		}
+
+		r, err := decoders[expected](w.Body)
+		if err != nil {
+			t.Fatalf("%s: %v", accept, err)
+		}
+		bs, _ := io.ReadAll(r)
+		if string(bs) != large {
+			t.Errorf("%s: decoded body mismatch", accept)
+		}
+	}
+
+	for _, path := range []string{"/small", "/image"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, req)
+
+		if w.Header().Get("Content-Encoding") != "" {
+			t.Errorf("%s: expected no compression, got '%s'", path, w.Header().Get("Content-Encoding"))
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/large", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Range", "bytes=0-10")
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+
+	if w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected ranged request not to be compressed, got '%s'", w.Header().Get("Content-Encoding"))
+	}
+}
+
+// TestCompressMiddlewareFlush tests that flushed streams are compressed incrementally
+func TestCompressMiddlewareFlush(t *testing.T) {
+	app := New()
+	app.Use(NewCompress())
+
+	app.Get("/stream", func(c *Ctx) error {
+		c.Set("Content-Type", "text/event-stream")
+		_, _ = c.Write([]byte("data: 1\n\n"))
+		return c.Flush()
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/stream", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected gzip encoding, got '%s'", w.Header().Get("Content-Encoding"))
+	}
+	if !w.Flushed {
+		t.Error("Expected the response to be flushed")
+	}
+
+	r, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, _ := io.ReadAll(r)
+	if string(bs) != "data: 1\n\n" {
+		t.Errorf("Expected event, got '%s'", bs)
+	}
+}
+
+// TestDecompressMiddleware tests transparent request body decompression
+func TestDecompressMiddleware(t *testing.T) {
+	app := New()
+	app.Use(NewDecompressWithConfig(DecompressConfig{
+		Decoders: map[string]func(r io.Reader) (io.ReadCloser, error){
+			"x-test": func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+		},
+	}))
+
+	app.Post("/test", func(c *Ctx) error {
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := c.BodyParser(&req); err != nil {
+			return err
+		}
+		return c.SendString(req.Name)
+	})
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	_, _ = gw.Write([]byte(`{"name":"ursa"}`))
+	_ = gw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/test", &buf)
+	req.Header.Set("Content-Type", MIMEApplicationJSON)
+	req.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+
+	if w.Code != 200 || w.Body.String() != "ursa" {
+		t.Errorf("Expected 200 'ursa', got %d '%s'", w.Code, w.Body.String())
+	}
+
+	// a plugged decoder applied after a built-in one
+	buf.Reset()
+	gw = gzip.NewWriter(&buf)
+	zw := zlib.NewWriter(gw)
+	_, _ = zw.Write([]byte(`{"name":"ursa"}`))
+	_ = zw.Close()
+	_ = gw.Close()
+
+	req = httptest.NewRequest(http.MethodPost, "/test", &buf)
+	req.Header.Set("Content-Type", MIMEApplicationJSON)
+	req.Header.Set("Content-Encoding", "deflate, X-Test")
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+
+	if w.Code != 200 || w.Body.String() != "ursa" {
+		t.Errorf("Expected 200 'ursa' with a plugged decoder, got %d '%s'", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/test", strings.NewReader("x"))
+	req.Header.Set("Content-Encoding", "br")
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+
+	if w.Code != 415 {
+		t.Errorf("Expected status 415, got %d", w.Code)
+	}
+}
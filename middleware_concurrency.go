@@ -0,0 +1,215 @@
+package ursa
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ConcurrencyConfig defines the config for Concurrency middleware
+type ConcurrencyConfig struct {
+	// Max is the number of requests handled at the same time. The limit is
+	// per middleware instance: use it on the app for a global cap, or on a
+	// RouterGroup for a cap per group.
+	// Default: 1024
+	Max int
+
+	// MaxQueue is the number of requests allowed to wait for a free slot,
+	// requests beyond it are rejected immediately.
+	// Default: 0 (no queue)
+	MaxQueue int
+
+	// MaxWait is the longest a queued request waits for a free slot.
+	// Default: 1s
+	MaxWait time.Duration
+
+	// Adaptive enables CoDel-style load shedding: when queued requests
+	// waited longer than Target during a whole Interval, the queue is
+	// considered standing and MaxWait shrinks to Target until the queue
+	// drains again, which bounds the tail latency under overload.
+	// Default: false
+	Adaptive bool
+
+	// Target is the acceptable queue wait in adaptive mode.
+	// Default: 5ms
+	Target time.Duration
+
+	// Interval is the observation window in adaptive mode.
+	// Default: 100ms
+	Interval time.Duration
+
+	// RetryAfter is the Retry-After header value, in seconds, of rejected requests.
+	// Default: 1
+	RetryAfter int
+
+	// Next defines a function to skip this middleware when returning true.
+	// Default: nil
+	Next func(c *Ctx) bool
+
+	// Rejected is called when a request is shed, after the Retry-After header is set.
+	// Default: responds 503 "Service Unavailable"
+	Rejected HandlerFunc
+}
+
+// DefaultConcurrencyConfig is the default Concurrency middleware config
+var DefaultConcurrencyConfig = ConcurrencyConfig{
+	Max:        1024,
+	MaxQueue:   0,
+	MaxWait:    time.Second,
+	Target:     5 * time.Millisecond,
+	Interval:   100 * time.Millisecond,
+	RetryAfter: 1,
+	Rejected: func(c *Ctx) error {
+		return c.Status(http.StatusServiceUnavailable).SendString("Service Unavailable")
+	},
+}
+
+// NewConcurrency returns a Concurrency middleware allowing max in-flight requests without queueing
+func NewConcurrency(max int) HandlerFunc {
+	config := DefaultConcurrencyConfig
+	config.Max = max
+
+	return NewConcurrencyWithConfig(config)
+}
+
+// NewConcurrencyWithConfig returns a Concurrency middleware with custom config
+func NewConcurrencyWithConfig(config ConcurrencyConfig) HandlerFunc {
+	// Set defaults
+	if config.Max <= 0 {
+		config.Max = DefaultConcurrencyConfig.Max
+	}
+	if config.MaxQueue < 0 {
+		config.MaxQueue = 0
+	}
+	if config.MaxWait <= 0 {
+		config.MaxWait = DefaultConcurrencyConfig.MaxWait
+	}
+	if config.Target <= 0 {
+		config.Target = DefaultConcurrencyConfig.Target
+	}
+	if config.Interval <= 0 {
+		config.Interval = DefaultConcurrencyConfig.Interval
+	}
+	if config.RetryAfter <= 0 {
+		config.RetryAfter = DefaultConcurrencyConfig.RetryAfter
+	}
+	if config.Rejected == nil {
+		config.Rejected = DefaultConcurrencyConfig.Rejected
+	}
+
+	var (
+		slots      = make(chan struct{}, config.Max)
+		retryAfter = strconv.Itoa(config.RetryAfter)
+		cd         = &codel{target: config.Target, interval: config.Interval}
+
+		lock   sync.Mutex
+		queued int
+	)
+
+	reject := func(c *Ctx) error {
+		c.Set("Retry-After", retryAfter)
+		return config.Rejected(c)
+	}
+
+	return func(c *Ctx) error {
+		if config.Next != nil && config.Next(c) {
+			return c.Next()
+		}
+
+		select {
+		case slots <- struct{}{}:
+			if config.Adaptive {
+				cd.observe(time.Now(), 0)
+			}
+		default:
+			lock.Lock()
+			if queued >= config.MaxQueue {
+				lock.Unlock()
+				return reject(c)
+			}
+			queued++
+			lock.Unlock()
+
+			var (
+				start = time.Now()
+				wait  = config.MaxWait
+			)
+
+			if config.Adaptive && cd.overloaded(start) {
+				wait = config.Target
+			}
+
+			timer := time.NewTimer(wait)
+
+			var acquired bool
+			select {
+			case slots <- struct{}{}:
+				acquired = true
+			case <-timer.C:
+			case <-c.Context().Done():
+			}
+			timer.Stop()
+
+			lock.Lock()
+			queued--
+			lock.Unlock()
+
+			if config.Adaptive {
+				now := time.Now()
+				cd.observe(now, now.Sub(start))
+			}
+
+			if !acquired {
+				return reject(c)
+			}
+		}
+
+		defer func() { <-slots }()
+
+		return c.Next()
+	}
+}
+
+// codel tracks the minimum queue wait over an interval, as in the
+// Controlled Delay algorithm: a minimum above target means the queue
+// never drained during the whole interval.
+type codel struct {
+	lock     sync.Mutex
+	target   time.Duration
+	interval time.Duration
+
+	start    time.Time
+	minDelay time.Duration
+	standing bool
+}
+
+func (cd *codel) observe(now time.Time, delay time.Duration) {
+	cd.lock.Lock()
+	defer cd.lock.Unlock()
+
+	if cd.start.IsZero() || now.Sub(cd.start) >= cd.interval {
+		if !cd.start.IsZero() {
+			cd.standing = cd.minDelay > cd.target
+		}
+		cd.start = now
+		cd.minDelay = delay
+		return
+	}
+
+	if delay < cd.minDelay {
+		cd.minDelay = delay
+	}
+}
+
+func (cd *codel) overloaded(now time.Time) bool {
+	cd.lock.Lock()
+	defer cd.lock.Unlock()
+
+	// the current interval already lasted long enough to judge it
+	if !cd.start.IsZero() && now.Sub(cd.start) >= cd.interval && cd.minDelay > cd.target {
+		return true
+	}
+
+	return cd.standing
+}
@@ -0,0 +1,116 @@
+package ursa
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestConcurrencyMiddleware tests that requests above the in-flight cap are shed
+func TestConcurrencyMiddleware(t *testing.T) {
+	app := New()
+	app.Use(NewConcurrency(1))
+
+	var (
+		entered = make(chan struct{})
+		release = make(chan struct{})
+	)
+
+	app.Get("/test", func(c *Ctx) error {
+		entered <- struct{}{}
+		<-release
+		return c.SendString("test")
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, req)
+		if w.Code != 200 {
+			t.Errorf("Expected status 200, got %d", w.Code)
+		}
+	}()
+	<-entered
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+
+	if w.Code != 503 {
+		t.Errorf("Expected status 503, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected Retry-After 1, got '%s'", w.Header().Get("Retry-After"))
+	}
+
+	close(release)
+	wg.Wait()
+}
+
+// TestConcurrencyMiddlewareQueue tests that queued requests wait for a free slot
+func TestConcurrencyMiddlewareQueue(t *testing.T) {
+	app := New()
+	app.Use(NewConcurrencyWithConfig(ConcurrencyConfig{
+		Max:      1,
+		MaxQueue: 1,
+		MaxWait:  time.Second,
+	}))
+
+	app.Get("/test", func(c *Ctx) error {
+		time.Sleep(20 * time.Millisecond)
+		return c.SendString("test")
+	})
+
+	var (
+		wg    sync.WaitGroup
+		lock  sync.Mutex
+		codes = map[int]int{}
+	)
+
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, req)
+
+			lock.Lock()
+			codes[w.Code]++
+			lock.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if codes[200] < 2 || codes[200]+codes[503] != 3 {
+		t.Errorf("Expected at least 2 successful requests, got %v", codes)
+	}
+}
+
+// TestCodel tests standing queue detection
+func TestCodel(t *testing.T) {
+	var (
+		cd  = &codel{target: 5 * time.Millisecond, interval: 100 * time.Millisecond}
+		now = time.Now()
+	)
+
+	cd.observe(now, 10*time.Millisecond)
+	cd.observe(now.Add(50*time.Millisecond), 20*time.Millisecond)
+	if cd.overloaded(now.Add(60 * time.Millisecond)) {
+		t.Error("Expected no overload before a full interval")
+	}
+	if !cd.overloaded(now.Add(100 * time.Millisecond)) {
+		t.Error("Expected overload after a full interval above target")
+	}
+
+	cd.observe(now.Add(110*time.Millisecond), 0)
+	cd.observe(now.Add(220*time.Millisecond), 0)
+	if cd.overloaded(now.Add(230 * time.Millisecond)) {
+		t.Error("Expected overload to end once the queue drained")
+	}
+}
@@ -0,0 +1,203 @@
+package ursa
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CSRFConfig defines the config for CSRF middleware
+type CSRFConfig struct {
+	// KeyLookup lists where unsafe requests carry the token, as
+	// comma-separated "<source>:<name>" pairs tried in order, the sources
+	// being "header", "form" and "query". Reading the token from a cookie
+	// would compare the cookie with itself, so "cookie" panics.
+	// Default: "header:X-CSRF-Token,form:_csrf"
+	KeyLookup string
+
+	// CookieName is the name of the token cookie in double-submit mode.
+	// Default: "csrf_"
+	CookieName string
+
+	CookieDomain string
+	CookiePath   string
+
+	// CookieSameSite is one of CookieSameSiteLax, CookieSameSiteStrict,
+	// CookieSameSiteNone or CookieSameSiteDisabled.
+	// Default: CookieSameSiteLax
+	CookieSameSite string
+
+	// CookieSecure forces the Secure attribute on plain HTTP requests,
+	// it is always set on HTTPS ones.
+	// Default: false
+	CookieSecure bool
+
+	// CookieHTTPOnly hides the token cookie from scripts. Pages then get
+	// the token from Ctx.CSRFToken, e.g. in a form field.
+	// Default: false
+	CookieHTTPOnly bool
+
+	// Expiration is the lifetime of the token cookie, it is renewed on
+	// every safe request.
+	// Default: 1 hour
+	Expiration time.Duration
+
+	// DisableSession keeps the token in the cookie (double-submit) even when
+	// the Session middleware runs before this one. By default the token is
+	// then kept in the session (synchronizer token).
+	// Default: false
+	DisableSession bool
+
+	// SessionKey is the session key of the token in synchronizer mode.
+	// Default: "ursa.csrf"
+	SessionKey string
+
+	// Exempt lists route paths, as registered, which are not checked, e.g.
+	// "/webhooks/:provider". A trailing "*" matches any suffix.
+	// Default: nil
+	Exempt []string
+
+	// Next defines a function to skip this middleware when returning true.
+	// Default: nil
+	Next func(c *Ctx) bool
+
+	// ErrorHandler is called when the token of an unsafe request is missing
+	// or invalid.
+	// Default: responds 403 "Forbidden"
+	ErrorHandler HandlerFunc
+}
+
+// DefaultCSRFConfig is the default CSRF middleware config
+var DefaultCSRFConfig = CSRFConfig{
+	KeyLookup:      "header:X-CSRF-Token,form:_csrf",
+	CookieName:     "csrf_",
+	CookiePath:     "/",
+	CookieSameSite: CookieSameSiteLax,
+	Expiration:     time.Hour,
+	SessionKey:     "ursa.csrf",
+	ErrorHandler: func(c *Ctx) error {
+		return c.Status(http.StatusForbidden).SendString("Forbidden")
+	},
+}
+
+const csrfKey = "ursa.csrf"
+
+// NewCSRF returns a CSRF middleware with default config
+func NewCSRF() HandlerFunc {
+	return NewCSRFWithConfig(DefaultCSRFConfig)
+}
+
+// NewCSRFWithConfig returns a CSRF middleware with custom config.
+//
+// Safe requests (GET, HEAD, OPTIONS, TRACE) get a token, available from
+// Ctx.CSRFToken, and unsafe ones must send it back as configured by
+// KeyLookup. The token is kept in the session when the Session middleware
+// runs before this one, otherwise in a cookie.
+func NewCSRFWithConfig(config CSRFConfig) HandlerFunc {
+	// Set defaults
+	if config.KeyLookup == "" {
+		config.KeyLookup = DefaultCSRFConfig.KeyLookup
+	}
+	if config.CookieName == "" {
+		config.CookieName = DefaultCSRFConfig.CookieName
+	}
+	if config.CookiePath == "" {
+		config.CookiePath = DefaultCSRFConfig.CookiePath
+	}
+	if config.CookieSameSite == "" {
+		config.CookieSameSite = DefaultCSRFConfig.CookieSameSite
+	}
+	if config.Expiration <= 0 {
+		config.Expiration = DefaultCSRFConfig.Expiration
+	}
+	if config.SessionKey == "" {
+		config.SessionKey = DefaultCSRFConfig.SessionKey
+	}
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = DefaultCSRFConfig.ErrorHandler
+	}
+
+	for _, part := range strings.Split(config.KeyLookup, ",") {
+		elsePanic(!strings.HasPrefix(strings.TrimSpace(part), "cookie:"), "csrf: KeyLookup cannot read the token from a cookie")
+	}
+	extractors := parseKeyLookup(config.KeyLookup, "")
+
+	return func(c *Ctx) error {
+		if config.Next != nil && config.Next(c) {
+			return c.Next()
+		}
+
+		if csrfExempt(config.Exempt, c.FullPath()) {
+			return c.Next()
+		}
+
+		sess := c.Session()
+		if config.DisableSession {
+			sess = nil
+		}
+
+		var stored string
+		if sess != nil {
+			stored, _ = sess.Get(config.SessionKey).(string)
+		} else {
+			stored = c.Cookies(config.CookieName)
+		}
+
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		default:
+			token := lookupKey(c, extractors)
+			if stored == "" || subtle.ConstantTimeCompare([]byte(token), []byte(stored)) != 1 {
+				return config.ErrorHandler(c)
+			}
+		}
+
+		token := stored
+		if token == "" {
+			token = randomToken()
+		}
+
+		if sess != nil {
+			if token != stored {
+				sess.Set(config.SessionKey, token)
+			}
+		} else {
+			c.Cookie(&Cookie{
+				Name:     config.CookieName,
+				Value:    token,
+				Path:     config.CookiePath,
+				Domain:   config.CookieDomain,
+				MaxAge:   int(config.Expiration / time.Second),
+				Secure:   config.CookieSecure,
+				HTTPOnly: config.CookieHTTPOnly,
+				SameSite: config.CookieSameSite,
+			})
+		}
+
+		c.Locals(csrfKey, token)
+
+		return c.Next()
+	}
+}
+
+// CSRFToken returns the token set by the CSRF middleware, to be embedded in
+// pages and sent back by unsafe requests.
+func (c *Ctx) CSRFToken() string {
+	token, _ := c.Locals(csrfKey).(string)
+	return token
+}
+
+func csrfExempt(exempt []string, path string) bool {
+	for _, pattern := range exempt {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		} else if path == pattern {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,114 @@
+package ursa
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func newCSRFApp(middlewares ...HandlerFunc) *App {
+	app := New()
+	for _, m := range middlewares {
+		app.Use(m)
+	}
+
+	app.Get("/form", func(c *Ctx) error {
+		return c.SendString(c.CSRFToken())
+	})
+	app.Post("/submit", func(c *Ctx) error {
+		return c.SendString("ok")
+	})
+	app.Post("/webhooks/:provider", func(c *Ctx) error {
+		return c.SendString("hook")
+	})
+
+	return app
+}
+
+func doCSRFRequest(app *App, method, path, cookie string, body url.Values, headers ...string) *httptest.ResponseRecorder {
+	var ctype string
+	if body != nil {
+		ctype = "application/x-www-form-urlencoded"
+	}
+
+	return doRequest(app, method, path, strings.NewReader(body.Encode()), append([]string{"Cookie", cookie, "Content-Type", ctype}, headers...)...)
+}
+
+// TestCSRFDoubleSubmit tests the cookie based mode
+func TestCSRFDoubleSubmit(t *testing.T) {
+	app := newCSRFApp(NewCSRFWithConfig(CSRFConfig{Exempt: []string{"/webhooks/*"}}))
+
+	w := doCSRFRequest(app, http.MethodGet, "/form", "", nil)
+	token := w.Body.String()
+	if token == "" {
+		t.Fatal("Expected a token on safe request")
+	}
+
+	var cookie string
+	for _, ck := range w.Result().Cookies() {
+		if ck.Name == "csrf_" {
+			cookie = ck.Name + "=" + ck.Value
+		}
+	}
+	if cookie != "csrf_="+token {
+		t.Fatalf("Expected token cookie, got '%s'", cookie)
+	}
+
+	if w = doCSRFRequest(app, http.MethodPost, "/submit", cookie, nil); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 without token, got %d", w.Code)
+	}
+
+	if w = doCSRFRequest(app, http.MethodPost, "/submit", cookie, nil, "X-CSRF-Token", "forged"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 with wrong token, got %d", w.Code)
+	}
+
+	if w = doCSRFRequest(app, http.MethodPost, "/submit", cookie, nil, "X-CSRF-Token", token); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 with header token, got %d", w.Code)
+	}
+
+	if w = doCSRFRequest(app, http.MethodPost, "/submit", cookie, url.Values{"_csrf": {token}}); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 with form token, got %d", w.Code)
+	}
+
+	if w = doCSRFRequest(app, http.MethodPost, "/webhooks/github", "", nil); w.Code != http.StatusOK {
+		t.Errorf("Expected exempt route to pass, got %d", w.Code)
+	}
+}
+
+// TestCSRFSession tests the synchronizer token mode
+func TestCSRFSession(t *testing.T) {
+	app := newCSRFApp(NewSession(), NewCSRF())
+
+	w := doCSRFRequest(app, http.MethodGet, "/form", "", nil)
+	token := w.Body.String()
+	cookie := sessionCookie(w)
+	if token == "" || cookie == "" {
+		t.Fatalf("Expected token stored in a session, got token '%s' cookie '%s'", token, cookie)
+	}
+
+	for _, ck := range w.Result().Cookies() {
+		if ck.Name == "csrf_" {
+			t.Error("Expected no token cookie in session mode")
+		}
+	}
+
+	if w = doCSRFRequest(app, http.MethodPost, "/submit", "csrf_="+token, nil, "X-CSRF-Token", token); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 without the session, got %d", w.Code)
+	}
+
+	if w = doCSRFRequest(app, http.MethodPost, "/submit", cookie, nil, "X-CSRF-Token", token); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 with session token, got %d", w.Code)
+	}
+}
+
+// TestCSRFCookieLookup tests that the token cannot be read from a cookie
+func TestCSRFCookieLookup(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("Expected panic for a cookie KeyLookup")
+		}
+	}()
+	NewCSRFWithConfig(CSRFConfig{KeyLookup: "header:X-CSRF-Token, cookie:csrf_"})
+}
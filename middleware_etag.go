@@ -0,0 +1,85 @@
+package ursa
+
+import (
+	"hash/crc32"
+	"net/http"
+	"strconv"
+)
+
+// ETagConfig defines the config for ETag middleware
+type ETagConfig struct {
+	// Weak generates weak validators (W/"...") instead of strong ones.
+	// Default: false
+	Weak bool
+
+	// Next defines a function to skip this middleware when returning true.
+	// Default: nil
+	Next func(c *Ctx) bool
+}
+
+// DefaultETagConfig is the default ETag middleware config
+var DefaultETagConfig = ETagConfig{
+	Weak: false,
+}
+
+// NewETag returns an ETag middleware with default config
+func NewETag() HandlerFunc {
+	return NewETagWithConfig(DefaultETagConfig)
+}
+
+// NewETagWithConfig returns an ETag middleware with custom config.
+//
+// Successful GET and HEAD responses are buffered to compute their ETag,
+// unless the handler already set one, and answered with 304 when the
+// If-None-Match request header matches. Flushed responses are streamed
+// without an ETag.
+func NewETagWithConfig(config ETagConfig) HandlerFunc {
+	return func(c *Ctx) error {
+		if config.Next != nil && config.Next(c) {
+			return c.Next()
+		}
+
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			return c.Next()
+		}
+
+		bw := newBufferWriter(c.Writer)
+		c.Writer = bw
+		defer func() {
+			c.Writer = bw.ResponseWriter
+		}()
+
+		err := c.Next()
+
+		if bw.passthrough {
+			return err
+		}
+
+		if err != nil || bw.status != http.StatusOK || bw.buf.Len() == 0 {
+			_ = bw.send(true)
+			return err
+		}
+
+		h := bw.Header()
+		if h.Get("ETag") == "" {
+			body := bw.Body()
+			etag := `"` + strconv.FormatInt(int64(len(body)), 16) + "-" + strconv.FormatUint(uint64(crc32.ChecksumIEEE(body)), 16) + `"`
+			if config.Weak {
+				etag = "W/" + etag
+			}
+			h.Set("ETag", etag)
+		}
+
+		if inm := c.Get("If-None-Match"); inm != "" && etagMatch(inm, h.Get("ETag"), false) {
+			bw.buf.Reset()
+			bw.status = http.StatusNotModified
+			h.Del("Content-Type")
+			h.Del("Content-Length")
+		}
+
+		_ = bw.send(true)
+		c.StatusCode = bw.status
+
+		return nil
+	}
+}
@@ -0,0 +1,133 @@
+package ursa
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestETagMiddleware tests ETag generation and If-None-Match handling
+func TestETagMiddleware(t *testing.T) {
+	app := New()
+	app.Use(NewETag())
+
+	app.Get("/test", func(c *Ctx) error {
+		return c.SendString("hello etag")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+
+	etag := w.Header().Get("ETag")
+	if w.Code != 200 || etag == "" || strings.HasPrefix(etag, "W/") {
+		t.Fatalf("Expected 200 with strong ETag, got %d '%s'", w.Code, etag)
+	}
+	if w.Body.String() != "hello etag" {
+		t.Errorf("Expected body 'hello etag', got '%s'", w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("If-None-Match", `"other", `+etag)
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+
+	if w.Code != 304 {
+		t.Errorf("Expected status 304, got %d", w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("Expected empty body, got '%s'", w.Body.String())
+	}
+}
+
+// TestETagMiddlewareWeak tests weak ETag generation
+func TestETagMiddlewareWeak(t *testing.T) {
+	app := New()
+	app.Use(NewETagWithConfig(ETagConfig{Weak: true}))
+
+	app.Get("/test", func(c *Ctx) error {
+		return c.SendString("hello etag")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+
+	if !strings.HasPrefix(w.Header().Get("ETag"), `W/"`) {
+		t.Errorf("Expected weak ETag, got '%s'", w.Header().Get("ETag"))
+	}
+}
+
+// TestCtxFresh tests Fresh with Last-Modified and ETag validators
+func TestCtxFresh(t *testing.T) {
+	app := New()
+
+	modified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	app.Get("/test", func(c *Ctx) error {
+		c.LastModified(modified)
+		c.Set("ETag", `"v1"`)
+		if c.Fresh() {
+			return c.SendStatus(304)
+		}
+		return c.SendString("content")
+	})
+
+	for name, tc := range map[string]struct {
+		header, value string
+		expected      int
+	}{
+		"etag match":     {"If-None-Match", `W/"v1"`, 304},
+		"etag mismatch":  {"If-None-Match", `"v0"`, 200},
+		"not modified":   {"If-Modified-Since", modified.Format(http.TimeFormat), 304},
+		"modified since": {"If-Modified-Since", modified.Add(-time.Hour).Format(http.TimeFormat), 200},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set(tc.header, tc.value)
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, req)
+
+		if w.Code != tc.expected {
+			t.Errorf("%s: expected status %d, got %d", name, tc.expected, w.Code)
+		}
+	}
+}
+
+// TestCtxCheckPreconditions tests 412 responses for optimistic concurrency
+func TestCtxCheckPreconditions(t *testing.T) {
+	app := New()
+
+	modified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	app.Put("/item", func(c *Ctx) error {
+		c.Set("ETag", `"v2"`)
+		c.LastModified(modified)
+		if err := c.CheckPreconditions(); err != nil {
+			return err
+		}
+		return c.SendString("updated")
+	})
+
+	for name, tc := range map[string]struct {
+		header, value string
+		expected      int
+	}{
+		"if-match current":         {"If-Match", `"v2"`, 200},
+		"if-match stale":           {"If-Match", `"v1"`, 412},
+		"if-match weak":            {"If-Match", `W/"v2"`, 412},
+		"if-none-match any":        {"If-None-Match", "*", 412},
+		"unmodified since":         {"If-Unmodified-Since", modified.Format(http.TimeFormat), 200},
+		"modified after condition": {"If-Unmodified-Since", modified.Add(-time.Hour).Format(http.TimeFormat), 412},
+	} {
+		req := httptest.NewRequest(http.MethodPut, "/item", nil)
+		req.Header.Set(tc.header, tc.value)
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, req)
+
+		if w.Code != tc.expected {
+			t.Errorf("%s: expected status %d, got %d", name, tc.expected, w.Code)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package ursa
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrIPDenied wraps ErrForbidden for requests rejected by the IPFilter
+var ErrIPDenied = fmt.Errorf("%w: ip address denied", ErrForbidden)
+
+// IPList is a set of allow and deny rules of IPv4 and IPv6 addresses and
+// CIDRs. A deny rule wins over an allow rule; when there are allow rules,
+// an address must match one of them. It is safe for concurrent use and can
+// be replaced at runtime with Set, or loaded from a file with NewIPListFile.
+type IPList struct {
+	lock  sync.RWMutex
+	allow []ipRule
+	deny  []ipRule
+
+	file     string
+	stamp    fileStamp
+	onReload func(err error)
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type ipRule struct {
+	net  *net.IPNet
+	text string
+}
+
+// NewIPList returns an IPList of the given IPs and CIDRs
+func NewIPList(allow, deny []string) (*IPList, error) {
+	l := &IPList{done: make(chan struct{})}
+	if err := l.Set(allow, deny); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// NewIPListFile returns an IPList read from file, reloaded when the file
+// changes. A negative reloadInterval disables watching; onReload, when not
+// nil, is called after each reload attempt. On error the previous rules are
+// kept. The file holds one rule per line, "allow <ip or cidr>" or
+// "deny <ip or cidr>", blank lines and lines starting with # are ignored:
+//
+//	# office and vpn
+//	allow 203.0.113.0/24
+//	allow 2001:db8::/32
+//	deny  203.0.113.66
+func NewIPListFile(file string, reloadInterval time.Duration, onReload func(err error)) (*IPList, error) {
+	if reloadInterval == 0 {
+		reloadInterval = 10 * time.Second
+	}
+
+	l := &IPList{file: file, onReload: onReload, done: make(chan struct{})}
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+
+	if reloadInterval > 0 {
+		go l.watch(reloadInterval)
+	}
+
+	return l, nil
+}
+
+// Set replaces the rules. On error the previous rules are kept.
+func (l *IPList) Set(allow, deny []string) error {
+	allowRules, err := parseIPRules(allow)
+	if err != nil {
+		return err
+	}
+
+	denyRules, err := parseIPRules(deny)
+	if err != nil {
+		return err
+	}
+
+	l.lock.Lock()
+	l.allow, l.deny = allowRules, denyRules
+	l.lock.Unlock()
+
+	return nil
+}
+
+// Reload reads the file of a list returned by NewIPListFile again
+func (l *IPList) Reload() error {
+	if l.file == "" {
+		return errors.New("ipfilter: the list has no file")
+	}
+
+	err := l.load()
+	if l.onReload != nil {
+		l.onReload(err)
+	}
+
+	return err
+}
+
+func (l *IPList) load() error {
+	info, err := os.Stat(l.file)
+	if err != nil {
+		return err
+	}
+
+	// stamped even when broken, so the watcher reports each version once
+	defer func() {
+		l.lock.Lock()
+		l.stamp = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		l.lock.Unlock()
+	}()
+
+	f, err := os.Open(l.file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var (
+		allow, deny []string
+		scanner     = bufio.NewScanner(f)
+	)
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return fmt.Errorf("ipfilter: %s:%d: expected \"allow|deny <ip or cidr>\"", l.file, n)
+		}
+
+		switch strings.ToLower(fields[0]) {
+		case "allow":
+			allow = append(allow, fields[1])
+		case "deny":
+			deny = append(deny, fields[1])
+		default:
+			return fmt.Errorf("ipfilter: %s:%d: unknown action %q", l.file, n, fields[0])
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+
+	if err = l.Set(allow, deny); err != nil {
+		return fmt.Errorf("ipfilter: %s: %w", l.file, err)
+	}
+
+	return nil
+}
+
+func (l *IPList) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+			info, err := os.Stat(l.file)
+			if err != nil {
+				continue
+			}
+
+			l.lock.RLock()
+			changed := l.stamp != fileStamp{modTime: info.ModTime(), size: info.Size()}
+			l.lock.RUnlock()
+
+			if changed {
+				_ = l.Reload()
+			}
+		}
+	}
+}
+
+// Close stops watching the file
+func (l *IPList) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return nil
+}
+
+// Check reports whether ip is allowed, and the rule deciding it: the
+// matching rule, or "default" when no rule matches.
+func (l *IPList) Check(ip net.IP) (allowed bool, rule string) {
+	if ip == nil {
+		return false, "invalid address"
+	}
+
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	for _, r := range l.deny {
+		if r.net.Contains(ip) {
+			return false, "deny " + r.text
+		}
+	}
+
+	for _, r := range l.allow {
+		if r.net.Contains(ip) {
+			return true, "allow " + r.text
+		}
+	}
+
+	return len(l.allow) == 0, "default"
+}
+
+func parseIPRules(values []string) ([]ipRule, error) {
+	rules := make([]ipRule, 0, len(values))
+
+	for _, value := range values {
+		ipNet, err := parseIPNet(value)
+		if err != nil {
+			return nil, fmt.Errorf("ipfilter: invalid rule %q", value)
+		}
+		rules = append(rules, ipRule{net: ipNet, text: strings.TrimSpace(value)})
+	}
+
+	return rules, nil
+}
+
+// IPDecision is an entry of the IPFilter decision log
+type IPDecision struct {
+	Time    time.Time `json:"time"`
+	TraceID string    `json:"trace_id,omitempty"`
+	IP      string    `json:"ip"`
+	Method  string    `json:"method"`
+	Path    string    `json:"path"`
+	Allowed bool      `json:"allowed"`
+	Rule    string    `json:"rule"`
+}
+
+// IPDecisionLogger returns an IPFilterConfig.OnDecision writing decisions
+// to w as JSON lines, for audits
+func IPDecisionLogger(w io.Writer) func(c *Ctx, d IPDecision) {
+	var lock sync.Mutex
+
+	return func(c *Ctx, d IPDecision) {
+		bs, err := json.Marshal(d)
+		if err != nil {
+			return
+		}
+
+		lock.Lock()
+		_, _ = w.Write(append(bs, '\n'))
+		lock.Unlock()
+	}
+}
+
+// IPFilterConfig defines the config for IPFilter middleware
+type IPFilterConfig struct {
+	// List holds the rules, and may be shared by several filters or
+	// loaded from a file, see NewIPListFile.
+	// Default: a list of Allow and Deny
+	List *IPList
+
+	// Allow and Deny are the IPs and CIDRs of the default List.
+	// Default: nil
+	Allow []string
+	Deny  []string
+
+	// IP returns the client address checked against the list.
+	// Default: c.IP(true), resolved through Config.TrustedProxies
+	IP func(c *Ctx) string
+
+	// OnDecision is called for every request checked, allowed or denied,
+	// see IPDecisionLogger.
+	// Default: nil
+	OnDecision func(c *Ctx, d IPDecision)
+
+	// Next defines a function to skip this middleware when returning true.
+	// Default: nil
+	Next func(c *Ctx) bool
+
+	// Forbidden is called when the address is denied, with ErrIPDenied.
+	// Default: responds 403 "Forbidden"
+	Forbidden func(c *Ctx, err error) error
+}
+
+// DefaultIPFilterConfig is the default IPFilter middleware config
+var DefaultIPFilterConfig = IPFilterConfig{
+	IP: func(c *Ctx) string {
+		return c.IP(true)
+	},
+	Forbidden: func(c *Ctx, err error) error {
+		return c.Status(http.StatusForbidden).SendString("Forbidden")
+	},
+}
+
+// NewIPFilter returns an IPFilter middleware allowing only the given IPs
+// and CIDRs, e.g. on an admin route group
+func NewIPFilter(allow ...string) HandlerFunc {
+	config := DefaultIPFilterConfig
+	config.Allow = allow
+
+	return NewIPFilterWithConfig(config)
+}
+
+// NewIPFilterWithConfig returns an IPFilter middleware with custom config.
+// It panics on invalid Allow or Deny rules.
+func NewIPFilterWithConfig(config IPFilterConfig) HandlerFunc {
+	// Set defaults
+	if config.List == nil {
+		list, err := NewIPList(config.Allow, config.Deny)
+		elsePanic(err == nil, fmt.Sprint(err))
+		config.List = list
+	}
+	if config.IP == nil {
+		config.IP = DefaultIPFilterConfig.IP
+	}
+	if config.Forbidden == nil {
+		config.Forbidden = DefaultIPFilterConfig.Forbidden
+	}
+
+	return func(c *Ctx) error {
+		if config.Next != nil && config.Next(c) {
+			return c.Next()
+		}
+
+		ip := config.IP(c)
+		allowed, rule := config.List.Check(net.ParseIP(ip))
+
+		if config.OnDecision != nil {
+			traceID, _ := c.Context().Value(TraceKey).(string)
+			config.OnDecision(c, IPDecision{
+				Time:    time.Now(),
+				TraceID: traceID,
+				IP:      ip,
+				Method:  c.Method(),
+				Path:    c.Path(),
+				Allowed: allowed,
+				Rule:    rule,
+			})
+		}
+
+		if !allowed {
+			return config.Forbidden(c, ErrIPDenied)
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,140 @@
+package ursa
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func doIPFilterRequest(app *App, path, remote string, headers ...string) int {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = remote
+	return serveRequest(app, req, headers...).Code
+}
+
+// TestIPFilterMiddleware tests allow and deny rules per route group
+func TestIPFilterMiddleware(t *testing.T) {
+	var audit bytes.Buffer
+
+	app := New(Config{DisableLogger: true, TrustedProxies: []string{"10.0.0.1"}})
+	app.Get("/", func(c *Ctx) error { return c.SendString("ok") })
+
+	admin := app.Group("/admin", NewIPFilterWithConfig(IPFilterConfig{
+		Allow:      []string{"192.168.0.0/16", "2001:db8::/32"},
+		Deny:       []string{"192.168.1.66"},
+		OnDecision: IPDecisionLogger(&audit),
+	}))
+	admin.Get("/stats", func(c *Ctx) error { return c.SendString("admin") })
+
+	blocked := app.Group("/public", NewIPFilterWithConfig(IPFilterConfig{Deny: []string{"203.0.113.0/24"}}))
+	blocked.Get("/page", func(c *Ctx) error { return c.SendString("public") })
+
+	cases := []struct {
+		path   string
+		remote string
+		want   int
+	}{
+		{"/", "203.0.113.9:1234", 200},
+		{"/admin/stats", "192.168.1.10:1234", 200},
+		{"/admin/stats", "[2001:db8::7]:1234", 200},
+		{"/admin/stats", "192.168.1.66:1234", 403},
+		{"/admin/stats", "203.0.113.9:1234", 403},
+		{"/public/page", "198.51.100.7:1234", 200},
+		{"/public/page", "203.0.113.9:1234", 403},
+	}
+
+	for _, tc := range cases {
+		if got := doIPFilterRequest(app, tc.path, tc.remote); got != tc.want {
+			t.Errorf("%s from %s: expected %d, got %d", tc.path, tc.remote, tc.want, got)
+		}
+	}
+
+	// the client behind a trusted proxy is checked, not the proxy
+	if got := doIPFilterRequest(app, "/admin/stats", "10.0.0.1:1234", "X-Forwarded-For", "203.0.113.9"); got != 403 {
+		t.Errorf("Expected forwarded client denied, got %d", got)
+	}
+	if got := doIPFilterRequest(app, "/admin/stats", "203.0.113.9:1234", "X-Forwarded-For", "192.168.1.10"); got != 403 {
+		t.Errorf("Expected forwarding header of untrusted peer ignored, got %d", got)
+	}
+
+	var decisions []IPDecision
+	dec := json.NewDecoder(&audit)
+	for dec.More() {
+		var d IPDecision
+		if err := dec.Decode(&d); err != nil {
+			t.Fatal(err)
+		}
+		decisions = append(decisions, d)
+	}
+
+	if len(decisions) != 6 {
+		t.Fatalf("Expected 6 decisions, got %d", len(decisions))
+	}
+	if d := decisions[2]; d.Allowed || d.IP != "192.168.1.66" || d.Rule != "deny 192.168.1.66" || d.Path != "/admin/stats" {
+		t.Errorf("Unexpected decision %+v", d)
+	}
+	if d := decisions[0]; !d.Allowed || d.Rule != "allow 192.168.0.0/16" {
+		t.Errorf("Unexpected decision %+v", d)
+	}
+}
+
+// TestIPListFile tests loading and reloading rules from a file
+func TestIPListFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "ips.txt")
+	if err := os.WriteFile(file, []byte("# admins\nallow 192.168.0.0/16\n\ndeny 192.168.1.66\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	reloads := make(chan error, 8)
+	list, err := NewIPListFile(file, 10*time.Millisecond, func(err error) { reloads <- err })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer list.Close()
+	<-reloads
+
+	app := New(Config{DisableLogger: true})
+	app.Get("/", NewIPFilterWithConfig(IPFilterConfig{List: list}), func(c *Ctx) error { return c.SendString("ok") })
+
+	if got := doIPFilterRequest(app, "/", "192.168.1.10:1234"); got != 200 {
+		t.Errorf("Expected allowed, got %d", got)
+	}
+	if got := doIPFilterRequest(app, "/", "192.168.1.66:1234"); got != 403 {
+		t.Errorf("Expected denied, got %d", got)
+	}
+
+	// a broken file keeps the previous rules
+	if err = os.WriteFile(file, []byte("allow not-an-ip\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = <-reloads; err == nil {
+		t.Error("Expected reload error for a broken file")
+	}
+	if got := doIPFilterRequest(app, "/", "192.168.1.10:1234"); got != 200 {
+		t.Errorf("Expected previous rules kept, got %d", got)
+	}
+	select {
+	case err = <-reloads:
+		t.Errorf("Expected a broken file reported once, got %v again", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err = os.WriteFile(file, []byte("allow 203.0.113.0/24\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = <-reloads; err != nil {
+		t.Fatalf("Expected reload, got %v", err)
+	}
+
+	if got := doIPFilterRequest(app, "/", "192.168.1.10:1234"); got != 403 {
+		t.Errorf("Expected reloaded rules to deny, got %d", got)
+	}
+	if got := doIPFilterRequest(app, "/", "203.0.113.9:1234"); got != 200 {
+		t.Errorf("Expected reloaded rules to allow, got %d", got)
+	}
+}
@@ -0,0 +1,682 @@
+package ursa
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	JWTAlgHS256 = "HS256"
+	JWTAlgRS256 = "RS256"
+	JWTAlgES256 = "ES256"
+	JWTAlgEdDSA = "EdDSA"
+)
+
+// JWTClaimsKey is the default Locals key of the JWTClaims of a verified token
+const JWTClaimsKey = "ursa.jwt"
+
+var (
+	ErrJWTMalformed   = errors.New("jwt: malformed token")
+	ErrJWTAlgorithm   = errors.New("jwt: unexpected signing algorithm")
+	ErrJWTKeyNotFound = errors.New("jwt: signing key not found")
+	ErrJWTSignature   = errors.New("jwt: invalid signature")
+	ErrJWTExpired     = errors.New("jwt: token is expired")
+	ErrJWTNotValidYet = errors.New("jwt: token is not valid yet")
+	ErrJWTIssuer      = errors.New("jwt: invalid issuer")
+	ErrJWTAudience    = errors.New("jwt: invalid audience")
+	errJWTKeyType     = errors.New("jwt: unsupported key type")
+)
+
+// JWTClaims are the decoded claims of a token, numbers are float64.
+type JWTClaims map[string]any
+
+// Subject returns the "sub" claim
+func (cl JWTClaims) Subject() string {
+	sub, _ := cl["sub"].(string)
+	return sub
+}
+
+// JWTConfig defines the config for JWT middleware. At least one of Secret,
+// PublicKey, JWKSURL or JWKSFile is required.
+type JWTConfig struct {
+	// Secret is the HS256 key.
+	Secret []byte
+
+	// PublicKey is the RS256, ES256 or EdDSA key, one of *rsa.PublicKey,
+	// *ecdsa.PublicKey (P-256) or ed25519.PublicKey.
+	PublicKey crypto.PublicKey
+
+	// JWKSURL and JWKSFile load the public keys from a JSON Web Key Set,
+	// selected by the "kid" header of tokens.
+	JWKSURL  string
+	JWKSFile string
+
+	// JWKSRefresh is how long a loaded key set is used before reloading
+	// it. Unknown key IDs trigger a reload at most every 10 seconds.
+	// Default: 1 hour
+	JWKSRefresh time.Duration
+
+	// Algorithms lists the accepted "alg" headers.
+	// Default: HS256 with Secret, and the algorithms of PublicKey or
+	// RS256, ES256 and EdDSA with a key set
+	Algorithms []string
+
+	// Issuer, when set, must equal the "iss" claim.
+	Issuer string
+
+	// Audience, when set, must be in the "aud" claim.
+	Audience string
+
+	// Leeway tolerates clock skew on the "exp" and "nbf" claims.
+	// Default: 0
+	Leeway time.Duration
+
+	// TokenLookup lists where requests carry the token, as comma-separated
+	// "<source>:<name>" pairs tried in order, the sources being "header",
+	// "query", "form" and "cookie".
+	// Default: "header:Authorization"
+	TokenLookup string
+
+	// AuthScheme is the scheme preceding tokens read from headers.
+	// Default: "Bearer" with the default TokenLookup, "" otherwise
+	AuthScheme string
+
+	// ContextKey is the Locals key of the JWTClaims.
+	// Default: JWTClaimsKey
+	ContextKey string
+
+	// Next defines a function to skip this middleware when returning true.
+	// Default: nil
+	Next func(c *Ctx) bool
+
+	// Unauthorized is called when the token is missing or invalid, with
+	// ErrMissingCredentials or one of the ErrJWT errors.
+	// Default: DefaultUnauthorized
+	Unauthorized func(c *Ctx, err error) error
+}
+
+// DefaultJWTConfig is the default JWT middleware config
+var DefaultJWTConfig = JWTConfig{
+	JWKSRefresh:  time.Hour,
+	TokenLookup:  "header:Authorization",
+	AuthScheme:   "Bearer",
+	ContextKey:   JWTClaimsKey,
+	Unauthorized: DefaultUnauthorized,
+}
+
+// NewJWT returns a JWT middleware verifying HS256 tokens signed with secret
+func NewJWT(secret []byte) HandlerFunc {
+	config := DefaultJWTConfig
+	config.Secret = secret
+
+	return NewJWTWithConfig(config)
+}
+
+// NewJWTWithConfig returns a JWT middleware with custom config. The claims
+// of verified tokens are stored in Locals under ContextKey.
+func NewJWTWithConfig(config JWTConfig) HandlerFunc {
+	elsePanic(
+		len(config.Secret) > 0 || config.PublicKey != nil || config.JWKSURL != "" || config.JWKSFile != "",
+		"jwt: one of Secret, PublicKey, JWKSURL or JWKSFile is required",
+	)
+
+	// Set defaults
+	if config.JWKSRefresh <= 0 {
+		config.JWKSRefresh = DefaultJWTConfig.JWKSRefresh
+	}
+	if config.TokenLookup == "" {
+		config.TokenLookup = DefaultJWTConfig.TokenLookup
+		if config.AuthScheme == "" {
+			config.AuthScheme = DefaultJWTConfig.AuthScheme
+		}
+	}
+	if config.ContextKey == "" {
+		config.ContextKey = DefaultJWTConfig.ContextKey
+	}
+	if config.Unauthorized == nil {
+		config.Unauthorized = DefaultJWTConfig.Unauthorized
+	}
+
+	v := &jwtVerifier{config: &config, algorithms: make(map[string]bool)}
+
+	if config.JWKSURL != "" || config.JWKSFile != "" {
+		v.keySet = &jwks{
+			url:     config.JWKSURL,
+			file:    config.JWKSFile,
+			refresh: config.JWKSRefresh,
+			client:  &http.Client{Timeout: 10 * time.Second},
+		}
+	}
+
+	algorithms := config.Algorithms
+	if len(algorithms) == 0 {
+		if len(config.Secret) > 0 {
+			algorithms = append(algorithms, JWTAlgHS256)
+		}
+		if alg := jwtKeyAlgorithm(config.PublicKey); alg != "" {
+			algorithms = append(algorithms, alg)
+		}
+		if v.keySet != nil {
+			algorithms = append(algorithms, JWTAlgRS256, JWTAlgES256, JWTAlgEdDSA)
+		}
+	}
+	for _, alg := range algorithms {
+		v.algorithms[alg] = true
+	}
+
+	var (
+		extractors = parseKeyLookup(config.TokenLookup, config.AuthScheme)
+		challenge  = bearerChallenge(config.AuthScheme, config.TokenLookup)
+	)
+
+	return func(c *Ctx) error {
+		if config.Next != nil && config.Next(c) {
+			return c.Next()
+		}
+
+		token := lookupKey(c, extractors)
+		if token == "" {
+			if challenge != "" {
+				c.Set("WWW-Authenticate", challenge)
+			}
+			return config.Unauthorized(c, ErrMissingCredentials)
+		}
+
+		claims, err := v.verify(token, time.Now())
+		if err != nil {
+			if challenge != "" {
+				c.Set("WWW-Authenticate", challenge+`, error="invalid_token"`)
+			}
+			return config.Unauthorized(c, err)
+		}
+
+		c.Locals(config.ContextKey, claims)
+
+		return c.Next()
+	}
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+type jwtVerifier struct {
+	config     *JWTConfig
+	algorithms map[string]bool
+	keySet     *jwks
+}
+
+func (v *jwtVerifier) verify(token string, now time.Time) (JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrJWTMalformed
+	}
+
+	var header jwtHeader
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, ErrJWTMalformed
+	}
+
+	if !v.algorithms[header.Alg] {
+		return nil, ErrJWTAlgorithm
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrJWTMalformed
+	}
+
+	// the key is chosen by algorithm family, so that a token cannot make
+	// a public key be used as an HMAC secret
+	var key any
+	switch {
+	case header.Alg == JWTAlgHS256:
+		key = v.config.Secret
+	case v.keySet != nil:
+		k, err := v.keySet.get(header.Kid)
+		if err != nil {
+			return nil, err
+		}
+		if k.alg != "" && k.alg != header.Alg {
+			return nil, ErrJWTAlgorithm
+		}
+		key = k.key
+	default:
+		key = v.config.PublicKey
+	}
+
+	if err = verifyJWTSignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	claims := make(JWTClaims)
+	if err = decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, ErrJWTMalformed
+	}
+
+	return claims, v.validate(claims, now)
+}
+
+func (v *jwtVerifier) validate(claims JWTClaims, now time.Time) error {
+	leeway := v.config.Leeway.Seconds()
+	unix := float64(now.UnixNano()) / float64(time.Second)
+
+	if exp, ok := claims["exp"]; ok {
+		t, ok := exp.(float64)
+		if !ok {
+			return ErrJWTMalformed
+		}
+		if unix > t+leeway {
+			return ErrJWTExpired
+		}
+	}
+
+	if nbf, ok := claims["nbf"]; ok {
+		t, ok := nbf.(float64)
+		if !ok {
+			return ErrJWTMalformed
+		}
+		if unix+leeway < t {
+			return ErrJWTNotValidYet
+		}
+	}
+
+	if v.config.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.config.Issuer {
+			return ErrJWTIssuer
+		}
+	}
+
+	if v.config.Audience != "" {
+		switch aud := claims["aud"].(type) {
+		case string:
+			if aud == v.config.Audience {
+				return nil
+			}
+		case []any:
+			for _, a := range aud {
+				if a == v.config.Audience {
+					return nil
+				}
+			}
+		}
+
+		return ErrJWTAudience
+	}
+
+	return nil
+}
+
+func decodeJWTPart(part string, out any) error {
+	bs, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(bs, out)
+}
+
+func verifyJWTSignature(alg string, key any, input string, sig []byte) error {
+	hash := sha256.Sum256([]byte(input))
+
+	switch alg {
+	case JWTAlgHS256:
+		secret, ok := key.([]byte)
+		if !ok || len(secret) == 0 {
+			return ErrJWTKeyNotFound
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(input))
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return ErrJWTSignature
+		}
+	case JWTAlgRS256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrJWTKeyNotFound
+		}
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, hash[:], sig) != nil {
+			return ErrJWTSignature
+		}
+	case JWTAlgES256:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != elliptic.P256() {
+			return ErrJWTKeyNotFound
+		}
+		if len(sig) != 64 {
+			return ErrJWTSignature
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, hash[:], r, s) {
+			return ErrJWTSignature
+		}
+	case JWTAlgEdDSA:
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok || len(pub) != ed25519.PublicKeySize {
+			return ErrJWTKeyNotFound
+		}
+		if !ed25519.Verify(pub, []byte(input), sig) {
+			return ErrJWTSignature
+		}
+	default:
+		return ErrJWTAlgorithm
+	}
+
+	return nil
+}
+
+// jwtKeyAlgorithm returns the algorithm of a public key, "" if unsupported
+func jwtKeyAlgorithm(key crypto.PublicKey) string {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return JWTAlgRS256
+	case *ecdsa.PublicKey:
+		if k.Curve == elliptic.P256() {
+			return JWTAlgES256
+		}
+	case ed25519.PublicKey:
+		return JWTAlgEdDSA
+	}
+
+	return ""
+}
+
+// SignJWT returns a token of claims signed with alg. The key is a []byte
+// for HS256, a *rsa.PrivateKey for RS256, a *ecdsa.PrivateKey (P-256) for
+// ES256 or an ed25519.PrivateKey for EdDSA. The optional kid is set in
+// the header to select the key in a key set.
+func SignJWT(alg string, key any, claims any, kid ...string) (string, error) {
+	header := jwtHeader{Alg: alg, Typ: "JWT"}
+	if len(kid) > 0 {
+		header.Kid = kid[0]
+	}
+
+	hbs, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+
+	cbs, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	input := base64.RawURLEncoding.EncodeToString(hbs) + "." + base64.RawURLEncoding.EncodeToString(cbs)
+	hash := sha256.Sum256([]byte(input))
+
+	var sig []byte
+
+	switch k := key.(type) {
+	case []byte:
+		if alg != JWTAlgHS256 {
+			return "", ErrJWTAlgorithm
+		}
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(input))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		if alg != JWTAlgRS256 {
+			return "", ErrJWTAlgorithm
+		}
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, hash[:]); err != nil {
+			return "", err
+		}
+	case *ecdsa.PrivateKey:
+		if alg != JWTAlgES256 || k.Curve != elliptic.P256() {
+			return "", ErrJWTAlgorithm
+		}
+		r, s, err := ecdsa.Sign(rand.Reader, k, hash[:])
+		if err != nil {
+			return "", err
+		}
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	case ed25519.PrivateKey:
+		if alg != JWTAlgEdDSA {
+			return "", ErrJWTAlgorithm
+		}
+		sig = ed25519.Sign(k, []byte(input))
+	default:
+		return "", errJWTKeyType
+	}
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+const jwksMissRefresh = 10 * time.Second
+
+// jwks is a JSON Web Key Set loaded from a file or URL and cached
+type jwks struct {
+	url     string
+	file    string
+	refresh time.Duration
+	client  *http.Client
+
+	lock     sync.RWMutex
+	keys     map[string]jwk
+	loaded   time.Time
+	lastMiss time.Time
+	group    singleflight.Group
+}
+
+type jwk struct {
+	alg string
+	key crypto.PublicKey
+}
+
+func (s *jwks) get(kid string) (jwk, error) {
+	now := time.Now()
+
+	s.lock.RLock()
+	keys, loaded := s.keys, s.loaded
+	s.lock.RUnlock()
+
+	if keys == nil || now.Sub(loaded) > s.refresh {
+		// a failed reload keeps serving the previous keys
+		if err := s.load(); err != nil && keys == nil {
+			return jwk{}, err
+		}
+	}
+
+	if k, ok := s.find(kid); ok {
+		return k, nil
+	}
+
+	// the issuer may have rotated its keys since the last load
+	s.lock.Lock()
+	retry := now.Sub(s.lastMiss) > jwksMissRefresh
+	if retry {
+		s.lastMiss = now
+	}
+	s.lock.Unlock()
+
+	if retry && s.load() == nil {
+		if k, ok := s.find(kid); ok {
+			return k, nil
+		}
+	}
+
+	return jwk{}, ErrJWTKeyNotFound
+}
+
+func (s *jwks) find(kid string) (jwk, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if k, ok := s.keys[kid]; ok {
+		return k, true
+	}
+
+	// a token without kid is accepted when the set holds a single key
+	if kid == "" && len(s.keys) == 1 {
+		for _, k := range s.keys {
+			return k, true
+		}
+	}
+
+	return jwk{}, false
+}
+
+func (s *jwks) load() error {
+	_, err, _ := s.group.Do("load", func() (any, error) {
+		bs, err := s.read()
+		if err != nil {
+			return nil, err
+		}
+
+		keys, err := parseJWKS(bs)
+		if err != nil {
+			return nil, err
+		}
+
+		s.lock.Lock()
+		s.keys = keys
+		s.loaded = time.Now()
+		s.lock.Unlock()
+
+		return nil, nil
+	})
+
+	return err
+}
+
+func (s *jwks) read() ([]byte, error) {
+	if s.file != "" {
+		return os.ReadFile(s.file)
+	}
+
+	resp, err := s.client.Get(s.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwt: fetch key set: unexpected status %d", resp.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// parseJWKS parses a key set, skipping the keys which are not for
+// signatures or of an unsupported type
+func parseJWKS(bs []byte) (map[string]jwk, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			Alg string `json:"alg"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+
+	if err := json.Unmarshal(bs, &set); err != nil {
+		return nil, fmt.Errorf("jwt: parse key set: %w", err)
+	}
+
+	keys := make(map[string]jwk, len(set.Keys))
+
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		var (
+			key crypto.PublicKey
+			err error
+		)
+
+		switch {
+		case k.Kty == "RSA":
+			key, err = parseRSAJWK(k.N, k.E)
+		case k.Kty == "EC" && k.Crv == "P-256":
+			key, err = parseECJWK(k.X, k.Y)
+		case k.Kty == "OKP" && k.Crv == "Ed25519":
+			var x []byte
+			if x, err = base64.RawURLEncoding.DecodeString(k.X); err == nil && len(x) != ed25519.PublicKeySize {
+				err = errJWTKeyType
+			}
+			key = ed25519.PublicKey(x)
+		default:
+			continue
+		}
+
+		if err != nil {
+			continue
+		}
+
+		keys[k.Kid] = jwk{alg: k.Alg, key: key}
+	}
+
+	return keys, nil
+}
+
+func parseRSAJWK(n, e string) (*rsa.PublicKey, error) {
+	nb, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, err
+	}
+
+	eb, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil || len(eb) == 0 || len(eb) > 4 {
+		return nil, errJWTKeyType
+	}
+
+	exp := 0
+	for _, b := range eb {
+		exp = exp<<8 | int(b)
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(nb), E: exp}, nil
+}
+
+func parseECJWK(x, y string) (*ecdsa.PublicKey, error) {
+	xb, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil || len(xb) != 32 {
+		return nil, errJWTKeyType
+	}
+
+	yb, err := base64.RawURLEncoding.DecodeString(y)
+	if err != nil || len(yb) != 32 {
+		return nil, errJWTKeyType
+	}
+
+	// reject points which are not on the curve
+	if _, err = ecdh.P256().NewPublicKey(append(append([]byte{4}, xb...), yb...)); err != nil {
+		return nil, err
+	}
+
+	return &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(xb),
+		Y:     new(big.Int).SetBytes(yb),
+	}, nil
+}
@@ -0,0 +1,162 @@
+package ursa
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newJWTApp(config JWTConfig) *App {
+	app := New()
+	app.Use(NewJWTWithConfig(config))
+	app.Get("/", func(c *Ctx) error {
+		return c.SendString(c.Locals(JWTClaimsKey).(JWTClaims).Subject())
+	})
+	return app
+}
+
+// TestJWTClaims tests HS256 tokens and the registered claims validation
+func TestJWTClaims(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	app := newJWTApp(JWTConfig{Secret: secret, Issuer: "ursa", Audience: "api"})
+
+	now := time.Now().Unix()
+	sign := func(claims Map) string {
+		token, err := SignJWT(JWTAlgHS256, secret, claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	valid := sign(Map{"sub": "alice", "iss": "ursa", "aud": []string{"web", "api"}, "exp": now + 60})
+	if w := doRequest(app, http.MethodGet, "/", nil, "Authorization", "Bearer "+valid); w.Code != http.StatusOK || w.Body.String() != "alice" {
+		t.Errorf("Expected 200 'alice', got %d '%s'", w.Code, w.Body.String())
+	}
+
+	if w := doRequest(app, http.MethodGet, "/", nil); w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != "Bearer" {
+		t.Errorf("Expected 401 with challenge, got %d '%s'", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+
+	invalid := map[string]string{
+		"expired":   sign(Map{"sub": "alice", "iss": "ursa", "aud": "api", "exp": now - 60}),
+		"not valid": sign(Map{"sub": "alice", "iss": "ursa", "aud": "api", "nbf": now + 60}),
+		"issuer":    sign(Map{"sub": "alice", "iss": "other", "aud": "api"}),
+		"audience":  sign(Map{"sub": "alice", "iss": "ursa", "aud": "web"}),
+		"tampered":  valid[:len(valid)-2] + "xx",
+		"malformed": "not.a.token",
+	}
+
+	other, _ := SignJWT(JWTAlgHS256, []byte("another secret of enough length"), Map{"sub": "alice", "iss": "ursa", "aud": "api"})
+	invalid["other secret"] = other
+
+	// alg none must never be accepted
+	parts := strings.Split(valid, ".")
+	invalid["none"] = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + parts[1] + "."
+
+	for name, token := range invalid {
+		if w := doRequest(app, http.MethodGet, "/", nil, "Authorization", "Bearer "+token); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", name, w.Code)
+		}
+	}
+}
+
+// TestJWTAlgorithms tests the asymmetric algorithms and algorithm confusion
+func TestJWTAlgorithms(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	cases := []struct {
+		alg  string
+		pub  any
+		priv any
+	}{
+		{JWTAlgRS256, &rsaKey.PublicKey, rsaKey},
+		{JWTAlgES256, &ecKey.PublicKey, ecKey},
+		{JWTAlgEdDSA, edPub, edKey},
+	}
+
+	for _, tc := range cases {
+		app := newJWTApp(JWTConfig{PublicKey: tc.pub})
+
+		token, err := SignJWT(tc.alg, tc.priv, Map{"sub": tc.alg})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if w := doRequest(app, http.MethodGet, "/", nil, "Authorization", "Bearer "+token); w.Code != http.StatusOK || w.Body.String() != tc.alg {
+			t.Errorf("%s: expected 200, got %d '%s'", tc.alg, w.Code, w.Body.String())
+		}
+
+		// an HS256 token must not be verified with the public key
+		forged, _ := SignJWT(JWTAlgHS256, []byte("public key bytes"), Map{"sub": tc.alg})
+		if w := doRequest(app, http.MethodGet, "/", nil, "Authorization", "Bearer "+forged); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401 for HS256 token, got %d", tc.alg, w.Code)
+		}
+	}
+}
+
+// TestJWTKeySet tests key sets loaded from a file and a URL
+func TestJWTKeySet(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	b64 := func(bs []byte) string { return base64.RawURLEncoding.EncodeToString(bs) }
+	set, _ := json.Marshal(Map{"keys": []Map{
+		{"kty": "RSA", "kid": "rsa", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": b64(edPub)},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": b64(rsaKey.N.Bytes()), "e": "AQAB"},
+	}})
+
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(file, set, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var fetched int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched++
+		_, _ = w.Write(set)
+	}))
+	defer server.Close()
+
+	for _, config := range []JWTConfig{{JWKSFile: file}, {JWKSURL: server.URL}} {
+		app := newJWTApp(config)
+
+		for kid, key := range map[string]any{"rsa": rsaKey, "ec": ecKey, "ed": edKey} {
+			alg := map[string]string{"rsa": JWTAlgRS256, "ec": JWTAlgES256, "ed": JWTAlgEdDSA}[kid]
+			token, _ := SignJWT(alg, key, Map{"sub": kid}, kid)
+
+			if w := doRequest(app, http.MethodGet, "/", nil, "Authorization", "Bearer "+token); w.Code != http.StatusOK || w.Body.String() != kid {
+				t.Errorf("%s: expected 200, got %d '%s'", kid, w.Code, w.Body.String())
+			}
+		}
+
+		for _, kid := range []string{"enc", "unknown"} {
+			token, _ := SignJWT(JWTAlgRS256, rsaKey, Map{"sub": kid}, kid)
+			if w := doRequest(app, http.MethodGet, "/", nil, "Authorization", "Bearer "+token); w.Code != http.StatusUnauthorized {
+				t.Errorf("%s: expected 401, got %d", kid, w.Code)
+			}
+		}
+	}
+
+	// one initial load and one reload for the unknown kid
+	if fetched != 2 {
+		t.Errorf("Expected key set fetched twice, got %d", fetched)
+	}
+}
@@ -0,0 +1,298 @@
+package ursa
+
+import (
+	"encoding/binary"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// LimiterAlgorithm selects how the Limiter middleware counts requests
+type LimiterAlgorithm int
+
+const (
+	// LimiterSlidingWindow weights the previous window's count by how much
+	// of it still overlaps the sliding window, smoothing out bursts at
+	// window boundaries.
+	LimiterSlidingWindow LimiterAlgorithm = iota
+
+	// LimiterFixedWindow allows Max requests per aligned Expiration window.
+	LimiterFixedWindow
+
+	// LimiterTokenBucket refills Max tokens per Expiration and allows
+	// bursts of up to Max requests.
+	LimiterTokenBucket
+)
+
+// LimiterConfig defines the config for Limiter middleware
+type LimiterConfig struct {
+	// Max is the number of requests allowed per Expiration for a key,
+	// and the bucket capacity for LimiterTokenBucket.
+	// Default: 60
+	Max int
+
+	// Expiration is the window length, or the time to refill an empty
+	// bucket for LimiterTokenBucket.
+	// Default: 1 minute
+	Expiration time.Duration
+
+	// Algorithm is the counting algorithm.
+	// Default: LimiterSlidingWindow
+	Algorithm LimiterAlgorithm
+
+	// KeyGenerator returns the key requests are counted under.
+	// See LimiterKeyByIP, LimiterKeyByHeader and LimiterKeyByRoute.
+	// Default: LimiterKeyByIP
+	KeyGenerator func(c *Ctx) string
+
+	// Next defines a function to skip this middleware when returning true.
+	// Default: nil
+	Next func(c *Ctx) bool
+
+	// LimitReached is called when a request is rejected, after the
+	// Retry-After header is set.
+	// Default: responds 429 "Too Many Requests"
+	LimitReached HandlerFunc
+
+	// Storage keeps the counters. Updates are serialized per key within
+	// one process only, so a shared backend may let a few extra requests
+	// through under concurrency across instances.
+	// Default: NewMemoryStorage()
+	Storage Storage
+
+	// DisableHeaders disables the RateLimit-Limit, RateLimit-Remaining
+	// and RateLimit-Reset response headers.
+	// Default: false
+	DisableHeaders bool
+}
+
+// DefaultLimiterConfig is the default Limiter middleware config
+var DefaultLimiterConfig = LimiterConfig{
+	Max:          60,
+	Expiration:   time.Minute,
+	Algorithm:    LimiterSlidingWindow,
+	KeyGenerator: LimiterKeyByIP,
+	LimitReached: func(c *Ctx) error {
+		return c.Status(http.StatusTooManyRequests).SendString("Too Many Requests")
+	},
+}
+
+// LimiterKeyByIP counts requests per client IP, resolved through
+// Config.TrustedProxies
+func LimiterKeyByIP(c *Ctx) string {
+	return c.IP(true)
+}
+
+// LimiterKeyByHeader counts requests per value of the given request header,
+// e.g. an API key. Requests without the header share the same counter.
+func LimiterKeyByHeader(header string) func(c *Ctx) string {
+	return func(c *Ctx) string {
+		return header + ":" + c.Get(header)
+	}
+}
+
+// LimiterKeyByRoute counts requests per matched route, for all clients together
+func LimiterKeyByRoute(c *Ctx) string {
+	return c.Method() + " " + c.FullPath()
+}
+
+// NewLimiter returns a Limiter middleware allowing max requests per expiration for each client IP
+func NewLimiter(max int, expiration time.Duration) HandlerFunc {
+	config := DefaultLimiterConfig
+	config.Max = max
+	config.Expiration = expiration
+
+	return NewLimiterWithConfig(config)
+}
+
+// NewLimiterWithConfig returns a Limiter middleware with custom config
+func NewLimiterWithConfig(config LimiterConfig) HandlerFunc {
+	// Set defaults
+	if config.Max <= 0 {
+		config.Max = DefaultLimiterConfig.Max
+	}
+	if config.Expiration <= 0 {
+		config.Expiration = DefaultLimiterConfig.Expiration
+	}
+	if config.KeyGenerator == nil {
+		config.KeyGenerator = DefaultLimiterConfig.KeyGenerator
+	}
+	if config.LimitReached == nil {
+		config.LimitReached = DefaultLimiterConfig.LimitReached
+	}
+	if config.Storage == nil {
+		config.Storage = NewMemoryStorage()
+	}
+
+	var (
+		locks [256]sync.Mutex
+		max   = strconv.Itoa(config.Max)
+	)
+
+	return func(c *Ctx) error {
+		if config.Next != nil && config.Next(c) {
+			return c.Next()
+		}
+
+		key := "limiter:" + config.KeyGenerator(c)
+		lock := &locks[hashKey(key)%uint32(len(locks))]
+
+		lock.Lock()
+		res, err := takeLimiter(config, key, time.Now().UnixNano())
+		lock.Unlock()
+
+		if err != nil {
+			return err
+		}
+
+		if !config.DisableHeaders {
+			c.Set("RateLimit-Limit", max)
+			c.Set("RateLimit-Remaining", strconv.Itoa(res.remaining))
+			c.Set("RateLimit-Reset", strconv.FormatInt(ceilSeconds(res.reset), 10))
+		}
+
+		if !res.allowed {
+			c.Set("Retry-After", strconv.FormatInt(ceilSeconds(res.reset), 10))
+			return config.LimitReached(c)
+		}
+
+		return c.Next()
+	}
+}
+
+type limiterResult struct {
+	allowed   bool
+	remaining int
+	reset     time.Duration
+}
+
+// limiterState is the counter persisted in Storage. For the window
+// algorithms a is the window start and b, c the previous and current
+// counts, for the token bucket a is the last refill and c the tokens.
+type limiterState struct {
+	a int64
+	b float64
+	c float64
+}
+
+func (s limiterState) encode() []byte {
+	bs := make([]byte, 24)
+	binary.LittleEndian.PutUint64(bs[0:], uint64(s.a))
+	binary.LittleEndian.PutUint64(bs[8:], math.Float64bits(s.b))
+	binary.LittleEndian.PutUint64(bs[16:], math.Float64bits(s.c))
+	return bs
+}
+
+func decodeLimiterState(bs []byte) (limiterState, bool) {
+	if len(bs) != 24 {
+		return limiterState{}, false
+	}
+
+	return limiterState{
+		a: int64(binary.LittleEndian.Uint64(bs[0:])),
+		b: math.Float64frombits(binary.LittleEndian.Uint64(bs[8:])),
+		c: math.Float64frombits(binary.LittleEndian.Uint64(bs[16:])),
+	}, true
+}
+
+func takeLimiter(config LimiterConfig, key string, now int64) (limiterResult, error) {
+	bs, err := config.Storage.Get(key)
+	if err != nil {
+		return limiterResult{}, err
+	}
+
+	state, exist := decodeLimiterState(bs)
+
+	var (
+		res    limiterResult
+		exp    = config.Expiration
+		window = int64(config.Expiration)
+		max    = float64(config.Max)
+	)
+
+	switch config.Algorithm {
+	case LimiterTokenBucket:
+		rate := max / float64(window) // tokens per nanosecond
+		if !exist {
+			state = limiterState{a: now, c: max}
+		}
+
+		state.c = math.Min(max, state.c+float64(now-state.a)*rate)
+		state.a = now
+
+		if state.c >= 1 {
+			state.c--
+			res.allowed = true
+			res.reset = time.Duration(math.Ceil((max - state.c) / rate))
+		} else {
+			res.reset = time.Duration(math.Ceil((1 - state.c) / rate))
+		}
+		res.remaining = int(state.c)
+
+	case LimiterFixedWindow:
+		start := now - now%window
+		if !exist || state.a != start {
+			state = limiterState{a: start}
+		}
+
+		if state.c < max {
+			state.c++
+			res.allowed = true
+		}
+		res.remaining = int(max - state.c)
+		res.reset = time.Duration(start + window - now)
+		exp = res.reset
+
+	default:
+		start := now - now%window
+		if !exist {
+			state = limiterState{a: start}
+		}
+
+		if state.a != start {
+			prev := 0.0
+			if state.a == start-window {
+				prev = state.c
+			}
+			state = limiterState{a: start, b: prev}
+		}
+
+		var (
+			elapsed = now - start
+			weight  = float64(window-elapsed) / float64(window)
+			count   = state.b*weight + state.c
+		)
+
+		if count+1 <= max {
+			state.c++
+			count++
+			res.allowed = true
+		}
+		res.remaining = int(math.Max(0, max-count))
+
+		// time until one more request fits: either the previous window's
+		// weight decays enough or the current window ends
+		res.reset = time.Duration(window - elapsed)
+		if state.b > 0 && state.c+1 <= max {
+			need := float64(window) * (1 - (max-state.c-1)/state.b)
+			if at := int64(need) - elapsed; at > 0 && at < int64(res.reset) {
+				res.reset = time.Duration(at)
+			} else if at <= 0 {
+				res.reset = 0
+			}
+		}
+		exp = time.Duration(start + 2*window - now)
+	}
+
+	if err = config.Storage.Set(key, state.encode(), exp); err != nil {
+		return limiterResult{}, err
+	}
+
+	return res, nil
+}
+
+func ceilSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
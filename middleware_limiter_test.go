@@ -0,0 +1,145 @@
+package ursa
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestLimiterMiddleware tests that requests above the limit are rejected with 429
+func TestLimiterMiddleware(t *testing.T) {
+	for name, algorithm := range map[string]LimiterAlgorithm{
+		"sliding": LimiterSlidingWindow,
+		"fixed":   LimiterFixedWindow,
+		"bucket":  LimiterTokenBucket,
+	} {
+		app := New()
+		app.Use(NewLimiterWithConfig(LimiterConfig{
+			Max:        2,
+			Expiration: time.Hour,
+			Algorithm:  algorithm,
+		}))
+
+		app.Get("/test", func(c *Ctx) error {
+			return c.SendString("test")
+		})
+
+		for i, expected := range []int{200, 200, 429} {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, req)
+
+			if w.Code != expected {
+				t.Errorf("%s: request #%d expected status %d, got %d", name, i, expected, w.Code)
+			}
+			if w.Header().Get("RateLimit-Limit") != "2" {
+				t.Errorf("%s: expected RateLimit-Limit 2, got '%s'", name, w.Header().Get("RateLimit-Limit"))
+			}
+			if expected == 429 && w.Header().Get("Retry-After") == "" {
+				t.Errorf("%s: expected Retry-After header", name)
+			}
+		}
+	}
+}
+
+// TestLimiterMiddlewareKeyByHeader tests that each key is counted separately
+func TestLimiterMiddlewareKeyByHeader(t *testing.T) {
+	app := New()
+	app.Use(NewLimiterWithConfig(LimiterConfig{
+		Max:          1,
+		Expiration:   time.Hour,
+		KeyGenerator: LimiterKeyByHeader("X-API-Key"),
+	}))
+
+	app.Get("/test", func(c *Ctx) error {
+		return c.SendString("test")
+	})
+
+	for i, tc := range []struct {
+		key      string
+		expected int
+	}{{"a", 200}, {"b", 200}, {"a", 429}} {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("X-API-Key", tc.key)
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, req)
+
+		if w.Code != tc.expected {
+			t.Errorf("request #%d expected status %d, got %d", i, tc.expected, w.Code)
+		}
+	}
+}
+
+// TestLimiterTokenBucketRefill tests that tokens are refilled over time
+func TestLimiterTokenBucketRefill(t *testing.T) {
+	config := LimiterConfig{
+		Max:        2,
+		Expiration: 2 * time.Second,
+		Algorithm:  LimiterTokenBucket,
+		Storage:    NewMemoryStorage(),
+	}
+
+	now := time.Now().UnixNano()
+	for i := 0; i < 2; i++ {
+		if res, _ := takeLimiter(config, "k", now); !res.allowed {
+			t.Fatalf("request #%d should be allowed", i)
+		}
+	}
+
+	if res, _ := takeLimiter(config, "k", now); res.allowed || res.reset != time.Second {
+		t.Errorf("Expected rejection with 1s reset, got allowed=%v reset=%v", res.allowed, res.reset)
+	}
+
+	if res, _ := takeLimiter(config, "k", now+int64(time.Second)); !res.allowed {
+		t.Error("Expected a token to be refilled after 1s")
+	}
+}
+
+// TestLimiterSlidingWindow tests that the previous window is weighted
+func TestLimiterSlidingWindow(t *testing.T) {
+	config := LimiterConfig{
+		Max:        4,
+		Expiration: 10 * time.Second,
+		Storage:    NewMemoryStorage(),
+	}
+
+	start := int64(100 * time.Second)
+	for i := 0; i < 4; i++ {
+		_, _ = takeLimiter(config, "k", start)
+	}
+
+	// a quarter into the next window, 3 of the previous 4 still count
+	next := start + int64(12500*time.Millisecond)
+	if res, _ := takeLimiter(config, "k", next); !res.allowed {
+		t.Error("Expected request to be allowed")
+	}
+	if res, _ := takeLimiter(config, "k", next); res.allowed {
+		t.Error("Expected request to be rejected")
+	}
+}
+
+// TestMemoryStorage tests memory storage expiry
+func TestMemoryStorage(t *testing.T) {
+	s := NewMemoryStorage()
+
+	_ = s.Set("a", []byte("1"), 0)
+	_ = s.Set("b", []byte("2"), time.Millisecond)
+
+	time.Sleep(5 * time.Millisecond)
+
+	if v, _ := s.Get("a"); string(v) != "1" {
+		t.Errorf("Expected '1', got '%s'", v)
+	}
+	if v, _ := s.Get("b"); v != nil {
+		t.Errorf("Expected expired value to be nil, got '%s'", v)
+	}
+	if _, ok := s.shard("b").items["b"]; ok {
+		t.Error("Expected expired value to be dropped when read")
+	}
+
+	_ = s.Delete("a")
+	if v, _ := s.Get("a"); v != nil {
+		t.Errorf("Expected deleted value to be nil, got '%s'", v)
+	}
+}
@@ -0,0 +1,386 @@
+package ursa
+
+import (
+	"bytes"
+	"encoding/gob"
+	"sort"
+	"time"
+)
+
+// SessionConfig defines the config for Session middleware
+type SessionConfig struct {
+	// Storage keeps the session data, keyed by "session:" + ID. Use
+	// NewFileStorage to survive restarts, or implement Storage over
+	// Redis or SQL to share sessions between instances.
+	// Default: NewMemoryStorage()
+	Storage Storage
+
+	// IdleTimeout expires a session not used for that long.
+	// Default: 30 minutes
+	IdleTimeout time.Duration
+
+	// AbsoluteTimeout expires a session that long after its creation,
+	// however active it is.
+	// Default: 24 hours
+	AbsoluteTimeout time.Duration
+
+	// Header carries the session ID in this request and response header
+	// instead of a cookie, e.g. "X-Session-ID" for API clients.
+	// Default: "" (use a cookie)
+	Header string
+
+	// CookieName is the name of the session ID cookie.
+	// Default: "ursa_session"
+	CookieName string
+
+	CookieDomain string
+	CookiePath   string
+
+	// CookieSameSite is one of CookieSameSiteLax, CookieSameSiteStrict,
+	// CookieSameSiteNone or CookieSameSiteDisabled.
+	// Default: CookieSameSiteLax
+	CookieSameSite string
+
+	// CookieSecure forces the Secure attribute on plain HTTP requests,
+	// it is always set on HTTPS ones.
+	// Default: false
+	CookieSecure bool
+
+	// CookiePersistent sets Max-Age to IdleTimeout so that the cookie
+	// outlives the browser session.
+	// Default: false
+	CookiePersistent bool
+
+	// KeyGenerator returns new session IDs.
+	// Default: 32 random bytes, base64 url encoded
+	KeyGenerator func() string
+
+	// Next defines a function to skip this middleware when returning true.
+	// Default: nil
+	Next func(c *Ctx) bool
+}
+
+// DefaultSessionConfig is the default Session middleware config
+var DefaultSessionConfig = SessionConfig{
+	IdleTimeout:     30 * time.Minute,
+	AbsoluteTimeout: 24 * time.Hour,
+	CookieName:      "ursa_session",
+	CookiePath:      "/",
+	CookieSameSite:  CookieSameSiteLax,
+	KeyGenerator:    randomToken,
+}
+
+const sessionKey = "ursa.session"
+
+// Session is the server-side state of a client, loaded by the Session
+// middleware and returned by Ctx.Session. Values are stored with
+// encoding/gob: register custom types with gob.Register.
+//
+// A new session is saved, and its ID sent to the client, only once a value
+// is set, so anonymous requests do not fill the storage.
+type Session struct {
+	c      *Ctx
+	config *SessionConfig
+
+	id       string
+	data     map[string]any
+	created  time.Time
+	lastSeen time.Time
+
+	fresh     bool
+	dirty     bool
+	refresh   bool   // the idle deadline is due for renewal
+	sent      bool   // the client holds id
+	destroyed bool   // delete id, do not save
+	stale     string // previous id to delete after Regenerate
+}
+
+type sessionRecord struct {
+	Data     map[string]any
+	Created  int64
+	LastSeen int64
+}
+
+// NewSession returns a Session middleware with default config
+func NewSession() HandlerFunc {
+	return NewSessionWithConfig(DefaultSessionConfig)
+}
+
+// NewSessionWithConfig returns a Session middleware with custom config
+func NewSessionWithConfig(config SessionConfig) HandlerFunc {
+	// Set defaults
+	if config.Storage == nil {
+		config.Storage = NewMemoryStorage()
+	}
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = DefaultSessionConfig.IdleTimeout
+	}
+	if config.AbsoluteTimeout <= 0 {
+		config.AbsoluteTimeout = DefaultSessionConfig.AbsoluteTimeout
+	}
+	if config.CookieName == "" {
+		config.CookieName = DefaultSessionConfig.CookieName
+	}
+	if config.CookiePath == "" {
+		config.CookiePath = DefaultSessionConfig.CookiePath
+	}
+	if config.CookieSameSite == "" {
+		config.CookieSameSite = DefaultSessionConfig.CookieSameSite
+	}
+	if config.KeyGenerator == nil {
+		config.KeyGenerator = DefaultSessionConfig.KeyGenerator
+	}
+
+	return func(c *Ctx) error {
+		if config.Next != nil && config.Next(c) {
+			return c.Next()
+		}
+
+		sess, err := loadSession(c, &config)
+		if err != nil {
+			return err
+		}
+
+		c.Locals(sessionKey, sess)
+
+		// saved even when the handler fails, as a new ID may already be
+		// sent to the client and a regenerated one must not stay valid
+		err = c.Next()
+		if serr := sess.save(); err == nil {
+			err = serr
+		}
+
+		return err
+	}
+}
+
+// Session returns the session loaded by the Session middleware, or nil
+// when the middleware is not in use.
+func (c *Ctx) Session() *Session {
+	sess, _ := c.Locals(sessionKey).(*Session)
+	return sess
+}
+
+func loadSession(c *Ctx, config *SessionConfig) (*Session, error) {
+	var (
+		now  = time.Now()
+		sess = &Session{c: c, config: config}
+		id   string
+	)
+
+	if config.Header != "" {
+		id = c.Get(config.Header)
+	} else {
+		id = c.Cookies(config.CookieName)
+	}
+
+	if id != "" {
+		bs, err := config.Storage.Get("session:" + id)
+		if err != nil {
+			return nil, err
+		}
+
+		record := new(sessionRecord)
+		if bs != nil && gob.NewDecoder(bytes.NewReader(bs)).Decode(record) == nil {
+			sess.created = time.Unix(0, record.Created)
+			sess.lastSeen = time.Unix(0, record.LastSeen)
+
+			if now.Sub(sess.created) < config.AbsoluteTimeout && now.Sub(sess.lastSeen) < config.IdleTimeout {
+				sess.id = id
+				sess.data = record.Data
+				sess.sent = true
+
+				// renew the idle deadline at most every tenth of
+				// IdleTimeout, saving a storage write per request
+				sess.refresh = now.Sub(sess.lastSeen) >= config.IdleTimeout/10
+			} else {
+				_ = config.Storage.Delete("session:" + id)
+			}
+		}
+	}
+
+	// unknown IDs are never adopted, which prevents session fixation
+	if sess.id == "" {
+		sess.id = config.KeyGenerator()
+		sess.created = now
+		sess.lastSeen = now
+		sess.fresh = true
+	}
+
+	if sess.data == nil {
+		sess.data = make(map[string]any)
+	}
+
+	// a persistent cookie expires with the idle deadline, renew it too
+	if sess.refresh && config.CookiePersistent && config.Header == "" {
+		sess.cookie(sess.maxAge())
+	}
+
+	return sess, nil
+}
+
+// ID returns the session ID
+func (s *Session) ID() string {
+	return s.id
+}
+
+// Fresh reports whether the session was created by this request
+func (s *Session) Fresh() bool {
+	return s.fresh
+}
+
+// Get returns the value of key, or nil
+func (s *Session) Get(key string) any {
+	return s.data[key]
+}
+
+// Set sets the value of key
+func (s *Session) Set(key string, value any) {
+	s.data[key] = value
+	s.touch()
+}
+
+// Delete removes key
+func (s *Session) Delete(key string) {
+	if _, ok := s.data[key]; ok {
+		delete(s.data, key)
+		s.touch()
+	}
+}
+
+// Keys returns the sorted session keys
+func (s *Session) Keys() []string {
+	keys := make([]string, 0, len(s.data))
+	for key := range s.data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Regenerate moves the session data to a new ID and invalidates the old
+// one. Call it when the privilege level changes, e.g. on login, to defeat
+// session fixation.
+func (s *Session) Regenerate() {
+	if s.sent && s.stale == "" {
+		s.stale = s.id
+	}
+
+	// created is kept, AbsoluteTimeout counts from the first login
+	s.id = s.config.KeyGenerator()
+	s.sent = false
+	s.destroyed = false
+	s.touch()
+}
+
+// Destroy deletes the session and its data, e.g. on logout. Setting a
+// value afterwards starts a new session.
+func (s *Session) Destroy() {
+	if s.sent && s.stale == "" {
+		s.stale = s.id
+	}
+
+	if s.config.Header != "" {
+		s.c.Set(s.config.Header, "")
+	} else {
+		s.cookie(-1)
+	}
+
+	s.id = s.config.KeyGenerator()
+	s.data = make(map[string]any)
+	s.created = time.Now()
+	s.fresh = true
+	s.sent = false
+	s.dirty = false
+	s.destroyed = true
+}
+
+// touch marks the session to be saved and sends its ID to the client.
+// The ID is sent right away rather than in save, where the response is
+// usually already written.
+func (s *Session) touch() {
+	s.dirty = true
+	s.destroyed = false
+
+	if s.sent {
+		return
+	}
+	s.sent = true
+
+	if s.config.Header != "" {
+		s.c.Set(s.config.Header, s.id)
+		return
+	}
+
+	s.cookie(s.maxAge())
+}
+
+// maxAge returns the Max-Age of the session cookie, 0 for a browser
+// session cookie
+func (s *Session) maxAge() int {
+	if s.config.CookiePersistent {
+		return int(s.config.IdleTimeout / time.Second)
+	}
+
+	return 0
+}
+
+func (s *Session) cookie(maxAge int) {
+	cookie := &Cookie{
+		Name:     s.config.CookieName,
+		Value:    s.id,
+		Path:     s.config.CookiePath,
+		Domain:   s.config.CookieDomain,
+		MaxAge:   maxAge,
+		Secure:   s.config.CookieSecure,
+		HTTPOnly: true,
+		SameSite: s.config.CookieSameSite,
+	}
+
+	if maxAge < 0 {
+		cookie.Value = ""
+		cookie.Expires = time.Unix(0, 0)
+	}
+
+	s.c.Cookie(cookie)
+}
+
+func (s *Session) save() error {
+	storage := s.config.Storage
+
+	if s.stale != "" {
+		if err := storage.Delete("session:" + s.stale); err != nil {
+			return err
+		}
+	}
+
+	if s.destroyed || s.fresh && !s.dirty {
+		return nil
+	}
+
+	if !s.dirty && !s.refresh {
+		return nil
+	}
+
+	now := time.Now()
+
+	ttl := s.config.IdleTimeout
+	if left := s.config.AbsoluteTimeout - now.Sub(s.created); left < ttl {
+		ttl = left
+	}
+	if ttl <= 0 {
+		return storage.Delete("session:" + s.id)
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&sessionRecord{
+		Data:     s.data,
+		Created:  s.created.UnixNano(),
+		LastSeen: now.UnixNano(),
+	}); err != nil {
+		return err
+	}
+
+	return storage.Set("session:"+s.id, buf.Bytes(), ttl)
+}
@@ -0,0 +1,237 @@
+package ursa
+
+import (
+	"bytes"
+	"encoding/gob"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sessionCookie(w *httptest.ResponseRecorder) string {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == "ursa_session" && cookie.Value != "" {
+			return cookie.Name + "=" + cookie.Value
+		}
+	}
+	return ""
+}
+
+func newSessionApp(config SessionConfig) *App {
+	app := New()
+	app.Use(NewSessionWithConfig(config))
+
+	app.Get("/login", func(c *Ctx) error {
+		c.Session().Regenerate()
+		c.Session().Set("user", "alice")
+		return c.SendString("ok")
+	})
+	app.Get("/me", func(c *Ctx) error {
+		user, _ := c.Session().Get("user").(string)
+		return c.SendString(user)
+	})
+	app.Get("/switch", func(c *Ctx) error {
+		c.Session().Regenerate()
+		c.Session().Set("user", "bob")
+		return NewNFError(http.StatusInternalServerError, "failed")
+	})
+	app.Get("/logout", func(c *Ctx) error {
+		c.Session().Destroy()
+		return c.SendString("bye")
+	})
+
+	return app
+}
+
+// TestSessionMiddleware tests session creation, reuse, regeneration and destruction
+func TestSessionMiddleware(t *testing.T) {
+	app := newSessionApp(SessionConfig{})
+
+	w := doRequest(app, http.MethodGet, "/me", nil)
+	if sessionCookie(w) != "" {
+		t.Error("Expected no session cookie for an empty session")
+	}
+
+	w = doRequest(app, http.MethodGet, "/login", nil, "Cookie", "ursa_session=attacker-chosen")
+	cookie := sessionCookie(w)
+	if cookie == "" || cookie == "ursa_session=attacker-chosen" {
+		t.Fatalf("Expected a new session cookie, got '%s'", cookie)
+	}
+
+	w = doRequest(app, http.MethodGet, "/me", nil, "Cookie", cookie)
+	if w.Body.String() != "alice" {
+		t.Errorf("Expected 'alice', got '%s'", w.Body.String())
+	}
+
+	w = doRequest(app, http.MethodGet, "/login", nil, "Cookie", cookie)
+	renewed := sessionCookie(w)
+	if renewed == "" || renewed == cookie {
+		t.Fatalf("Expected Regenerate to issue a new ID, got '%s'", renewed)
+	}
+
+	if w = doRequest(app, http.MethodGet, "/me", nil, "Cookie", cookie); w.Body.String() != "" {
+		t.Errorf("Expected the old ID to be invalid, got '%s'", w.Body.String())
+	}
+
+	// a failing handler still saves the session whose ID it sent
+	w = doRequest(app, http.MethodGet, "/switch", nil, "Cookie", renewed)
+	switched := sessionCookie(w)
+	if w.Code != http.StatusInternalServerError || switched == "" || switched == renewed {
+		t.Fatalf("Expected 500 with a new ID, got %d '%s'", w.Code, switched)
+	}
+	if w = doRequest(app, http.MethodGet, "/me", nil, "Cookie", switched); w.Body.String() != "bob" {
+		t.Errorf("Expected 'bob', got '%s'", w.Body.String())
+	}
+	if w = doRequest(app, http.MethodGet, "/me", nil, "Cookie", renewed); w.Body.String() != "" {
+		t.Errorf("Expected the old ID to be invalid, got '%s'", w.Body.String())
+	}
+	renewed = switched
+
+	doRequest(app, http.MethodGet, "/logout", nil, "Cookie", renewed)
+	if w = doRequest(app, http.MethodGet, "/me", nil, "Cookie", renewed); w.Body.String() != "" {
+		t.Errorf("Expected the destroyed session to be gone, got '%s'", w.Body.String())
+	}
+}
+
+// TestSessionExpiry tests the idle and absolute timeouts
+func TestSessionExpiry(t *testing.T) {
+	app := newSessionApp(SessionConfig{IdleTimeout: 50 * time.Millisecond})
+
+	cookie := sessionCookie(doRequest(app, http.MethodGet, "/login", nil))
+	time.Sleep(100 * time.Millisecond)
+
+	if w := doRequest(app, http.MethodGet, "/me", nil, "Cookie", cookie); w.Body.String() != "" {
+		t.Errorf("Expected idle session to expire, got '%s'", w.Body.String())
+	}
+
+	app = newSessionApp(SessionConfig{IdleTimeout: time.Minute, AbsoluteTimeout: 100 * time.Millisecond})
+
+	cookie = sessionCookie(doRequest(app, http.MethodGet, "/login", nil))
+	for i := 0; i < 3; i++ {
+		time.Sleep(40 * time.Millisecond)
+		doRequest(app, http.MethodGet, "/me", nil, "Cookie", cookie)
+	}
+
+	if w := doRequest(app, http.MethodGet, "/me", nil, "Cookie", cookie); w.Body.String() != "" {
+		t.Errorf("Expected session past its absolute timeout to expire, got '%s'", w.Body.String())
+	}
+
+	// Regenerate keeps the creation time
+	cookie = sessionCookie(doRequest(app, http.MethodGet, "/login", nil))
+	time.Sleep(60 * time.Millisecond)
+	cookie = sessionCookie(doRequest(app, http.MethodGet, "/login", nil, "Cookie", cookie))
+	time.Sleep(60 * time.Millisecond)
+
+	if w := doRequest(app, http.MethodGet, "/me", nil, "Cookie", cookie); w.Body.String() != "" {
+		t.Errorf("Expected regenerated session past its absolute timeout to expire, got '%s'", w.Body.String())
+	}
+}
+
+// TestSessionPersistentCookie tests that a persistent cookie is renewed
+// with the idle deadline
+func TestSessionPersistentCookie(t *testing.T) {
+	storage := NewMemoryStorage()
+	app := newSessionApp(SessionConfig{Storage: storage, IdleTimeout: time.Hour, CookiePersistent: true})
+
+	w := doRequest(app, http.MethodGet, "/login", nil)
+	cookie := sessionCookie(w)
+	if !strings.Contains(w.Header().Get("Set-Cookie"), "Max-Age=3600") {
+		t.Fatalf("Expected a persistent cookie, got '%s'", w.Header().Get("Set-Cookie"))
+	}
+
+	// recently seen sessions are not renewed
+	if w = doRequest(app, http.MethodGet, "/me", nil, "Cookie", cookie); w.Header().Get("Set-Cookie") != "" {
+		t.Errorf("Expected no cookie for a recently seen session, got '%s'", w.Header().Get("Set-Cookie"))
+	}
+
+	// age the stored session past a tenth of IdleTimeout
+	key := "session:" + strings.TrimPrefix(cookie, "ursa_session=")
+	bs, _ := storage.Get(key)
+	record := new(sessionRecord)
+	if err := gob.NewDecoder(bytes.NewReader(bs)).Decode(record); err != nil {
+		t.Fatal(err)
+	}
+	record.LastSeen = time.Now().Add(-10 * time.Minute).UnixNano()
+	var buf bytes.Buffer
+	_ = gob.NewEncoder(&buf).Encode(record)
+	_ = storage.Set(key, buf.Bytes(), time.Hour)
+
+	w = doRequest(app, http.MethodGet, "/me", nil, "Cookie", cookie)
+	if w.Body.String() != "alice" || sessionCookie(w) != cookie || !strings.Contains(w.Header().Get("Set-Cookie"), "Max-Age=3600") {
+		t.Errorf("Expected the cookie renewed with Max-Age, got '%s'", w.Header().Get("Set-Cookie"))
+	}
+
+	bs, _ = storage.Get(key)
+	record = new(sessionRecord)
+	_ = gob.NewDecoder(bytes.NewReader(bs)).Decode(record)
+	if time.Since(time.Unix(0, record.LastSeen)) > time.Minute {
+		t.Error("Expected the stored idle deadline renewed")
+	}
+}
+
+// TestSessionHeader tests sessions carried by a header and a file storage
+func TestSessionHeader(t *testing.T) {
+	storage, err := NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := newSessionApp(SessionConfig{Header: "X-Session-ID", Storage: storage})
+
+	w := doRequest(app, http.MethodGet, "/login", nil)
+	id := w.Header().Get("X-Session-ID")
+	if id == "" || sessionCookie(w) != "" {
+		t.Fatalf("Expected session ID in header only, got '%s'", id)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.Header.Set("X-Session-ID", id)
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+
+	if w.Body.String() != "alice" {
+		t.Errorf("Expected 'alice', got '%s'", w.Body.String())
+	}
+}
+
+// TestFileStorage tests FileStorage expiry and deletion
+func TestFileStorage(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := NewFileStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = storage.Set("a", []byte("1"), 0)
+	_ = storage.Set("b/../c", []byte("2"), 20*time.Millisecond)
+	_ = storage.Set("d", []byte("3"), 20*time.Millisecond)
+
+	if v, _ := storage.Get("a"); string(v) != "1" {
+		t.Errorf("Expected '1', got '%s'", v)
+	}
+	if v, _ := storage.Get("b/../c"); string(v) != "2" {
+		t.Errorf("Expected '2', got '%s'", v)
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	if v, _ := storage.Get("b/../c"); v != nil {
+		t.Errorf("Expected expired value, got '%s'", v)
+	}
+
+	// expired files are left to the sweep
+	if entries, _ := os.ReadDir(dir); len(entries) != 3 {
+		t.Errorf("Expected expired files kept until swept, got %d files", len(entries))
+	}
+	storage.sweep(time.Now().UnixNano())
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected only 'a' left, got %d files", len(entries))
+	}
+
+	_ = storage.Delete("a")
+	if v, _ := storage.Get("a"); v != nil {
+		t.Errorf("Expected deleted value, got '%s'", v)
+	}
+}
@@ -1,6 +1,7 @@
 package ursa
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -342,3 +343,115 @@ func TestMiddlewareWithErrorHandling(t *testing.T) {
 	// The error path should result in a 500 status code, which it does
 	// This test verifies that error handling works correctly
 }
+
+// TestMiddlewareAbortWithStatus tests that Abort stops pending handlers
+// while outer middlewares still finish their post-processing
+func TestMiddlewareAbortWithStatus(t *testing.T) {
+	app := New()
+
+	var (
+		executed []string
+		aborted  bool
+	)
+
+	app.Use(func(c *Ctx) error {
+		err := c.Next()
+		aborted = c.IsAborted()
+		executed = append(executed, "outer-after")
+		return err
+	})
+
+	app.Use(func(c *Ctx) error {
+		executed = append(executed, "auth")
+		_ = c.AbortWithStatus(403)
+		return c.Next()
+	})
+
+	app.Get("/test", func(c *Ctx) error {
+		executed = append(executed, "handler")
+		return c.SendString("success")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+
+	if w.Code != 403 {
+		t.Errorf("Expected status 403, got %d", w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("Expected empty body, got '%s'", w.Body.String())
+	}
+	if !aborted {
+		t.Error("Expected IsAborted to be true")
+	}
+	if len(executed) != 2 || executed[0] != "auth" || executed[1] != "outer-after" {
+		t.Errorf("Expected [auth outer-after], got: %v", executed)
+	}
+}
+
+// TestMiddlewareAbortWithError tests that the aborted status is kept when an error is returned
+func TestMiddlewareAbortWithError(t *testing.T) {
+	app := New()
+
+	var count int
+
+	app.Use(func(c *Ctx) error {
+		return c.AbortWithError(401, errors.New("invalid token"))
+	})
+
+	app.Get("/test", func(c *Ctx) error {
+		count++
+		return c.SendString("success")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+
+	if w.Code != 401 {
+		t.Errorf("Expected status 401, got %d", w.Code)
+	}
+	if count != 0 {
+		t.Errorf("Expected handler not to run, ran %d times", count)
+	}
+}
+
+// TestHandlerErrorNotReentered tests that a returned error never re-enters the chain
+func TestHandlerErrorNotReentered(t *testing.T) {
+	app := New()
+
+	var count int
+
+	app.Use(func(c *Ctx) error {
+		return c.Next()
+	})
+
+	app.Get("/err", func(c *Ctx) error {
+		count++
+		return errors.New("boom")
+	})
+
+	app.Get("/nferr", func(c *Ctx) error {
+		return NewNFError(409, "conflict")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/err", nil)
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+
+	if w.Code != 500 {
+		t.Errorf("Expected status 500, got %d", w.Code)
+	}
+	if count != 1 {
+		t.Errorf("Expected handler to run once, ran %d times", count)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/nferr", nil)
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+
+	if w.Code != 409 || w.Body.String() != "conflict" {
+		t.Errorf("Expected 409 'conflict', got %d '%s'", w.Code, w.Body.String())
+	}
+}
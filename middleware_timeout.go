@@ -0,0 +1,324 @@
+package ursa
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// MetaTimeout is the route metadata key overriding the timeout of the
+// Timeout middleware for a single route or group. The value must be a
+// time.Duration, a value <= 0 disables the timeout for the route.
+//
+//	app.WithMeta(ursa.MetaTimeout, time.Minute).Post("/upload", upload)
+const MetaTimeout = "ursa.timeout"
+
+// TimeoutConfig defines the config for Timeout middleware
+type TimeoutConfig struct {
+	// Timeout is the maximum duration of the remaining handler chain.
+	// Default: 5s
+	Timeout time.Duration
+
+	// StatusCode is the status code sent when the handler times out,
+	// usually 503 or 504.
+	// Default: 503
+	StatusCode int
+
+	// Message is the plain text body sent when the handler times out.
+	// Default: "Service Unavailable"
+	Message string
+}
+
+// DefaultTimeoutConfig is the default Timeout middleware config
+var DefaultTimeoutConfig = TimeoutConfig{
+	Timeout:    5 * time.Second,
+	StatusCode: http.StatusServiceUnavailable,
+	Message:    "Service Unavailable",
+}
+
+// NewTimeout returns a Timeout middleware with the given timeout
+func NewTimeout(timeout time.Duration) HandlerFunc {
+	config := DefaultTimeoutConfig
+	config.Timeout = timeout
+
+	return NewTimeoutWithConfig(config)
+}
+
+// NewTimeoutWithConfig returns a Timeout middleware with custom config.
+//
+// The rest of the chain runs in its own goroutine with a deadline attached
+// to c.Context(), and its response is buffered until it returns. When the
+// deadline passes first, the timeout response is sent while the handler
+// keeps running on a copy of the Ctx, whatever it writes afterwards being
+// discarded and a panic being logged. Handlers should stop working once
+// c.Context() is done.
+func NewTimeoutWithConfig(config TimeoutConfig) HandlerFunc {
+	// Set defaults
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultTimeoutConfig.Timeout
+	}
+	if config.StatusCode == 0 {
+		config.StatusCode = DefaultTimeoutConfig.StatusCode
+	}
+	if config.Message == "" {
+		config.Message = DefaultTimeoutConfig.Message
+	}
+
+	return func(c *Ctx) error {
+		timeout := config.Timeout
+		if v, ok := c.RouteMeta(MetaTimeout).(time.Duration); ok {
+			if v <= 0 {
+				return c.Next()
+			}
+			timeout = v
+		}
+
+		ctx, cancel := context.WithTimeout(c.Context(), timeout)
+		defer cancel()
+
+		tw := &timeoutWriter{
+			bufferWriter: newBufferWriter(&c.writermem),
+			h:            c.writermem.Header().Clone(),
+		}
+		fc := c.fork(tw, ctx)
+
+		var (
+			err    error
+			result = make(chan any, 1)
+		)
+
+		go func() {
+			defer func() {
+				p := recover()
+				if ctx.Err() != nil || !tw.finish() {
+					// the timeout response wins, nobody waits for the handler
+					if p != nil {
+						os.Stderr.WriteString(fmt.Sprintf("recovered from panic after timeout: %v\nStack: %s", p, debug.Stack()))
+					}
+					return
+				}
+
+				result <- p
+			}()
+
+			err = fc.Next()
+		}()
+
+		select {
+		case p := <-result:
+			return c.join(fc, tw, err, p)
+		case <-ctx.Done():
+			if !tw.timeout() {
+				// the handler returned in the meantime
+				return c.join(fc, tw, err, <-result)
+			}
+
+			// the handler goroutine may still use the writer
+			c.detached = true
+
+			if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				// the client went away, nobody is listening
+				return nil
+			}
+
+			c.Status(config.StatusCode)
+			c.SetHeader("Content-Type", MIMETextPlainCharsetUTF8)
+			_, err := c.Writer.WriteString(config.Message)
+			return err
+		}
+	}
+}
+
+// fork returns a copy of c running the rest of the chain under the Timeout
+// middleware, with its own writer, params, locals and body reader, so that
+// a handler outliving the timeout never touches c.
+func (c *Ctx) fork(w ResponseWriter, ctx context.Context) *Ctx {
+	var (
+		params       = append(make(Params, 0, len(*c.params)), *c.params...)
+		skippedNodes = make([]skippedNode, 0)
+		locals       = make(map[string]interface{}, len(c.locals))
+	)
+
+	for key, value := range c.locals {
+		locals[key] = value
+	}
+
+	fc := &Ctx{
+		Writer:       w,
+		Request:      c.Request.WithContext(ctx),
+		path:         c.path,
+		method:       c.method,
+		StatusCode:   c.StatusCode,
+		app:          c.app,
+		params:       &params,
+		index:        c.index,
+		handlers:     c.handlers,
+		locals:       locals,
+		skippedNodes: &skippedNodes,
+		fullPath:     c.fullPath,
+		body:         c.body,
+		bodyExceeded: c.bodyExceeded,
+	}
+
+	fc.body.c = fc
+	if c.Request.Body == &c.body {
+		fc.Request.Body = &fc.body
+	}
+
+	return fc
+}
+
+// join takes back the state of fc once its handler returned in time, and
+// sends the buffered response, or re-panics with p.
+func (c *Ctx) join(fc *Ctx, tw *timeoutWriter, err error, p any) error {
+	c.Request = fc.Request
+	c.params = fc.params
+	c.index = fc.index
+	c.locals = fc.locals
+	c.body = fc.body
+	c.body.c = c
+	c.bodyExceeded = fc.bodyExceeded
+	if c.Request.Body == &fc.body {
+		c.Request.Body = &c.body
+	}
+
+	if p != nil {
+		panic(p)
+	}
+
+	tw.flush()
+	c.StatusCode = c.writermem.Status()
+
+	return err
+}
+
+// timeoutWriter buffers the response of a handler running under the
+// Timeout middleware, with its own headers, until the handler returns in
+// time. After the timeout, writes fail with http.ErrHandlerTimeout.
+type timeoutWriter struct {
+	*bufferWriter
+
+	mu       sync.Mutex
+	h        http.Header
+	timedOut bool
+	finished bool
+}
+
+var _ ResponseWriter = (*timeoutWriter)(nil)
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if !tw.timedOut {
+		tw.bufferWriter.WriteHeader(code)
+	}
+}
+
+func (tw *timeoutWriter) WriteHeaderNow() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if !tw.timedOut {
+		tw.bufferWriter.WriteHeaderNow()
+	}
+}
+
+func (tw *timeoutWriter) Write(data []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+
+	return tw.bufferWriter.Write(data)
+}
+
+func (tw *timeoutWriter) WriteString(s string) (int, error) {
+	return tw.Write([]byte(s))
+}
+
+func (tw *timeoutWriter) Status() int {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	return tw.bufferWriter.Status()
+}
+
+func (tw *timeoutWriter) Size() int {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	return tw.bufferWriter.Size()
+}
+
+func (tw *timeoutWriter) Written() bool {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	return tw.bufferWriter.Written()
+}
+
+// Flush is a no-op, the response is only sent once the handler returns.
+func (tw *timeoutWriter) Flush() {}
+
+// Hijack is not supported since the response is buffered.
+func (tw *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, errors.New("hijack is not supported under the timeout middleware")
+}
+
+func (tw *timeoutWriter) Pusher() http.Pusher {
+	return nil
+}
+
+// finish marks the handler as returned, unless it already timed out
+func (tw *timeoutWriter) finish() bool {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return false
+	}
+
+	tw.finished = true
+	return true
+}
+
+// timeout marks the handler as timed out, unless it already returned
+func (tw *timeoutWriter) timeout() bool {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.finished {
+		return false
+	}
+
+	tw.timedOut = true
+	return true
+}
+
+// flush copies the headers and the buffered response into the real
+// writer. It must only be called after the handler returned in time.
+func (tw *timeoutWriter) flush() {
+	dst := tw.ResponseWriter.Header()
+	for k := range dst {
+		delete(dst, k)
+	}
+	for k, vv := range tw.h {
+		dst[k] = vv
+	}
+
+	_ = tw.send(true)
+}
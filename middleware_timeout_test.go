@@ -0,0 +1,148 @@
+package ursa
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestTimeoutMiddleware tests that fast handlers pass through and slow ones time out
+func TestTimeoutMiddleware(t *testing.T) {
+	app := New()
+	app.Use(NewTimeout(50 * time.Millisecond))
+
+	app.Get("/fast", func(c *Ctx) error {
+		c.Set("X-Handler", "fast")
+		return c.Status(201).SendString("fast")
+	})
+
+	released := make(chan struct{})
+	app.Get("/slow", func(c *Ctx) error {
+		defer close(released)
+		<-c.Context().Done()
+		return c.SendString("late")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/fast", nil)
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+
+	if w.Code != 201 || w.Body.String() != "fast" {
+		t.Errorf("Expected 201 'fast', got %d '%s'", w.Code, w.Body.String())
+	}
+	if w.Header().Get("X-Handler") != "fast" {
+		t.Errorf("Expected X-Handler header to be copied, got '%s'", w.Header().Get("X-Handler"))
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/slow", nil)
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+	<-released
+
+	if w.Code != 503 {
+		t.Errorf("Expected status 503, got %d", w.Code)
+	}
+	if w.Body.String() != "Service Unavailable" {
+		t.Errorf("Expected timeout message, got '%s'", w.Body.String())
+	}
+}
+
+// TestTimeoutMiddlewareRouteMeta tests per-route timeout overrides
+func TestTimeoutMiddlewareRouteMeta(t *testing.T) {
+	app := New()
+	app.Use(NewTimeoutWithConfig(TimeoutConfig{
+		Timeout:    20 * time.Millisecond,
+		StatusCode: http.StatusGatewayTimeout,
+		Message:    "too slow",
+	}))
+
+	returned := make(chan struct{}, 3)
+	slow := func(c *Ctx) error {
+		defer func() { returned <- struct{}{} }()
+		time.Sleep(60 * time.Millisecond)
+		return c.SendString("done")
+	}
+
+	app.Get("/default", slow)
+	app.WithMeta(MetaTimeout, time.Second).Get("/long", slow)
+	app.WithMeta(MetaTimeout, time.Duration(0)).Get("/unlimited", slow)
+
+	for path, expected := range map[string]int{"/default": 504, "/long": 200, "/unlimited": 200} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, req)
+
+		if w.Code != expected {
+			t.Errorf("%s: expected status %d, got %d", path, expected, w.Code)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		<-returned
+	}
+}
+
+// TestTimeoutMiddlewareLateHandler tests a handler using the Ctx and
+// panicking after the timeout
+func TestTimeoutMiddlewareLateHandler(t *testing.T) {
+	app := New()
+	app.Use(NewTimeout(20 * time.Millisecond))
+
+	released := make(chan struct{})
+	app.Get("/late/:id", func(c *Ctx) error {
+		defer close(released)
+		<-c.Context().Done()
+
+		c.Locals("user", c.Param("id"))
+		c.Status(http.StatusCreated)
+		panic("late")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/late/1", nil)
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+	<-released
+
+	if w.Code != 503 {
+		t.Errorf("Expected status 503, got %d", w.Code)
+	}
+}
+
+// TestRouteMeta tests route metadata on groups and in GetRoutes
+func TestRouteMeta(t *testing.T) {
+	app := New()
+
+	admin := app.Group("/admin").WithMeta("role", "admin")
+	admin.WithMeta("audit", true).Get("/users/:id", func(c *Ctx) error {
+		if c.FullPath() != "/admin/users/:id" {
+			t.Errorf("Expected full path '/admin/users/:id', got '%s'", c.FullPath())
+		}
+		if c.RouteMeta("role") != "admin" || c.RouteMeta("audit") != true {
+			t.Errorf("Expected route meta, got role=%v audit=%v", c.RouteMeta("role"), c.RouteMeta("audit"))
+		}
+		return c.SendString("ok")
+	})
+
+	app.Get("/public", func(c *Ctx) error {
+		if c.RouteMeta("role") != nil {
+			t.Errorf("Expected no route meta, got %v", c.RouteMeta("role"))
+		}
+		return c.SendString("ok")
+	})
+
+	for _, path := range []string{"/admin/users/1", "/public"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, req)
+		if w.Code != 200 {
+			t.Errorf("%s: expected status 200, got %d", path, w.Code)
+		}
+	}
+
+	for _, r := range app.GetRoutes() {
+		if r.Path == "/admin/users/:id" && r.Meta["role"] != "admin" {
+			t.Errorf("Expected RouteInfo meta role 'admin', got %v", r.Meta["role"])
+		}
+	}
+}
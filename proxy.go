@@ -0,0 +1,191 @@
+package ursa
+
+import (
+	"net"
+	"strings"
+)
+
+// parseTrustedProxies parses IPs and CIDRs, a bare IP being a single address
+func parseTrustedProxies(proxies []string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(proxies))
+
+	for _, proxy := range proxies {
+		ipNet, err := parseIPNet(proxy)
+		elsePanic(err == nil, "invalid trusted proxy: "+proxy)
+		nets = append(nets, ipNet)
+	}
+
+	return nets
+}
+
+// parseIPNet parses an IP or a CIDR, a bare IP being a single address
+func parseIPNet(s string) (*net.IPNet, error) {
+	s = strings.TrimSpace(s)
+
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, &net.ParseError{Type: "IP address", Text: s}
+		}
+
+		bits := 128
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, ipNet, err := net.ParseCIDR(s)
+	return ipNet, err
+}
+
+func (a *App) isTrustedProxy(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+
+	for _, ipNet := range a.trustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// proxyHop is a hop of the forwarding chain, as reported by the proxy
+// which received the request from it.
+type proxyHop struct {
+	ip    net.IP
+	proto string
+	host  string
+}
+
+// proxyHops returns the forwarding chain of a request received from a
+// trusted proxy, client first and peer last, read from the Forwarded
+// header or else from X-Forwarded-For, X-Forwarded-Proto, X-Forwarded-Host
+// and X-Real-Ip. Hops whose address is unknown or obfuscated have a nil ip.
+func (c *Ctx) proxyHops(peer net.IP) []proxyHop {
+	var hops []proxyHop
+
+	if values := c.Request.Header.Values("Forwarded"); len(values) > 0 {
+		for _, value := range values {
+			for _, element := range strings.Split(value, ",") {
+				var hop proxyHop
+				for _, pair := range strings.Split(element, ";") {
+					k, v, _ := strings.Cut(strings.TrimSpace(pair), "=")
+					v = strings.Trim(v, `"`)
+
+					switch strings.ToLower(k) {
+					case "for":
+						hop.ip = parseForwardedIP(v)
+					case "proto":
+						hop.proto = strings.ToLower(v)
+					case "host":
+						hop.host = v
+					}
+				}
+				hops = append(hops, hop)
+			}
+		}
+	} else if values := c.Request.Header.Values("X-Forwarded-For"); len(values) > 0 {
+		for _, value := range values {
+			for _, part := range strings.Split(value, ",") {
+				hops = append(hops, proxyHop{ip: parseForwardedIP(strings.TrimSpace(part))})
+			}
+		}
+
+		// proxies either append to these headers, matching X-Forwarded-For,
+		// or overwrite them with what the nearest one received
+		zipForwarded(hops, c.Request.Header.Values("X-Forwarded-Proto"), func(hop *proxyHop, v string) { hop.proto = strings.ToLower(v) })
+		zipForwarded(hops, c.Request.Header.Values("X-Forwarded-Host"), func(hop *proxyHop, v string) { hop.host = v })
+	} else if ip := net.ParseIP(strings.TrimSpace(c.Request.Header.Get("X-Real-Ip"))); ip != nil {
+		hops = append(hops, proxyHop{
+			ip:    ip,
+			proto: strings.ToLower(c.Request.Header.Get("X-Forwarded-Proto")),
+			host:  c.Request.Header.Get("X-Forwarded-Host"),
+		})
+	}
+
+	return append(hops, proxyHop{ip: peer})
+}
+
+func zipForwarded(hops []proxyHop, values []string, set func(hop *proxyHop, v string)) {
+	var parts []string
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			parts = append(parts, strings.TrimSpace(part))
+		}
+	}
+
+	if len(parts) == len(hops) {
+		for i := range parts {
+			set(&hops[i], parts[i])
+		}
+		return
+	}
+
+	if len(parts) > 0 && len(hops) > 0 {
+		set(&hops[len(hops)-1], parts[len(parts)-1])
+	}
+}
+
+// parseForwardedIP parses "192.0.2.60", "192.0.2.60:4711", "2001:db8::1"
+// and "[2001:db8::1]:4711"
+func parseForwardedIP(v string) net.IP {
+	if ip := net.ParseIP(v); ip != nil {
+		return ip
+	}
+
+	if host, _, err := net.SplitHostPort(v); err == nil {
+		return net.ParseIP(host)
+	}
+
+	return net.ParseIP(strings.Trim(v, "[]"))
+}
+
+// resolveProxy returns the hop of the client in a chain ending with the
+// peer: the chain is walked right to left while its addresses are trusted
+// proxies, as any entry left of the first untrusted one may be forged. It
+// returns nil when the peer is not a trusted proxy.
+func (c *Ctx) resolveProxy() (hops []proxyHop, client int) {
+	peer := net.ParseIP(c.remoteIP())
+	if !c.app.isTrustedProxy(peer) {
+		return nil, 0
+	}
+
+	hops = c.proxyHops(peer)
+
+	for client = len(hops) - 1; client > 0; client-- {
+		if !c.app.isTrustedProxy(hops[client].ip) {
+			break
+		}
+		// an unknown address ends what can be known of the chain
+		if hops[client-1].ip == nil {
+			break
+		}
+	}
+
+	return hops, client
+}
+
+// forwarded returns the proto or host reported for the client hop, or by
+// the nearest proxy when its own is unknown
+func forwarded(hops []proxyHop, client int, get func(hop proxyHop) string) string {
+	for i := client; i < len(hops); i++ {
+		if v := get(hops[i]); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+func (c *Ctx) remoteIP() string {
+	ip, _, err := net.SplitHostPort(strings.TrimSpace(c.Request.RemoteAddr))
+	if err != nil {
+		return ""
+	}
+
+	return ip
+}
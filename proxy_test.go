@@ -0,0 +1,102 @@
+package ursa
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func doProxyRequest(app *App, remote string, headers ...string) string {
+	req := httptest.NewRequest(http.MethodGet, "http://app.internal:8080/", nil)
+	req.RemoteAddr = remote
+	return serveRequest(app, req, headers...).Body.String()
+}
+
+func newProxyApp(config Config) *App {
+	app := New(config)
+	app.Get("/", func(c *Ctx) error {
+		return c.SendString(c.IP(true) + " " + c.Scheme() + " " + c.Host() + " " + c.Hostname())
+	})
+	return app
+}
+
+// TestTrustedProxies tests client IP, scheme and host resolution behind proxies
+func TestTrustedProxies(t *testing.T) {
+	app := newProxyApp(Config{TrustedProxies: []string{"10.0.0.0/8", "2001:db8::1"}})
+
+	cases := []struct {
+		name    string
+		remote  string
+		headers []string
+		want    string
+	}{
+		{
+			"untrusted peer headers are ignored",
+			"203.0.113.9:1234",
+			[]string{"X-Forwarded-For", "1.2.3.4", "X-Forwarded-Proto", "https", "X-Forwarded-Host", "evil.com"},
+			"203.0.113.9 http app.internal:8080 app.internal",
+		},
+		{
+			"spoofed entries left of the client are skipped",
+			"10.0.0.2:1234",
+			[]string{"X-Forwarded-For", "6.6.6.6, 198.51.100.7, 10.0.0.1", "X-Forwarded-Proto", "https", "X-Forwarded-Host", "example.com"},
+			"198.51.100.7 https example.com example.com",
+		},
+		{
+			"multiple header lines form one chain",
+			"10.0.0.2:1234",
+			[]string{"X-Forwarded-For", "198.51.100.7", "X-Forwarded-For", "10.0.0.1"},
+			"198.51.100.7 http app.internal:8080 app.internal",
+		},
+		{
+			"all trusted returns the leftmost",
+			"10.0.0.2:1234",
+			[]string{"X-Forwarded-For", "10.0.0.3, 10.0.0.1"},
+			"10.0.0.3 http app.internal:8080 app.internal",
+		},
+		{
+			"rfc 7239 forwarded",
+			"[2001:db8::1]:443",
+			[]string{"Forwarded", `for=6.6.6.6;proto=http, for="[2001:db8:cafe::17]:4711";proto=https;host="example.com:8443", for=10.0.0.1`},
+			"2001:db8:cafe::17 https example.com:8443 example.com",
+		},
+		{
+			"forwarded takes precedence",
+			"10.0.0.2:1234",
+			[]string{"Forwarded", "for=198.51.100.7", "X-Forwarded-For", "6.6.6.6"},
+			"198.51.100.7 http app.internal:8080 app.internal",
+		},
+		{
+			"unknown hop stops the walk",
+			"10.0.0.2:1234",
+			[]string{"Forwarded", "for=198.51.100.7, for=unknown, for=10.0.0.1"},
+			"10.0.0.1 http app.internal:8080 app.internal",
+		},
+		{
+			"x-real-ip",
+			"10.0.0.2:1234",
+			[]string{"X-Real-Ip", "198.51.100.7"},
+			"198.51.100.7 http app.internal:8080 app.internal",
+		},
+	}
+
+	for _, tc := range cases {
+		if got := doProxyRequest(app, tc.remote, tc.headers...); got != tc.want {
+			t.Errorf("%s: expected '%s', got '%s'", tc.name, tc.want, got)
+		}
+	}
+
+	// without trusted proxies, forwarding headers are never honoured
+	app = newProxyApp(Config{})
+	if got := doProxyRequest(app, "10.0.0.2:1234", "X-Forwarded-For", "1.2.3.4", "X-Forwarded-Proto", "https"); got != "10.0.0.2 http app.internal:8080 app.internal" {
+		t.Errorf("Expected peer address without trusted proxies, got '%s'", got)
+	}
+
+	app = newProxyApp(Config{TrustedProxies: []string{"10.0.0.2"}, ProxyHeader: "CF-Connecting-IP"})
+	if got := doProxyRequest(app, "10.0.0.2:1234", "CF-Connecting-IP", "198.51.100.7", "X-Forwarded-For", "6.6.6.6"); got != "198.51.100.7 http app.internal:8080 app.internal" {
+		t.Errorf("Expected ProxyHeader address, got '%s'", got)
+	}
+	if got := doProxyRequest(app, "10.0.0.3:1234", "CF-Connecting-IP", "198.51.100.7"); got != "10.0.0.3 http app.internal:8080 app.internal" {
+		t.Errorf("Expected ProxyHeader ignored from untrusted peer, got '%s'", got)
+	}
+}
@@ -0,0 +1,286 @@
+package ursa
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProxyProtocolConfig defines the config of the PROXY protocol listener,
+// set as Config.ProxyProtocol or used with NewProxyProtocolListener.
+type ProxyProtocolConfig struct {
+	// TrustedSources lists the IPs and CIDRs of the load balancers allowed
+	// to send PROXY headers. Connections from other sources are served
+	// as is, a PROXY header they send is not decoded. It is required, as
+	// trusting any peer would let clients spoof their address.
+	TrustedSources []string
+
+	// Required closes the connections from trusted sources which do not
+	// start with a PROXY header.
+	// Default: false
+	Required bool
+
+	// ReadHeaderTimeout is the time allowed to read the PROXY header.
+	// Default: 5s
+	ReadHeaderTimeout time.Duration
+}
+
+var (
+	errProxyHeader   = errors.New("proxy protocol: invalid header")
+	errProxyRequired = errors.New("proxy protocol: missing header")
+
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+type proxyListener struct {
+	net.Listener
+	config  ProxyProtocolConfig
+	sources []*net.IPNet
+}
+
+// NewProxyProtocolListener wraps ln to decode the HAProxy PROXY protocol
+// v1 and v2 headers, so that the RemoteAddr of accepted connections is the
+// address of the client rather than the load balancer. The header is read
+// on the first Read or RemoteAddr call, not in Accept. It panics when
+// config.TrustedSources is empty.
+func NewProxyProtocolListener(ln net.Listener, config ProxyProtocolConfig) net.Listener {
+	elsePanic(len(config.TrustedSources) > 0, "proxy protocol: TrustedSources is required")
+
+	if config.ReadHeaderTimeout <= 0 {
+		config.ReadHeaderTimeout = 5 * time.Second
+	}
+
+	return &proxyListener{
+		Listener: ln,
+		config:   config,
+		sources:  parseTrustedProxies(config.TrustedSources),
+	}
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return &proxyConn{Conn: conn, listener: l}, nil
+}
+
+func (l *proxyListener) trusted(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+
+	for _, ipNet := range l.sources {
+		if ipNet.Contains(tcp.IP) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type proxyConn struct {
+	net.Conn
+	listener *proxyListener
+
+	once   sync.Once
+	reader *bufio.Reader
+	remote net.Addr
+	local  net.Addr
+	err    error
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	return c.reader.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+
+	if c.remote != nil {
+		return c.remote
+	}
+
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyConn) LocalAddr() net.Addr {
+	c.once.Do(c.readHeader)
+
+	if c.local != nil {
+		return c.local
+	}
+
+	return c.Conn.LocalAddr()
+}
+
+// ReadFrom keeps the sendfile optimisation of the wrapped connection
+func (c *proxyConn) ReadFrom(r io.Reader) (int64, error) {
+	if rf, ok := c.Conn.(io.ReaderFrom); ok {
+		return rf.ReadFrom(r)
+	}
+
+	return io.Copy(struct{ io.Writer }{c.Conn}, r)
+}
+
+func (c *proxyConn) readHeader() {
+	c.reader = bufio.NewReader(c.Conn)
+
+	if !c.listener.trusted(c.Conn.RemoteAddr()) {
+		return
+	}
+
+	_ = c.Conn.SetReadDeadline(time.Now().Add(c.listener.config.ReadHeaderTimeout))
+	defer func() {
+		_ = c.Conn.SetReadDeadline(time.Time{})
+	}()
+
+	first, err := c.reader.Peek(1)
+	switch {
+	case err != nil:
+	case first[0] == 'P':
+		err = c.readV1()
+	case first[0] == '\r':
+		err = c.readV2()
+	case c.listener.config.Required:
+		err = errProxyRequired
+	}
+
+	if err != nil {
+		c.err = err
+		_ = c.Conn.Close()
+	}
+}
+
+// readV1 reads "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n"
+func (c *proxyConn) readV1() error {
+	if prefix, err := c.reader.Peek(6); err != nil || string(prefix) != "PROXY " {
+		// an HTTP method starting with P
+		if c.listener.config.Required {
+			return errProxyRequired
+		}
+		return nil
+	}
+
+	var line []byte
+	for {
+		b, err := c.reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		line = append(line, b)
+
+		if b == '\n' {
+			break
+		}
+		// 107 bytes is the longest v1 header
+		if len(line) >= 107 {
+			return errProxyHeader
+		}
+	}
+
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return errProxyHeader
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) < 2 {
+		return errProxyHeader
+	}
+
+	switch fields[1] {
+	case "UNKNOWN":
+		return nil
+	case "TCP4", "TCP6":
+	default:
+		return errProxyHeader
+	}
+
+	if len(fields) != 6 {
+		return errProxyHeader
+	}
+
+	src, dst := net.ParseIP(fields[2]), net.ParseIP(fields[3])
+	srcPort, err1 := strconv.ParseUint(fields[4], 10, 16)
+	dstPort, err2 := strconv.ParseUint(fields[5], 10, 16)
+	if src == nil || dst == nil || err1 != nil || err2 != nil {
+		return errProxyHeader
+	}
+
+	c.remote = &net.TCPAddr{IP: src, Port: int(srcPort)}
+	c.local = &net.TCPAddr{IP: dst, Port: int(dstPort)}
+
+	return nil
+}
+
+// readV2 reads the binary header: signature, version and command,
+// family and protocol, length, addresses, and TLVs which are skipped
+func (c *proxyConn) readV2() error {
+	header, err := c.reader.Peek(16)
+	if err != nil || !bytes.Equal(header[:12], proxyV2Signature) {
+		if c.listener.config.Required {
+			return errProxyRequired
+		}
+		return nil
+	}
+
+	var (
+		verCmd = header[12]
+		family = header[13]
+		length = int(binary.BigEndian.Uint16(header[14:16]))
+	)
+
+	if verCmd>>4 != 2 {
+		return errProxyHeader
+	}
+
+	if _, err = c.reader.Discard(16); err != nil {
+		return err
+	}
+
+	payload := make([]byte, length)
+	if _, err = io.ReadFull(c.reader, payload); err != nil {
+		return err
+	}
+
+	switch verCmd & 0x0f {
+	case 0x0: // LOCAL, e.g. health checks of the load balancer
+		return nil
+	case 0x1: // PROXY
+	default:
+		return errProxyHeader
+	}
+
+	switch family >> 4 {
+	case 0x1: // AF_INET
+		if len(payload) < 12 {
+			return errProxyHeader
+		}
+		c.remote = &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}
+		c.local = &net.TCPAddr{IP: net.IP(payload[4:8]), Port: int(binary.BigEndian.Uint16(payload[10:12]))}
+	case 0x2: // AF_INET6
+		if len(payload) < 36 {
+			return errProxyHeader
+		}
+		c.remote = &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}
+		c.local = &net.TCPAddr{IP: net.IP(payload[16:32]), Port: int(binary.BigEndian.Uint16(payload[34:36]))}
+	}
+
+	// AF_UNSPEC and AF_UNIX keep the addresses of the connection
+	return nil
+}
@@ -0,0 +1,137 @@
+package ursa
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func newProxyProtocolApp(t *testing.T, config ProxyProtocolConfig) string {
+	t.Helper()
+
+	app := New(Config{DisableBanner: true, DisableMessagePrint: true, ProxyProtocol: &config})
+	app.Get("/", func(c *Ctx) error {
+		return c.SendString(c.IP())
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() { _ = app.RunListener(ln) }()
+
+	return ln.Addr().String()
+}
+
+func doProxyProtocolRequest(addr string, header []byte) (string, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if _, err = conn.Write(append(header, "GET / HTTP/1.1\r\nHost: test\r\nConnection: close\r\n\r\n"...)); err != nil {
+		return "", err
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func proxyV2Header(command byte, src, dst net.IP, srcPort, dstPort uint16) []byte {
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, 0x20|command)
+
+	var payload []byte
+	if src4 := src.To4(); src4 != nil {
+		header = append(header, 0x11)
+		payload = append(payload, src4...)
+		payload = append(payload, dst.To4()...)
+	} else {
+		header = append(header, 0x21)
+		payload = append(payload, src.To16()...)
+		payload = append(payload, dst.To16()...)
+	}
+	payload = binary.BigEndian.AppendUint16(payload, srcPort)
+	payload = binary.BigEndian.AppendUint16(payload, dstPort)
+	// a TLV, which is skipped
+	payload = append(payload, 0x04, 0x00, 0x01, 0xff)
+
+	header = binary.BigEndian.AppendUint16(header, uint16(len(payload)))
+	return append(header, payload...)
+}
+
+// TestProxyProtocol tests decoding PROXY v1 and v2 headers
+func TestProxyProtocol(t *testing.T) {
+	addr := newProxyProtocolApp(t, ProxyProtocolConfig{TrustedSources: []string{"127.0.0.1"}})
+
+	cases := []struct {
+		name   string
+		header []byte
+		want   string
+	}{
+		{"v1 tcp4", []byte("PROXY TCP4 198.51.100.7 192.0.2.1 56324 443\r\n"), "198.51.100.7"},
+		{"v1 tcp6", []byte("PROXY TCP6 2001:db8::7 2001:db8::1 56324 443\r\n"), "2001:db8::7"},
+		{"v1 unknown", []byte("PROXY UNKNOWN\r\n"), "127.0.0.1"},
+		{"v2 ipv4", proxyV2Header(0x1, net.ParseIP("198.51.100.7"), net.ParseIP("192.0.2.1"), 56324, 443), "198.51.100.7"},
+		{"v2 ipv6", proxyV2Header(0x1, net.ParseIP("2001:db8::7"), net.ParseIP("2001:db8::1"), 56324, 443), "2001:db8::7"},
+		{"v2 local", proxyV2Header(0x0, net.ParseIP("198.51.100.7"), net.ParseIP("192.0.2.1"), 56324, 443), "127.0.0.1"},
+		{"no header", nil, "127.0.0.1"},
+	}
+
+	for _, tc := range cases {
+		got, err := doProxyProtocolRequest(addr, tc.header)
+		if err != nil || got != tc.want {
+			t.Errorf("%s: expected '%s', got '%s' (%v)", tc.name, tc.want, got, err)
+		}
+	}
+
+	if _, err := doProxyProtocolRequest(addr, []byte("PROXY TCP4 198.51.100.7\r\n")); err == nil {
+		t.Error("Expected connection closed on an invalid header")
+	}
+}
+
+// TestProxyProtocolSources tests trusted sources and required headers
+func TestProxyProtocolSources(t *testing.T) {
+	addr := newProxyProtocolApp(t, ProxyProtocolConfig{TrustedSources: []string{"10.0.0.0/8"}})
+
+	// the header of an untrusted source is not decoded, so it breaks the request
+	got, err := doProxyProtocolRequest(addr, []byte("PROXY TCP4 198.51.100.7 192.0.2.1 56324 443\r\n"))
+	if err == nil && strings.Contains(got, "198.51.100.7") {
+		t.Error("Expected PROXY header ignored from an untrusted source")
+	}
+	if got, err = doProxyProtocolRequest(addr, nil); err != nil || got != "127.0.0.1" {
+		t.Errorf("Expected peer address from an untrusted source, got '%s' (%v)", got, err)
+	}
+
+	addr = newProxyProtocolApp(t, ProxyProtocolConfig{TrustedSources: []string{"127.0.0.1"}, Required: true})
+
+	if _, err = doProxyProtocolRequest(addr, nil); err == nil {
+		t.Error("Expected connection closed without a required header")
+	}
+	if got, err = doProxyProtocolRequest(addr, []byte("PROXY TCP4 198.51.100.7 192.0.2.1 56324 443\r\n")); err != nil || got != "198.51.100.7" {
+		t.Errorf("Expected client address with a required header, got '%s' (%v)", got, err)
+	}
+}
+
+// TestProxyProtocolNoSources tests that trusted sources are required
+func TestProxyProtocolNoSources(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("Expected panic without trusted sources")
+		}
+	}()
+	NewProxyProtocolListener(nil, ProxyProtocolConfig{})
+}
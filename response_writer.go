@@ -2,6 +2,7 @@ package ursa
 
 import (
 	"bufio"
+	"bytes"
 	"io"
 	"log"
 	"net"
@@ -95,6 +96,19 @@ func (w *responseWriter) WriteString(s string) (n int, err error) {
 	return
 }
 
+// ReadFrom lets copyZeroAlloc hand files to the server, which sends them
+// with sendfile when possible
+func (w *responseWriter) ReadFrom(r io.Reader) (n int64, err error) {
+	w.WriteHeaderNow()
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(r)
+	} else {
+		n, err = io.Copy(w.ResponseWriter, r)
+	}
+	w.size += int(n)
+	return
+}
+
 func (w *responseWriter) Status() int {
 	return w.status
 }
@@ -132,3 +146,158 @@ func (w *responseWriter) Pusher() (pusher http.Pusher) {
 	}
 	return nil
 }
+
+// bufferWriter holds the response in memory until it is sent to the
+// wrapped writer, then passes writes through. Middlewares use it to see the
+// whole body before sending it, such as ETag and Cache, or its first bytes,
+// such as Compress. Headers are shared with the wrapped writer. A Flush or
+// Hijack switches it to pass-through, which streaming handlers rely on.
+type bufferWriter struct {
+	ResponseWriter
+
+	// limit sends the response once that many bytes are buffered,
+	// 0 buffers it whole
+	limit int
+
+	// prepare, when set, is called as the response is sent, final being
+	// false when it is sent early by a Flush or the limit. It may change
+	// the headers and returns the writer of the body, nil for the wrapped
+	// writer.
+	prepare func(final bool) io.Writer
+
+	body        io.Writer
+	buf         bytes.Buffer
+	status      int
+	size        int
+	passthrough bool
+}
+
+var _ ResponseWriter = (*bufferWriter)(nil)
+
+func newBufferWriter(w ResponseWriter) *bufferWriter {
+	return &bufferWriter{ResponseWriter: w, status: w.Status(), size: noWritten}
+}
+
+func (w *bufferWriter) WriteHeader(code int) {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	if code > 0 && w.size == noWritten {
+		w.status = code
+	}
+}
+
+func (w *bufferWriter) WriteHeaderNow() {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeaderNow()
+		return
+	}
+
+	if w.size == noWritten {
+		w.size = 0
+	}
+}
+
+func (w *bufferWriter) Write(data []byte) (int, error) {
+	if w.passthrough {
+		if w.body != nil {
+			return w.body.Write(data)
+		}
+		return w.ResponseWriter.Write(data)
+	}
+
+	if w.size == noWritten {
+		w.size = 0
+	}
+
+	n, err := w.buf.Write(data)
+	w.size += n
+
+	if err == nil && w.limit > 0 && w.buf.Len() >= w.limit {
+		err = w.send(false)
+	}
+
+	return n, err
+}
+
+func (w *bufferWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *bufferWriter) Status() int {
+	if w.passthrough {
+		return w.ResponseWriter.Status()
+	}
+
+	return w.status
+}
+
+func (w *bufferWriter) Size() int {
+	if w.passthrough {
+		return w.ResponseWriter.Size()
+	}
+
+	return w.size
+}
+
+func (w *bufferWriter) Written() bool {
+	if w.passthrough {
+		return w.ResponseWriter.Written()
+	}
+
+	return w.size != noWritten
+}
+
+// Flush implements the http.Flusher interface, the buffered response is
+// sent and later writes go straight through.
+func (w *bufferWriter) Flush() {
+	_ = w.send(false)
+
+	if f, ok := w.body.(interface{ Flush() error }); ok {
+		_ = f.Flush()
+	}
+
+	w.ResponseWriter.Flush()
+}
+
+// Hijack implements the http.Hijacker interface.
+func (w *bufferWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.passthrough = true
+	return w.ResponseWriter.Hijack()
+}
+
+// Body returns the buffered response body.
+func (w *bufferWriter) Body() []byte {
+	return w.buf.Bytes()
+}
+
+// send writes the buffered response into the wrapped writer and switches
+// to pass-through. final is false when the response is sent before the
+// handler returned.
+func (w *bufferWriter) send(final bool) error {
+	if w.passthrough {
+		return nil
+	}
+
+	w.passthrough = true
+	if w.prepare != nil {
+		w.body = w.prepare(final)
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.size == noWritten {
+		return nil
+	}
+
+	w.ResponseWriter.WriteHeaderNow()
+
+	var err error
+	if w.buf.Len() > 0 {
+		_, err = w.Write(w.buf.Bytes())
+	}
+	w.buf.Reset()
+
+	return err
+}
@@ -1,6 +1,7 @@
 package ursa
 
 import (
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -12,6 +13,25 @@ func contains(s, substr string) bool {
 	return strings.Contains(s, substr)
 }
 
+// doRequest serves a request through app and returns the response.
+// headers are name/value pairs, empty values being skipped.
+func doRequest(app *App, method, target string, body io.Reader, headers ...string) *httptest.ResponseRecorder {
+	return serveRequest(app, httptest.NewRequest(method, target, body), headers...)
+}
+
+// serveRequest serves req through app, see doRequest
+func serveRequest(app *App, req *http.Request, headers ...string) *httptest.ResponseRecorder {
+	for i := 0; i+1 < len(headers); i += 2 {
+		if headers[i+1] != "" {
+			req.Header.Add(headers[i], headers[i+1])
+		}
+	}
+
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+	return w
+}
+
 // TestHTTPMethods tests all HTTP methods (GET, POST, PUT, DELETE, PATCH, HEAD, OPTIONS)
 func TestHTTPMethods(t *testing.T) {
 	app := New()
@@ -51,6 +51,7 @@ type RouterGroup struct {
 	basePath string
 	app      *App
 	root     bool
+	meta     Map
 }
 
 var _ IRouter = (*RouterGroup)(nil)
@@ -66,6 +67,23 @@ func (group *RouterGroup) Group(relativePath string, middlewares ...HandlerFunc)
 		Handlers: group.combineHandlers(middlewares...),
 		basePath: group.calculateAbsolutePath(relativePath),
 		app:      group.app,
+		meta:     group.combineMeta(nil),
+	}
+}
+
+// WithMeta returns a copy of the group whose routes carry the given metadata,
+// readable through Ctx.RouteMeta and RouteInfo.Meta. Middlewares use it for
+// per-route settings, e.g.
+//
+//	app.WithMeta(ursa.MetaTimeout, time.Minute).Post("/upload", upload)
+//
+// Like Group, the copy only sees the middlewares registered so far.
+func (group *RouterGroup) WithMeta(key string, value any) *RouterGroup {
+	return &RouterGroup{
+		Handlers: group.combineHandlers(),
+		basePath: group.basePath,
+		app:      group.app,
+		meta:     group.combineMeta(Map{key: value}),
 	}
 }
 
@@ -77,6 +95,9 @@ func (group *RouterGroup) handle(httpMethod, relativePath string, handlers ...Ha
 	absolutePath := group.calculateAbsolutePath(relativePath)
 	handlers = group.combineHandlers(handlers...)
 	group.app.addRoute(httpMethod, absolutePath, handlers...)
+	if len(group.meta) > 0 {
+		group.app.setRouteMeta(httpMethod, absolutePath, group.meta)
+	}
 
 	return group.returnObj()
 }
@@ -146,6 +167,22 @@ func (group *RouterGroup) combineHandlers(handlers ...HandlerFunc) []HandlerFunc
 	return mergedHandlers
 }
 
+func (group *RouterGroup) combineMeta(meta Map) Map {
+	if len(group.meta) == 0 && len(meta) == 0 {
+		return nil
+	}
+
+	merged := make(Map, len(group.meta)+len(meta))
+	for k, v := range group.meta {
+		merged[k] = v
+	}
+	for k, v := range meta {
+		merged[k] = v
+	}
+
+	return merged
+}
+
 func (group *RouterGroup) calculateAbsolutePath(relativePath string) string {
 	return path.Join(group.basePath, relativePath)
 }
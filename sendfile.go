@@ -0,0 +1,382 @@
+package ursa
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errRangeInvalid       = errors.New("invalid range")
+	errRangeUnsatisfiable = errors.New("unsatisfiable range")
+)
+
+// SendFile sends the file at path, which must not be derived from the
+// request without being confined to a directory. It sets Content-Type
+// from the extension or else the content, Last-Modified and ETag, answers
+// conditional requests with 304 or 412, and Range requests with 206,
+// multiple ranges being sent as multipart/byteranges. Missing files and
+// directories are answered with 404.
+func (c *Ctx) SendFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, os.ErrPermission) {
+			return NewNFError(404, "Not Found")
+		}
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return NewNFError(404, "Not Found")
+	}
+
+	return c.SendContent(f, info.Name(), info.ModTime(), info.Size())
+}
+
+// Download sends the file at path as an attachment named name, or after
+// its base name, see SendFile and Attachment.
+func (c *Ctx) Download(path string, name ...string) error {
+	filename := filepath.Base(path)
+	if len(name) > 0 && name[0] != "" {
+		filename = name[0]
+	}
+
+	c.Attachment(filename)
+
+	return c.SendFile(path)
+}
+
+// Attachment sets Content-Disposition to attachment, with the filename
+// encoded following RFC 6266 and RFC 5987 when given, and Content-Type
+// from its extension when not set yet.
+func (c *Ctx) Attachment(name ...string) {
+	if len(name) == 0 || name[0] == "" {
+		c.Set("Content-Disposition", "attachment")
+		return
+	}
+
+	filename := filepath.Base(name[0])
+	if c.Writer.Header().Get("Content-Type") == "" {
+		if ctype := mime.TypeByExtension(filepath.Ext(filename)); ctype != "" {
+			c.Set("Content-Type", ctype)
+		}
+	}
+
+	c.Set("Content-Disposition", contentDisposition("attachment", filename))
+}
+
+// contentDisposition returns `<kind>; filename="<ascii>"`, followed by
+// `filename*=UTF-8''<percent encoded>` when the name is not plain ASCII
+func contentDisposition(kind, filename string) string {
+	var (
+		fallback strings.Builder
+		encoded  strings.Builder
+		plain    = true
+	)
+
+	for _, r := range filename {
+		if r >= 0x80 || r < 0x20 || r == 0x7f || r == '"' || r == '\\' {
+			plain = false
+			fallback.WriteByte('_')
+		} else {
+			fallback.WriteRune(r)
+		}
+	}
+
+	for _, b := range []byte(filename) {
+		// attr-char of RFC 5987
+		if b < 0x80 && (b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || strings.IndexByte("!#$&+-.^_`|~", b) >= 0) {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+
+	value := kind + `; filename="` + fallback.String() + `"`
+	if !plain {
+		value += "; filename*=UTF-8''" + encoded.String()
+	}
+
+	return value
+}
+
+// SendContent sends content like SendFile does, name being used to guess
+// the Content-Type from its extension and modTime for Last-Modified and
+// the ETag, both skipped when zero.
+func (c *Ctx) SendContent(content io.ReadSeeker, name string, modTime time.Time, size int64) error {
+	h := c.Writer.Header()
+
+	if h.Get("Content-Type") == "" {
+		ctype := mime.TypeByExtension(filepath.Ext(name))
+		if ctype == "" {
+			buf := make([]byte, 512)
+			n, _ := io.ReadFull(content, buf)
+			ctype = http.DetectContentType(buf[:n])
+			if _, err := content.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+		}
+		h.Set("Content-Type", ctype)
+	}
+
+	if !modTime.IsZero() && modTime.Unix() > 0 {
+		c.LastModified(modTime)
+		if h.Get("ETag") == "" {
+			h.Set("ETag", `"`+strconv.FormatInt(modTime.UnixNano(), 16)+"-"+strconv.FormatInt(size, 16)+`"`)
+		}
+	}
+
+	if err := c.CheckPreconditions(); err != nil {
+		return err
+	}
+
+	if c.Fresh() {
+		h.Del("Content-Type")
+		return c.SendStatus(http.StatusNotModified)
+	}
+
+	h.Set("Accept-Ranges", "bytes")
+
+	var ranges []byteRange
+	if header := c.Get("Range"); header != "" && c.ifRange() {
+		var err error
+		ranges, err = parseRange(header, size)
+
+		switch {
+		case err == errRangeUnsatisfiable:
+			h.Set("Content-Range", "bytes */"+strconv.FormatInt(size, 10))
+			return c.Status(http.StatusRequestedRangeNotSatisfiable).SendString("Range Not Satisfiable")
+		case err != nil:
+			// an invalid Range header is ignored, RFC 9110 14.2
+			ranges = nil
+		}
+	}
+
+	switch {
+	case len(ranges) == 1:
+		return c.sendRange(content, ranges[0], size)
+	case len(ranges) > 1:
+		return c.sendRanges(content, ranges, size)
+	}
+
+	h.Set("Content-Length", strconv.FormatInt(size, 10))
+	c.Writer.WriteHeaderNow()
+
+	if c.Request.Method == http.MethodHead {
+		return nil
+	}
+
+	_, err := copyZeroAlloc(c.Writer, io.LimitReader(content, size))
+	return err
+}
+
+func (c *Ctx) sendRange(content io.ReadSeeker, r byteRange, size int64) error {
+	h := c.Writer.Header()
+	h.Set("Content-Range", r.contentRange(size))
+	h.Set("Content-Length", strconv.FormatInt(r.length, 10))
+	_ = c.SendStatus(http.StatusPartialContent)
+
+	if c.Request.Method == http.MethodHead {
+		return nil
+	}
+
+	if _, err := content.Seek(r.start, io.SeekStart); err != nil {
+		return err
+	}
+
+	_, err := copyZeroAlloc(c.Writer, io.LimitReader(content, r.length))
+	return err
+}
+
+func (c *Ctx) sendRanges(content io.ReadSeeker, ranges []byteRange, size int64) error {
+	var (
+		h       = c.Writer.Header()
+		ctype   = h.Get("Content-Type")
+		counter = &countingWriter{}
+		cmw     = multipart.NewWriter(counter)
+	)
+
+	// the part headers are written once to count the length
+	for _, r := range ranges {
+		_, _ = cmw.CreatePart(r.header(ctype, size))
+		counter.n += r.length
+	}
+	_ = cmw.Close()
+
+	h.Set("Content-Type", "multipart/byteranges; boundary="+cmw.Boundary())
+	h.Set("Content-Length", strconv.FormatInt(counter.n, 10))
+	_ = c.SendStatus(http.StatusPartialContent)
+
+	if c.Request.Method == http.MethodHead {
+		return nil
+	}
+
+	mw := multipart.NewWriter(c.Writer)
+	_ = mw.SetBoundary(cmw.Boundary())
+
+	for _, r := range ranges {
+		part, err := mw.CreatePart(r.header(ctype, size))
+		if err != nil {
+			return err
+		}
+
+		if _, err = content.Seek(r.start, io.SeekStart); err != nil {
+			return err
+		}
+
+		if _, err = copyZeroAlloc(part, io.LimitReader(content, r.length)); err != nil {
+			return err
+		}
+	}
+
+	return mw.Close()
+}
+
+// ifRange reports whether the If-Range validator, when present, matches
+// the response, in which case the Range header applies
+func (c *Ctx) ifRange() bool {
+	ir := c.Get("If-Range")
+	if ir == "" {
+		return true
+	}
+
+	h := c.Writer.Header()
+
+	if strings.HasPrefix(ir, `"`) {
+		etag := h.Get("ETag")
+		return etag != "" && !strings.HasPrefix(etag, "W/") && ir == etag
+	}
+
+	since, err := http.ParseTime(ir)
+	if err != nil {
+		return false
+	}
+
+	lastModified, err := http.ParseTime(h.Get("Last-Modified"))
+
+	return err == nil && lastModified.Equal(since)
+}
+
+type byteRange struct {
+	start  int64
+	length int64
+}
+
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+func (r byteRange) header(ctype string, size int64) textproto.MIMEHeader {
+	return textproto.MIMEHeader{
+		"Content-Range": {r.contentRange(size)},
+		"Content-Type":  {ctype},
+	}
+}
+
+// parseRange parses a Range header such as "bytes=0-499, -500", returning
+// errRangeUnsatisfiable when no range overlaps the content. Ranges adding
+// up to more than the content are refused as invalid, as they can only
+// serve to amplify the response.
+func parseRange(header string, size int64) ([]byteRange, error) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return nil, errRangeInvalid
+	}
+
+	var (
+		ranges  []byteRange
+		total   int64
+		skipped bool
+	)
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		first, last, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, errRangeInvalid
+		}
+		first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+
+		var r byteRange
+
+		if first == "" {
+			// suffix range, the last n bytes
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, errRangeInvalid
+			}
+			if n == 0 || size == 0 {
+				skipped = true
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			r = byteRange{start: size - n, length: n}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, errRangeInvalid
+			}
+
+			end := size - 1
+			if last != "" {
+				if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+					return nil, errRangeInvalid
+				}
+				if end >= size {
+					end = size - 1
+				}
+			}
+
+			if start >= size {
+				skipped = true
+				continue
+			}
+			r = byteRange{start: start, length: end - start + 1}
+		}
+
+		ranges = append(ranges, r)
+		total += r.length
+	}
+
+	if len(ranges) == 0 {
+		if skipped {
+			return nil, errRangeUnsatisfiable
+		}
+		return nil, errRangeInvalid
+	}
+
+	if total > size {
+		return nil, errRangeInvalid
+	}
+
+	return ranges, nil
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,189 @@
+package ursa
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestSendFile tests content types, validators and range requests
+func TestSendFile(t *testing.T) {
+	dir := t.TempDir()
+	content := "0123456789abcdefghijklmnopqrstuvwxyz"
+	if err := os.WriteFile(filepath.Join(dir, "data.txt"), []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "noext"), []byte("<html><body>hi</body></html>"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	app := New(Config{DisableLogger: true})
+	app.Get("/files/:name", func(c *Ctx) error {
+		return c.SendFile(filepath.Join(dir, filepath.Base(c.Param("name"))))
+	})
+	app.Head("/files/:name", func(c *Ctx) error {
+		return c.SendFile(filepath.Join(dir, filepath.Base(c.Param("name"))))
+	})
+
+	w := doRequest(app, http.MethodGet, "/files/data.txt", nil)
+	if w.Code != 200 || w.Body.String() != content || w.Header().Get("Content-Length") != "36" || w.Header().Get("Accept-Ranges") != "bytes" {
+		t.Fatalf("Unexpected full response %d '%s' %v", w.Code, w.Body.String(), w.Header())
+	}
+	if ctype := w.Header().Get("Content-Type"); !strings.HasPrefix(ctype, "text/plain") {
+		t.Errorf("Expected text/plain from extension, got '%s'", ctype)
+	}
+
+	etag, lastModified := w.Header().Get("ETag"), w.Header().Get("Last-Modified")
+	if etag == "" || lastModified == "" {
+		t.Fatal("Expected ETag and Last-Modified")
+	}
+
+	if w = doRequest(app, http.MethodGet, "/files/noext", nil); !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("Expected sniffed text/html, got '%s'", w.Header().Get("Content-Type"))
+	}
+
+	if w = doRequest(app, http.MethodGet, "/files/data.txt", nil, "If-None-Match", etag); w.Code != 304 || w.Body.Len() != 0 {
+		t.Errorf("Expected 304, got %d", w.Code)
+	}
+
+	if w = doRequest(app, http.MethodHead, "/files/data.txt", nil); w.Code != 200 || w.Body.Len() != 0 || w.Header().Get("Content-Length") != "36" {
+		t.Errorf("Expected HEAD without body, got %d '%s'", w.Code, w.Body.String())
+	}
+
+	if w = doRequest(app, http.MethodGet, "/files/missing", nil); w.Code != 404 {
+		t.Errorf("Expected 404 for a missing file, got %d", w.Code)
+	}
+
+	ranges := []struct {
+		header string
+		want   string
+		rng    string
+	}{
+		{"bytes=0-9", "0123456789", "bytes 0-9/36"},
+		{"bytes=30-", "uvwxyz", "bytes 30-35/36"},
+		{"bytes=-3", "xyz", "bytes 33-35/36"},
+		{"bytes=30-100", "uvwxyz", "bytes 30-35/36"},
+	}
+	for _, tc := range ranges {
+		w = doRequest(app, http.MethodGet, "/files/data.txt", nil, "Range", tc.header)
+		if w.Code != 206 || w.Body.String() != tc.want || w.Header().Get("Content-Range") != tc.rng {
+			t.Errorf("%s: unexpected %d '%s' %s", tc.header, w.Code, w.Body.String(), w.Header().Get("Content-Range"))
+		}
+	}
+
+	if w = doRequest(app, http.MethodGet, "/files/data.txt", nil, "Range", "bytes=100-"); w.Code != 416 || w.Header().Get("Content-Range") != "bytes */36" {
+		t.Errorf("Expected 416, got %d", w.Code)
+	}
+	if w = doRequest(app, http.MethodGet, "/files/data.txt", nil, "Range", "bytes=5-1"); w.Code != 200 {
+		t.Errorf("Expected invalid range ignored, got %d", w.Code)
+	}
+	if w = doRequest(app, http.MethodGet, "/files/data.txt", nil, "Range", "bytes=0-35,0-35"); w.Code != 200 {
+		t.Errorf("Expected amplifying ranges ignored, got %d", w.Code)
+	}
+	if w = doRequest(app, http.MethodGet, "/files/data.txt", nil, "Range", "bytes=0-1", "If-Range", `"stale"`); w.Code != 200 {
+		t.Errorf("Expected full content for a stale If-Range, got %d", w.Code)
+	}
+	if w = doRequest(app, http.MethodGet, "/files/data.txt", nil, "Range", "bytes=0-1", "If-Range", etag); w.Code != 206 {
+		t.Errorf("Expected range for a matching If-Range, got %d", w.Code)
+	}
+
+	w = doRequest(app, http.MethodGet, "/files/data.txt", nil, "Range", "bytes=0-1, 10-12")
+	mediaType, params, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if w.Code != 206 || mediaType != "multipart/byteranges" {
+		t.Fatalf("Expected multipart/byteranges, got %d '%s'", w.Code, mediaType)
+	}
+	if w.Header().Get("Content-Length") != strconv.Itoa(w.Body.Len()) {
+		t.Errorf("Expected Content-Length %d, got %s", w.Body.Len(), w.Header().Get("Content-Length"))
+	}
+
+	var parts []string
+	mr := multipart.NewReader(w.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		bs, _ := io.ReadAll(part)
+		parts = append(parts, part.Header.Get("Content-Range")+"="+string(bs))
+	}
+	if strings.Join(parts, " ") != "bytes 0-1/36=01 bytes 10-12/36=abc" {
+		t.Errorf("Unexpected parts %v", parts)
+	}
+
+	// through a server, where the file is handed to its ReadFrom
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/files/data.txt", nil)
+	req.Header.Set("Range", "bytes=10-15")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 206 || string(bs) != "abcdef" {
+		t.Errorf("Expected range from server, got %d '%s'", resp.StatusCode, bs)
+	}
+}
+
+// TestDownload tests Content-Disposition filename encoding
+func TestDownload(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "report.pdf"), []byte("%PDF-1.4"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	app := New(Config{DisableLogger: true})
+	app.Get("/plain", func(c *Ctx) error {
+		return c.Download(filepath.Join(dir, "report.pdf"))
+	})
+	app.Get("/unicode", func(c *Ctx) error {
+		return c.Download(filepath.Join(dir, "report.pdf"), `Rapport "été" 2024.pdf`)
+	})
+	app.Get("/attachment", func(c *Ctx) error {
+		c.Attachment("data.json")
+		return c.SendString("{}")
+	})
+
+	w := doRequest(app, http.MethodGet, "/plain", nil)
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename="report.pdf"` {
+		t.Errorf("Unexpected Content-Disposition '%s'", cd)
+	}
+	if ctype := w.Header().Get("Content-Type"); ctype != "application/pdf" {
+		t.Errorf("Expected application/pdf, got '%s'", ctype)
+	}
+
+	w = doRequest(app, http.MethodGet, "/unicode", nil)
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename="Rapport __t__ 2024.pdf"; filename*=UTF-8''Rapport%20%22%C3%A9t%C3%A9%22%202024.pdf` {
+		t.Errorf("Unexpected Content-Disposition '%s'", cd)
+	}
+
+	w = doRequest(app, http.MethodGet, "/attachment", nil)
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename="data.json"` {
+		t.Errorf("Unexpected Content-Disposition '%s'", cd)
+	}
+}
+
+// TestSendStream tests that the size argument limits the stream
+func TestSendStream(t *testing.T) {
+	app := New(Config{DisableLogger: true})
+	app.Get("/", func(c *Ctx) error {
+		return c.SendStream(strings.NewReader("0123456789"), 4)
+	})
+
+	w := doRequest(app, http.MethodGet, "/", nil)
+	if w.Body.String() != "0123" || w.Header().Get("Content-Length") != "4" {
+		t.Errorf("Expected 4 bytes, got '%s' (%s)", w.Body.String(), w.Header().Get("Content-Length"))
+	}
+}
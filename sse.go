@@ -0,0 +1,287 @@
+package ursa
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/loveuer/ursa/internal/sse"
+)
+
+// SSEEvent is a server-sent event. Data is written as is when it is a
+// string, a []byte or a number, and as JSON otherwise.
+type SSEEvent struct {
+	ID    string
+	Event string
+	Data  interface{}
+
+	// Retry tells the client how long to wait before reconnecting
+	Retry time.Duration
+}
+
+// SSEConfig defines the config of Ctx.SSEStream
+type SSEConfig struct {
+	// Heartbeat is the interval of the comments sent to keep idle streams
+	// open through proxies, a negative value disables them.
+	// Default: 15s
+	Heartbeat time.Duration
+
+	// Retry is sent to the client when the stream opens, see SSEEvent.Retry.
+	// Default: 0 (the client default)
+	Retry time.Duration
+
+	// History retains the events sent with an ID, and replays those after
+	// the Last-Event-ID of reconnecting clients. It is usually shared by
+	// the streams of a same topic.
+	// Default: nil
+	History *SSEHistory
+}
+
+// DefaultSSEConfig is the default Ctx.SSEStream config
+var DefaultSSEConfig = SSEConfig{
+	Heartbeat: 15 * time.Second,
+}
+
+// SSEWriter writes the events of a Ctx.SSEStream. It is safe for
+// concurrent use.
+type SSEWriter struct {
+	c           *Ctx
+	history     *SSEHistory
+	lastEventID string
+
+	lock sync.Mutex
+}
+
+// SSEStream streams server-sent events written by fn, until it returns or
+// the client disconnects, after which the writes fail with the error of
+// Context. Every event is flushed, and comments are sent as heartbeats.
+//
+//	app.Get("/events", func(c *ursa.Ctx) error {
+//		return c.SSEStream(func(w *ursa.SSEWriter) error {
+//			for {
+//				select {
+//				case <-w.Done():
+//					return nil
+//				case order := <-orders:
+//					if err := w.Send(ursa.SSEEvent{ID: order.ID, Event: "order", Data: order}); err != nil {
+//						return err
+//					}
+//				}
+//			}
+//		}, ursa.SSEConfig{History: history})
+//	})
+func (c *Ctx) SSEStream(fn func(w *SSEWriter) error, config ...SSEConfig) error {
+	cfg := DefaultSSEConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	// Set defaults
+	if cfg.Heartbeat == 0 {
+		cfg.Heartbeat = DefaultSSEConfig.Heartbeat
+	}
+
+	w := &SSEWriter{c: c, history: cfg.History, lastEventID: c.Get("Last-Event-ID")}
+
+	h := c.Writer.Header()
+	h.Set("Content-Type", sse.ContentType)
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	h.Del("Content-Length")
+	c.Status(http.StatusOK)
+
+	w.lock.Lock()
+	if cfg.Retry > 0 {
+		_, _ = c.Writer.WriteString("retry:" + strconv.FormatInt(cfg.Retry.Milliseconds(), 10) + "\n\n")
+	}
+	c.Writer.WriteHeaderNow()
+	_ = c.Flush()
+	w.lock.Unlock()
+
+	if cfg.History != nil && w.lastEventID != "" {
+		for _, event := range cfg.History.Since(w.lastEventID) {
+			if err := w.write(event); err != nil {
+				return nil
+			}
+		}
+	}
+
+	if cfg.Heartbeat > 0 {
+		done := make(chan struct{})
+		stopped := make(chan struct{})
+
+		go func() {
+			defer close(stopped)
+			w.heartbeat(cfg.Heartbeat, done)
+		}()
+
+		defer func() {
+			close(done)
+			<-stopped
+		}()
+	}
+
+	err := fn(w)
+
+	// the client is gone, there is no one to report the error to
+	if c.Context().Err() != nil {
+		return nil
+	}
+
+	return err
+}
+
+func (w *SSEWriter) heartbeat(interval time.Duration, done chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-w.Done():
+			return
+		case <-ticker.C:
+			if err := w.Comment("heartbeat"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// LastEventID returns the Last-Event-ID sent by a reconnecting client
+func (w *SSEWriter) LastEventID() string {
+	return w.lastEventID
+}
+
+// Context returns the context of the request, canceled when the client
+// disconnects
+func (w *SSEWriter) Context() context.Context {
+	return w.c.Context()
+}
+
+// Done is closed when the client disconnects
+func (w *SSEWriter) Done() <-chan struct{} {
+	return w.c.Context().Done()
+}
+
+// Send writes and flushes event, and retains it in the History when it
+// has an ID
+func (w *SSEWriter) Send(event SSEEvent) error {
+	if w.history != nil && event.ID != "" {
+		w.history.Add(event)
+	}
+
+	return w.write(event)
+}
+
+// Event sends an event without ID
+func (w *SSEWriter) Event(event string, data interface{}) error {
+	return w.Send(SSEEvent{Event: event, Data: data})
+}
+
+// Comment writes a comment, ignored by clients
+func (w *SSEWriter) Comment(text string) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if err := w.c.Context().Err(); err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		b.WriteString(": " + strings.ReplaceAll(line, "\r", "") + "\n")
+	}
+	b.WriteString("\n")
+
+	if _, err := w.c.Writer.WriteString(b.String()); err != nil {
+		return err
+	}
+
+	return w.c.Flush()
+}
+
+func (w *SSEWriter) write(event SSEEvent) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if err := w.c.Context().Err(); err != nil {
+		return err
+	}
+
+	if err := sse.Encode(w.c.Writer, sse.Event{
+		Id:    event.ID,
+		Event: event.Event,
+		Retry: uint(event.Retry.Milliseconds()),
+		Data:  event.Data,
+	}); err != nil {
+		return err
+	}
+
+	return w.c.Flush()
+}
+
+// SSEHistory retains the last events with an ID, for the clients which
+// reconnect to replay what they missed. It is safe for concurrent use.
+type SSEHistory struct {
+	lock   sync.Mutex
+	events []SSEEvent
+	size   int
+	start  int
+	ids    map[string]struct{}
+}
+
+// NewSSEHistory returns an SSEHistory retaining up to size events
+func NewSSEHistory(size int) *SSEHistory {
+	elsePanic(size > 0, "sse: history size must be positive")
+
+	return &SSEHistory{size: size, ids: make(map[string]struct{}, size)}
+}
+
+// Add retains event, evicting the oldest one when full. Events without
+// ID, or whose ID is already retained, are ignored.
+func (h *SSEHistory) Add(event SSEEvent) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if _, ok := h.ids[event.ID]; ok || event.ID == "" {
+		return
+	}
+	h.ids[event.ID] = struct{}{}
+
+	if len(h.events) < h.size {
+		h.events = append(h.events, event)
+		return
+	}
+
+	delete(h.ids, h.events[h.start].ID)
+	h.events[h.start] = event
+	h.start = (h.start + 1) % h.size
+}
+
+// Since returns the events retained after the one with id, or all of them
+// when id is no longer retained.
+func (h *SSEHistory) Since(id string) []SSEEvent {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	events := make([]SSEEvent, 0, len(h.events))
+	events = append(events, h.events[h.start:]...)
+	events = append(events, h.events[:h.start]...)
+
+	if _, ok := h.ids[id]; !ok {
+		return events
+	}
+
+	for i, event := range events {
+		if event.ID == id {
+			return events[i+1:]
+		}
+	}
+
+	return nil
+}
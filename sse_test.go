@@ -0,0 +1,181 @@
+package ursa
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSSEStream tests headers, events, retry and heartbeats
+func TestSSEStream(t *testing.T) {
+	app := New(Config{DisableLogger: true})
+	app.Get("/events", func(c *Ctx) error {
+		return c.SSEStream(func(w *SSEWriter) error {
+			if err := w.Send(SSEEvent{ID: "1", Event: "tick", Data: "hello"}); err != nil {
+				return err
+			}
+			if err := w.Event("json", Map{"n": 1}); err != nil {
+				return err
+			}
+
+			// long enough for a heartbeat
+			select {
+			case <-w.Done():
+			case <-time.After(100 * time.Millisecond):
+			}
+
+			return nil
+		}, SSEConfig{Heartbeat: 20 * time.Millisecond, Retry: 3 * time.Second})
+	})
+
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ctype := resp.Header.Get("Content-Type"); ctype != "text/event-stream" {
+		t.Errorf("Unexpected Content-Type '%s'", ctype)
+	}
+	if resp.Header.Get("Cache-Control") != "no-cache" || len(resp.TransferEncoding) != 1 || resp.TransferEncoding[0] != "chunked" {
+		t.Errorf("Unexpected headers %v %v", resp.Header, resp.TransferEncoding)
+	}
+
+	// events are flushed as they are sent
+	reader := bufio.NewReader(resp.Body)
+	var lines []string
+	for len(lines) < 8 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Unexpected end of stream after %q: %v", lines, err)
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+
+	expected := []string{"retry:3000", "", "id:1", "event:tick", "data:hello", "", "event:json", `data:{"n":1}`}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Unexpected events %q", lines)
+	}
+
+	rest, _ := reader.ReadString(0)
+	if !strings.Contains(rest, ": heartbeat\n\n") {
+		t.Errorf("Expected a heartbeat, got %q", rest)
+	}
+}
+
+// TestSSEStreamDisconnect tests that writes fail once the client is gone
+func TestSSEStreamDisconnect(t *testing.T) {
+	result := make(chan error, 1)
+
+	app := New(Config{DisableLogger: true})
+	app.Get("/events", func(c *Ctx) error {
+		return c.SSEStream(func(w *SSEWriter) error {
+			for i := 0; ; i++ {
+				if err := w.Event("tick", i); err != nil {
+					result <- err
+					return err
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+		})
+	})
+
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = bufio.NewReader(resp.Body).ReadString('\n')
+	resp.Body.Close()
+
+	select {
+	case err = <-result:
+		if err == nil {
+			t.Error("Expected an error")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the stream to stop")
+	}
+}
+
+// TestSSEStreamReplay tests the replay of the events after Last-Event-ID
+func TestSSEStreamReplay(t *testing.T) {
+	history := NewSSEHistory(3)
+
+	app := New(Config{DisableLogger: true})
+	app.Get("/events", func(c *Ctx) error {
+		return c.SSEStream(func(w *SSEWriter) error {
+			if w.LastEventID() != "" {
+				return w.Event("resumed", w.LastEventID())
+			}
+
+			for _, id := range []string{"1", "2", "3", "4"} {
+				if err := w.Send(SSEEvent{ID: id, Data: "event " + id}); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}, SSEConfig{History: history})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+	if !w.Flushed || !strings.Contains(w.Body.String(), "id:4\ndata:event 4\n\n") {
+		t.Fatalf("Unexpected stream %q", w.Body.String())
+	}
+
+	req.Header.Set("Last-Event-ID", "3")
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+	if body := w.Body.String(); body != "id:4\ndata:event 4\n\nevent:resumed\ndata:3\n\n" {
+		t.Errorf("Unexpected replay %q", body)
+	}
+
+	// the first event is evicted, everything retained is replayed
+	req.Header.Set("Last-Event-ID", "1")
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+	if body := w.Body.String(); !strings.HasPrefix(body, "id:2\ndata:event 2\n\nid:3\n") {
+		t.Errorf("Unexpected replay %q", body)
+	}
+}
+
+// TestSSEHistory tests eviction and duplicates
+func TestSSEHistory(t *testing.T) {
+	h := NewSSEHistory(2)
+	h.Add(SSEEvent{ID: "a"})
+	h.Add(SSEEvent{ID: "a"})
+	h.Add(SSEEvent{})
+	h.Add(SSEEvent{ID: "b"})
+
+	ids := func(events []SSEEvent) (ids []string) {
+		for _, e := range events {
+			ids = append(ids, e.ID)
+		}
+		return ids
+	}
+
+	if got := ids(h.Since("a")); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Errorf("Unexpected events %v", got)
+	}
+
+	h.Add(SSEEvent{ID: "c"})
+	h.Add(SSEEvent{ID: "d"})
+	if got := ids(h.Since("a")); !reflect.DeepEqual(got, []string{"c", "d"}) {
+		t.Errorf("Expected all retained events, got %v", got)
+	}
+	if got := ids(h.Since("d")); len(got) != 0 {
+		t.Errorf("Expected no event, got %v", got)
+	}
+}
@@ -0,0 +1,404 @@
+package ursa
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Storage is the key-value store with expiry used by stateful middlewares
+// such as the limiter, the response cache and sessions. Implement it to
+// share state between instances through an external backend (Redis,
+// Memcached, SQL...).
+type Storage interface {
+	// Get returns the value of key, or nil without error when the key
+	// does not exist or has expired.
+	Get(key string) ([]byte, error)
+
+	// Set stores value for key. An exp <= 0 means the value never expires.
+	Set(key string, value []byte, exp time.Duration) error
+
+	// Delete removes key, deleting a missing key is not an error.
+	Delete(key string) error
+}
+
+const (
+	memoryStorageShards = 32
+	memoryStorageGC     = time.Minute
+)
+
+// MemoryStorage is an in-memory sharded Storage. Expired entries are
+// dropped lazily when read and swept from a shard at most once per minute.
+type MemoryStorage struct {
+	shards [memoryStorageShards]memoryShard
+}
+
+type memoryShard struct {
+	lock   sync.RWMutex
+	items  map[string]memoryItem
+	lastGC int64
+}
+
+type memoryItem struct {
+	value  []byte
+	expire int64 // unix nano, 0 for never
+}
+
+var _ Storage = (*MemoryStorage)(nil)
+
+// NewMemoryStorage returns an empty MemoryStorage
+func NewMemoryStorage() *MemoryStorage {
+	s := &MemoryStorage{}
+	for i := range s.shards {
+		s.shards[i].items = make(map[string]memoryItem)
+	}
+
+	return s
+}
+
+func (s *MemoryStorage) shard(key string) *memoryShard {
+	return &s.shards[hashKey(key)%memoryStorageShards]
+}
+
+func (s *MemoryStorage) Get(key string) ([]byte, error) {
+	sh := s.shard(key)
+
+	sh.lock.RLock()
+	item, ok := sh.items[key]
+	sh.lock.RUnlock()
+
+	if !ok {
+		return nil, nil
+	}
+
+	if now := time.Now().UnixNano(); item.expire != 0 && item.expire <= now {
+		sh.lock.Lock()
+		defer sh.lock.Unlock()
+
+		// the key may have been set again in the meantime
+		if item, ok = sh.items[key]; !ok {
+			return nil, nil
+		}
+		if item.expire != 0 && item.expire <= now {
+			delete(sh.items, key)
+			return nil, nil
+		}
+	}
+
+	return item.value, nil
+}
+
+func (s *MemoryStorage) Set(key string, value []byte, exp time.Duration) error {
+	var (
+		sh   = s.shard(key)
+		now  = time.Now().UnixNano()
+		item = memoryItem{value: value}
+	)
+
+	if exp > 0 {
+		item.expire = now + int64(exp)
+	}
+
+	sh.lock.Lock()
+	defer sh.lock.Unlock()
+
+	sh.items[key] = item
+
+	if now-sh.lastGC > int64(memoryStorageGC) {
+		sh.lastGC = now
+		for k, v := range sh.items {
+			if v.expire != 0 && v.expire <= now {
+				delete(sh.items, k)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStorage) Delete(key string) error {
+	sh := s.shard(key)
+
+	sh.lock.Lock()
+	delete(sh.items, key)
+	sh.lock.Unlock()
+
+	return nil
+}
+
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return h.Sum32()
+}
+
+// LRUStorage is an in-memory Storage holding at most a fixed number of
+// entries, evicting the least recently used one when full.
+type LRUStorage struct {
+	lock     sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List
+}
+
+type lruEntry struct {
+	key  string
+	item memoryItem
+}
+
+var _ Storage = (*LRUStorage)(nil)
+
+// NewLRUStorage returns an empty LRUStorage holding up to capacity entries
+func NewLRUStorage(capacity int) *LRUStorage {
+	elsePanic(capacity > 0, "lru storage capacity must be positive")
+
+	return &LRUStorage{
+		capacity: capacity,
+		items:    make(map[string]*list.Element, capacity),
+		order:    list.New(),
+	}
+}
+
+func (s *LRUStorage) Get(key string) ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	el, ok := s.items[key]
+	if !ok {
+		return nil, nil
+	}
+
+	entry := el.Value.(*lruEntry)
+	if entry.item.expire != 0 && entry.item.expire <= time.Now().UnixNano() {
+		s.order.Remove(el)
+		delete(s.items, key)
+		return nil, nil
+	}
+
+	s.order.MoveToFront(el)
+
+	return entry.item.value, nil
+}
+
+func (s *LRUStorage) Set(key string, value []byte, exp time.Duration) error {
+	item := memoryItem{value: value}
+	if exp > 0 {
+		item.expire = time.Now().UnixNano() + int64(exp)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if el, ok := s.items[key]; ok {
+		el.Value.(*lruEntry).item = item
+		s.order.MoveToFront(el)
+		return nil
+	}
+
+	s.items[key] = s.order.PushFront(&lruEntry{key: key, item: item})
+
+	for s.order.Len() > s.capacity {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.items, oldest.Value.(*lruEntry).key)
+	}
+
+	return nil
+}
+
+func (s *LRUStorage) Delete(key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if el, ok := s.items[key]; ok {
+		s.order.Remove(el)
+		delete(s.items, key)
+	}
+
+	return nil
+}
+
+// Len returns the number of entries, expired ones included until evicted.
+func (s *LRUStorage) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.order.Len()
+}
+
+// FileStorage is a Storage keeping one file per key in a directory, for
+// state that must survive restarts of a single instance. Expired files
+// are ignored when read, and swept in the background at most once per
+// minute.
+type FileStorage struct {
+	dir      string
+	lock     sync.Mutex
+	lastGC   int64
+	sweeping bool
+
+	// Set renames files under the read lock and sweep removes them under
+	// the write lock, so that a fresh file is never swept as expired
+	files sync.RWMutex
+}
+
+var _ Storage = (*FileStorage)(nil)
+
+// NewFileStorage returns a FileStorage in dir, creating it if needed
+func NewFileStorage(dir string) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &FileStorage{dir: dir, lastGC: time.Now().UnixNano()}, nil
+}
+
+// path hashes key so that any key maps to a safe file name
+func (s *FileStorage) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
+
+func (s *FileStorage) Get(key string) ([]byte, error) {
+	bs, err := os.ReadFile(s.path(key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	value, expired := decodeFileItem(bs, time.Now().UnixNano())
+	if expired {
+		return nil, nil
+	}
+
+	return value, nil
+}
+
+func (s *FileStorage) Set(key string, value []byte, exp time.Duration) error {
+	var (
+		now    = time.Now().UnixNano()
+		expire int64
+	)
+
+	if exp > 0 {
+		expire = now + int64(exp)
+	}
+
+	bs := make([]byte, 8, 8+len(value))
+	binary.LittleEndian.PutUint64(bs, uint64(expire))
+	bs = append(bs, value...)
+
+	// write then rename, readers never see a partial file
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	if _, err = tmp.Write(bs); err == nil {
+		err = tmp.Close()
+	} else {
+		_ = tmp.Close()
+	}
+
+	if err == nil {
+		s.files.RLock()
+		err = os.Rename(tmp.Name(), s.path(key))
+		s.files.RUnlock()
+	}
+
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	s.gc(now)
+
+	return nil
+}
+
+func (s *FileStorage) Delete(key string) error {
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// gc starts a sweep of the expired files once per minute, in its own
+// goroutine so that Set does not wait for the directory scan
+func (s *FileStorage) gc(now int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.sweeping || now-s.lastGC < int64(memoryStorageGC) {
+		return
+	}
+	s.lastGC = now
+	s.sweeping = true
+
+	go s.sweep(now)
+}
+
+// sweep removes the files expired at now, reading only their header
+func (s *FileStorage) sweep(now int64) {
+	defer func() {
+		s.lock.Lock()
+		s.sweeping = false
+		s.lock.Unlock()
+	}()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+
+	header := make([]byte, 8)
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		s.sweepFile(filepath.Join(s.dir, entry.Name()), header, now)
+	}
+}
+
+// sweepFile removes name if it is expired at now, with no Set replacing
+// it between the check and the removal
+func (s *FileStorage) sweepFile(name string, header []byte, now int64) {
+	s.files.Lock()
+	defer s.files.Unlock()
+
+	f, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	n, _ := io.ReadFull(f, header)
+	_ = f.Close()
+
+	if _, expired := decodeFileItem(header[:n], now); expired {
+		_ = os.Remove(name)
+	}
+}
+
+func decodeFileItem(bs []byte, now int64) ([]byte, bool) {
+	if len(bs) < 8 {
+		return nil, true
+	}
+
+	expire := int64(binary.LittleEndian.Uint64(bs))
+	if expire != 0 && expire <= now {
+		return nil, true
+	}
+
+	return bs[8:], false
+}
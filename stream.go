@@ -0,0 +1,363 @@
+package ursa
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	MIMEApplicationNDJSON    = "application/x-ndjson"
+	MIMEApplicationJSONLines = "application/jsonl"
+)
+
+// JSONIterator returns the values of a JSON stream one at a time, and
+// io.EOF after the last one. ctx is canceled when the client disconnects.
+type JSONIterator func(ctx context.Context) (interface{}, error)
+
+// JSONChan returns a JSONIterator over the values received from ch until
+// it is closed
+func JSONChan[T any](ch <-chan T) JSONIterator {
+	return func(ctx context.Context) (interface{}, error) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case v, ok := <-ch:
+			if !ok {
+				return nil, io.EOF
+			}
+			return v, nil
+		}
+	}
+}
+
+// JSONSlice returns a JSONIterator over values
+func JSONSlice[T any](values []T) JSONIterator {
+	i := 0
+
+	return func(ctx context.Context) (interface{}, error) {
+		if i >= len(values) {
+			return nil, io.EOF
+		}
+		i++
+		return values[i-1], nil
+	}
+}
+
+// StreamConfig defines the config of the JSON streams
+type StreamConfig struct {
+	// FlushInterval is the longest time written values are buffered.
+	// Default: 1s
+	FlushInterval time.Duration
+
+	// FlushCount flushes after that many values.
+	// Default: 100
+	FlushCount int
+
+	// OnError returns the value written as the last item when the
+	// iterator or the encoding fails once the response has started, e.g.
+	// Map{"error": err.Error()}. When nil the stream is cut, leaving a
+	// JSON array unterminated so that clients notice. NDJSON and JSON Lines
+	// streams cut after a line look complete, so set OnError for them when
+	// clients must tell a failure from the end. The error is returned
+	// either way.
+	// Default: nil
+	OnError func(err error) interface{}
+}
+
+// DefaultStreamConfig is the default JSON stream config
+var DefaultStreamConfig = StreamConfig{
+	FlushInterval: time.Second,
+	FlushCount:    100,
+}
+
+// StreamJSON streams the values of next as a JSON array, without holding
+// them in memory. An error of the first call to next is returned before
+// anything is written; it stops when the client disconnects.
+//
+//	app.Get("/export", func(c *ursa.Ctx) error {
+//		rows, err := db.QueryContext(c.Context(), "SELECT id, name FROM users")
+//		if err != nil {
+//			return err
+//		}
+//		defer rows.Close()
+//
+//		return c.StreamJSON(func(ctx context.Context) (interface{}, error) {
+//			if !rows.Next() {
+//				if err := rows.Err(); err != nil {
+//					return nil, err
+//				}
+//				return nil, io.EOF
+//			}
+//			var u User
+//			if err := rows.Scan(&u.ID, &u.Name); err != nil {
+//				return nil, err
+//			}
+//			return u, nil
+//		})
+//	})
+func (c *Ctx) StreamJSON(next JSONIterator, config ...StreamConfig) error {
+	return c.streamJSON(MIMEApplicationJSON, true, next, config)
+}
+
+// StreamNDJSON streams the values of next as newline delimited JSON, see
+// StreamJSON. A stream cut by an error looks complete unless
+// StreamConfig.OnError is set.
+func (c *Ctx) StreamNDJSON(next JSONIterator, config ...StreamConfig) error {
+	return c.streamJSON(MIMEApplicationNDJSON, false, next, config)
+}
+
+// StreamJSONLines streams the values of next as JSON Lines, which differs
+// from StreamNDJSON by its Content-Type only, see StreamJSON
+func (c *Ctx) StreamJSONLines(next JSONIterator, config ...StreamConfig) error {
+	return c.streamJSON(MIMEApplicationJSONLines, false, next, config)
+}
+
+func (c *Ctx) streamJSON(contentType string, array bool, next JSONIterator, config []StreamConfig) error {
+	cfg := DefaultStreamConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	// Set defaults
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultStreamConfig.FlushInterval
+	}
+	if cfg.FlushCount <= 0 {
+		cfg.FlushCount = DefaultStreamConfig.FlushCount
+	}
+
+	var (
+		ctx     = c.Context()
+		buf     bytes.Buffer
+		encoder = json.NewEncoder(&buf)
+		count   int
+	)
+
+	// encode writes v to buf, and nothing on error
+	encode := func(v interface{}) error {
+		if array && count > 0 {
+			buf.WriteByte(',')
+		}
+		if err := encoder.Encode(v); err != nil {
+			buf.Reset()
+			return err
+		}
+		if array {
+			buf.Truncate(buf.Len() - 1)
+		}
+		return nil
+	}
+
+	v, err := next(ctx)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if err == nil {
+		if err = encode(v); err != nil {
+			return err
+		}
+	}
+
+	c.Set("Content-Type", contentType)
+	c.Writer.Header().Del("Content-Length")
+	c.Writer.WriteHeaderNow()
+
+	if array {
+		_, _ = c.Writer.WriteString("[")
+	}
+
+	// values are flushed on a ticker, next may block for long
+	var (
+		lock    sync.Mutex
+		pending bool
+		done    = make(chan struct{})
+		stopped = make(chan struct{})
+	)
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(cfg.FlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				lock.Lock()
+				if pending {
+					_ = c.Flush()
+					pending = false
+				}
+				lock.Unlock()
+			}
+		}
+	}()
+
+	defer func() {
+		close(done)
+		<-stopped
+	}()
+
+	write := func() error {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if _, err := c.Writer.Write(buf.Bytes()); err != nil {
+			return err
+		}
+		buf.Reset()
+
+		count++
+		pending = true
+		if count%cfg.FlushCount == 0 {
+			_ = c.Flush()
+			pending = false
+		}
+
+		return nil
+	}
+
+	for err == nil {
+		if err = write(); err != nil {
+			break
+		}
+
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if v, err = next(ctx); err == nil {
+			lock.Lock()
+			err = encode(v)
+			lock.Unlock()
+		}
+	}
+
+	// the client is gone, there is no one to report the error to
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err != io.EOF {
+		if cfg.OnError == nil {
+			_ = c.Flush()
+			return err
+		}
+
+		buf.Reset()
+		if encode(cfg.OnError(err)) == nil {
+			_, _ = c.Writer.Write(buf.Bytes())
+		}
+	}
+
+	if array {
+		_, _ = c.Writer.WriteString("]")
+	}
+	_ = c.Flush()
+
+	if err == io.EOF {
+		return nil
+	}
+
+	return err
+}
+
+// NDJSONDecoder decodes the newline delimited JSON values of a request
+// body, see Ctx.NDJSON
+type NDJSONDecoder struct {
+	c           *Ctx
+	reader      *bufio.Reader
+	maxLineSize int
+	line        int
+}
+
+// NDJSON returns a decoder of the newline delimited JSON, or JSON Lines,
+// body of the request, for bulk ingest without reading it at once. Lines
+// are limited to maxLineSize bytes, 1MB by default.
+//
+//	dec := c.NDJSON()
+//	for {
+//		var item Item
+//		if err := dec.Decode(&item); err == io.EOF {
+//			break
+//		} else if err != nil {
+//			return err // 400 with the line number, or 413
+//		}
+//		// ...
+//	}
+func (c *Ctx) NDJSON(maxLineSize ...int) *NDJSONDecoder {
+	d := &NDJSONDecoder{c: c, reader: bufio.NewReader(c.Request.Body), maxLineSize: 1024 * 1024}
+	if len(maxLineSize) > 0 && maxLineSize[0] > 0 {
+		d.maxLineSize = maxLineSize[0]
+	}
+
+	return d
+}
+
+// Line returns the number of the line last decoded
+func (d *NDJSONDecoder) Line() int {
+	return d.line
+}
+
+// Decode decodes the next value into v, skipping blank lines, and returns
+// io.EOF after the last one. Errors are Err values: 400 for invalid JSON,
+// 413 for too long lines or bodies.
+func (d *NDJSONDecoder) Decode(v interface{}) error {
+	for {
+		line, err := d.readLine()
+		if err != nil {
+			return err
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		if err = json.Unmarshal(line, v); err != nil {
+			return NewNFError(400, "line "+strconv.Itoa(d.line)+": "+err.Error())
+		}
+
+		return nil
+	}
+}
+
+func (d *NDJSONDecoder) readLine() ([]byte, error) {
+	var line []byte
+
+	for {
+		chunk, err := d.reader.ReadSlice('\n')
+		line = append(line, chunk...)
+
+		if len(line) > d.maxLineSize+1 {
+			return nil, NewNFError(413, "line "+strconv.Itoa(d.line+1)+": too long")
+		}
+
+		switch {
+		case err == nil:
+			d.line++
+			return line, nil
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case err == io.EOF && len(line) > 0:
+			d.line++
+			return line, nil
+		case err == io.EOF:
+			return nil, io.EOF
+		default:
+			return nil, d.c.bodyError(err)
+		}
+	}
+}
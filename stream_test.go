@@ -0,0 +1,202 @@
+package ursa
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestStreamJSON tests the array, NDJSON and JSON Lines formats
+func TestStreamJSON(t *testing.T) {
+	type item struct {
+		N int `json:"n"`
+	}
+
+	app := New(Config{DisableLogger: true})
+	app.Get("/array", func(c *Ctx) error {
+		return c.StreamJSON(JSONSlice([]item{{1}, {2}, {3}}), StreamConfig{FlushCount: 2})
+	})
+	app.Get("/empty", func(c *Ctx) error {
+		return c.StreamJSON(JSONSlice([]item{}))
+	})
+	app.Get("/ndjson", func(c *Ctx) error {
+		ch := make(chan item)
+		go func() {
+			defer close(ch)
+			for i := 1; i <= 2; i++ {
+				ch <- item{i}
+			}
+		}()
+		return c.StreamNDJSON(JSONChan(ch))
+	})
+	app.Get("/jsonl", func(c *Ctx) error {
+		return c.StreamJSONLines(JSONSlice([]string{"a<b"}))
+	})
+
+	tests := []struct {
+		path, contentType, body string
+	}{
+		{"/array", MIMEApplicationJSON, `[{"n":1},{"n":2},{"n":3}]`},
+		{"/empty", MIMEApplicationJSON, `[]`},
+		{"/ndjson", MIMEApplicationNDJSON, "{\"n\":1}\n{\"n\":2}\n"},
+		{"/jsonl", MIMEApplicationJSONLines, "\"a\\u003cb\"\n"},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		if w.Code != 200 || w.Header().Get("Content-Type") != tt.contentType || w.Body.String() != tt.body {
+			t.Errorf("%s: unexpected response %d '%s' %q", tt.path, w.Code, w.Header().Get("Content-Type"), w.Body.String())
+		}
+		if !w.Flushed {
+			t.Errorf("%s: expected the response to be flushed", tt.path)
+		}
+	}
+}
+
+// TestStreamJSONErrors tests errors before and after the response started
+func TestStreamJSONErrors(t *testing.T) {
+	failing := func(n int, err error) JSONIterator {
+		i := 0
+		return func(ctx context.Context) (interface{}, error) {
+			if i++; i > n {
+				return nil, err
+			}
+			return i, nil
+		}
+	}
+	boom := errors.New("boom")
+
+	app := New(Config{DisableLogger: true})
+	app.Get("/first", func(c *Ctx) error {
+		return c.StreamJSON(failing(0, NewNFError(503, "Unavailable")))
+	})
+	app.Get("/cut", func(c *Ctx) error {
+		return c.StreamJSON(failing(2, boom))
+	})
+	app.Get("/reported", func(c *Ctx) error {
+		return c.StreamNDJSON(failing(1, boom), StreamConfig{OnError: func(err error) interface{} {
+			return Map{"error": err.Error()}
+		}})
+	})
+	app.Get("/encoding", func(c *Ctx) error {
+		return c.StreamJSON(JSONSlice([]interface{}{1, func() {}}), StreamConfig{OnError: func(err error) interface{} {
+			return "failed"
+		}})
+	})
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/first", 503, "Unavailable"},
+		{"/cut", 200, "[1,2"},
+		{"/reported", 200, "1\n{\"error\":\"boom\"}\n"},
+		{"/encoding", 200, `[1,"failed"]`},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		if w.Code != tt.code || w.Body.String() != tt.body {
+			t.Errorf("%s: unexpected response %d %q", tt.path, w.Code, w.Body.String())
+		}
+	}
+}
+
+// TestStreamJSONFlush tests the flush interval and client disconnects
+func TestStreamJSONFlush(t *testing.T) {
+	var (
+		ch     = make(chan int)
+		result = make(chan error, 1)
+	)
+
+	app := New(Config{DisableLogger: true})
+	app.Get("/stream", func(c *Ctx) error {
+		err := c.StreamNDJSON(JSONChan(ch), StreamConfig{FlushInterval: 10 * time.Millisecond})
+		result <- err
+		return err
+	})
+
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	go func() { ch <- 1 }()
+
+	resp, err := http.Get(srv.URL + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the value is flushed while the iterator blocks
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || line != "1\n" {
+		t.Fatalf("Unexpected line %q %v", line, err)
+	}
+
+	resp.Body.Close()
+
+	select {
+	case err = <-result:
+		if err != nil {
+			t.Errorf("Expected nil after the client left, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the stream to stop")
+	}
+}
+
+// TestNDJSONDecoder tests decoding request bodies line by line
+func TestNDJSONDecoder(t *testing.T) {
+	type item struct {
+		N int `json:"n"`
+	}
+
+	app := New(Config{DisableLogger: true})
+	app.Post("/ingest", func(c *Ctx) error {
+		var sum int
+
+		dec := c.NDJSON(32)
+		for {
+			var it item
+			if err := dec.Decode(&it); err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+			sum += it.N
+		}
+
+		return c.SendString(strconv.Itoa(sum) + "/" + strconv.Itoa(dec.Line()))
+	})
+
+	tests := []struct {
+		body string
+		code int
+		resp string
+	}{
+		{"{\"n\":1}\n\n{\"n\":2}\r\n{\"n\":3}", 200, "6/4"},
+		{"", 200, "0/0"},
+		{"{\"n\":1}\n{\"n\":2}\n{\"n\":\n", 400, "line 3: "},
+		{"{\"n\":1}\n{\"n\":" + strings.Repeat(" ", 40) + "2}\n", 413, "line 2: too long"},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ingest", strings.NewReader(tt.body)))
+
+		if w.Code != tt.code || !strings.HasPrefix(w.Body.String(), tt.resp) {
+			t.Errorf("%q: unexpected response %d %q", tt.body, w.Code, w.Body.String())
+		}
+	}
+}
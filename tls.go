@@ -0,0 +1,286 @@
+package ursa
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// TLSFiles defines the certificate files served by a TLSReloader
+type TLSFiles struct {
+	// CertFile and KeyFile are the PEM encoded server certificate chain
+	// and private key.
+	// Required.
+	CertFile string
+	KeyFile  string
+
+	// ClientCAFile is a PEM bundle of the CAs trusted to sign client
+	// certificates, it enables mutual TLS.
+	// Default: "" (no client certificate)
+	ClientCAFile string
+
+	// ClientAuth is the client certificate policy when ClientCAFile is set,
+	// e.g. tls.VerifyClientCertIfGiven to make certificates optional.
+	// Default: tls.RequireAndVerifyClientCert
+	ClientAuth tls.ClientAuthType
+
+	// ReloadInterval is how often the files are checked for changes, a
+	// negative value disables the check. Files are also reloaded on SIGHUP.
+	// Default: 10s
+	ReloadInterval time.Duration
+
+	// OnReload is called after each reload attempt, with the error of a
+	// failed one. The previous certificates keep being served on failure.
+	// Default: nil
+	OnReload func(err error)
+}
+
+// TLSReloader serves certificates read from files and reloads them when
+// they change or the process receives SIGHUP, without restarting the
+// server. Use its TLSConfig with RunTLS, or App.RunTLSFiles.
+type TLSReloader struct {
+	files TLSFiles
+
+	lock      sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	stamps    []fileStamp
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewTLSReloader loads the files and starts watching them
+func NewTLSReloader(files TLSFiles) (*TLSReloader, error) {
+	if files.CertFile == "" || files.KeyFile == "" {
+		return nil, errors.New("tls: CertFile and KeyFile are required")
+	}
+
+	// Set defaults
+	if files.ClientCAFile != "" && files.ClientAuth == tls.NoClientCert {
+		files.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	if files.ReloadInterval == 0 {
+		files.ReloadInterval = 10 * time.Second
+	}
+
+	r := &TLSReloader{files: files, done: make(chan struct{})}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	go r.watch()
+
+	return r, nil
+}
+
+// Reload reads the files again. On error the previous certificates are kept.
+func (r *TLSReloader) Reload() error {
+	err := r.load()
+	if r.files.OnReload != nil {
+		r.files.OnReload(err)
+	}
+
+	return err
+}
+
+func (r *TLSReloader) load() error {
+	stamps := r.stat()
+
+	cert, err := tls.LoadX509KeyPair(r.files.CertFile, r.files.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	var pool *x509.CertPool
+	if r.files.ClientCAFile != "" {
+		bs, err := os.ReadFile(r.files.ClientCAFile)
+		if err != nil {
+			return err
+		}
+
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(bs) {
+			return errors.New("tls: no certificate found in " + r.files.ClientCAFile)
+		}
+	}
+
+	r.lock.Lock()
+	r.cert = &cert
+	r.clientCAs = pool
+	r.stamps = stamps
+	r.lock.Unlock()
+
+	return nil
+}
+
+func (r *TLSReloader) stat() []fileStamp {
+	names := []string{r.files.CertFile, r.files.KeyFile, r.files.ClientCAFile}
+	stamps := make([]fileStamp, len(names))
+
+	for i, name := range names {
+		if name == "" {
+			continue
+		}
+		if info, err := os.Stat(name); err == nil {
+			stamps[i] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+
+	return stamps
+}
+
+func (r *TLSReloader) changed() bool {
+	stamps := r.stat()
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	for i := range stamps {
+		if stamps[i] != r.stamps[i] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *TLSReloader) watch() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if r.files.ReloadInterval > 0 {
+		ticker := time.NewTicker(r.files.ReloadInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-hup:
+			_ = r.Reload()
+		case <-tick:
+			if r.changed() {
+				_ = r.Reload()
+			}
+		}
+	}
+}
+
+// Close stops watching the files
+func (r *TLSReloader) Close() error {
+	r.closeOnce.Do(func() { close(r.done) })
+	return nil
+}
+
+// Certificate returns the certificate currently served
+func (r *TLSReloader) Certificate() *tls.Certificate {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.cert
+}
+
+// TLSConfig returns a config serving the current certificates, and
+// verifying client certificates when ClientCAFile is set.
+func (r *TLSReloader) TLSConfig() *tls.Config {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.Certificate(), nil
+		},
+	}
+
+	if r.files.ClientCAFile == "" {
+		return config
+	}
+
+	config.ClientAuth = r.files.ClientAuth
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		// the CA pool is only read from the config, so hand out a copy
+		// holding the current one
+		r.lock.RLock()
+		pool := r.clientCAs
+		r.lock.RUnlock()
+
+		conf := config.Clone()
+		conf.ClientCAs = pool
+		conf.GetConfigForClient = nil
+
+		return conf, nil
+	}
+
+	return config
+}
+
+// RunTLSFiles serves HTTPS with certificates read from files, reloaded on
+// change and on SIGHUP, see TLSFiles.
+func (a *App) RunTLSFiles(address string, files TLSFiles) error {
+	reloader, err := NewTLSReloader(files)
+	if err != nil {
+		return err
+	}
+	defer reloader.Close()
+
+	return a.RunTLS(address, reloader.TLSConfig())
+}
+
+// ClientIdentity is the identity carried by a verified client certificate
+type ClientIdentity struct {
+	Certificate    *x509.Certificate
+	CommonName     string
+	DNSNames       []string
+	EmailAddresses []string
+	IPAddresses    []net.IP
+	URIs           []*url.URL
+
+	// SPIFFEID is the first "spiffe://" URI SAN, e.g.
+	// "spiffe://example.org/ns/prod/sa/billing".
+	SPIFFEID string
+}
+
+// ClientCert returns the identity of the client certificate verified
+// during the TLS handshake, or nil when the client sent none or it was
+// not verified against the trusted client CAs.
+func (c *Ctx) ClientCert() *ClientIdentity {
+	state := c.Request.TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	cert := state.VerifiedChains[0][0]
+	id := &ClientIdentity{
+		Certificate:    cert,
+		CommonName:     cert.Subject.CommonName,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		IPAddresses:    cert.IPAddresses,
+		URIs:           cert.URIs,
+	}
+
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			id.SPIFFEID = uri.String()
+			break
+		}
+	}
+
+	return id
+}
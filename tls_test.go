@@ -0,0 +1,182 @@
+package ursa
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, template *x509.Certificate, parent *testCert) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, _ := x509.ParseCertificate(der)
+
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+func (tc *testCert) write(t *testing.T, certFile, keyFile string) {
+	t.Helper()
+
+	keyDER, _ := x509.MarshalECPrivateKey(tc.key)
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tc.der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if keyFile != "" {
+		if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestTLSReloaderMutualTLS tests client certificate verification, ClientCert and reloading
+func TestTLSReloaderMutualTLS(t *testing.T) {
+	var (
+		dir      = t.TempDir()
+		certFile = filepath.Join(dir, "server.pem")
+		keyFile  = filepath.Join(dir, "server.key")
+		caFile   = filepath.Join(dir, "ca.pem")
+	)
+
+	ca := newTestCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	ca.write(t, caFile, "")
+
+	serverTemplate := func(name string) *x509.Certificate {
+		return &x509.Certificate{
+			Subject:     pkix.Name{CommonName: name},
+			IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+	}
+	newTestCert(t, serverTemplate("server one"), ca).write(t, certFile, keyFile)
+
+	spiffe, _ := url.Parse("spiffe://example.org/ns/prod/sa/billing")
+	client := newTestCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "billing"},
+		URIs:        []*url.URL{spiffe},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+
+	reloads := make(chan error, 4)
+	reloader, err := NewTLSReloader(TLSFiles{
+		CertFile:       certFile,
+		KeyFile:        keyFile,
+		ClientCAFile:   caFile,
+		ReloadInterval: -1,
+		OnReload:       func(err error) { reloads <- err },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloader.Close()
+	<-reloads
+
+	app := New(Config{DisableBanner: true, DisableMessagePrint: true})
+	app.Get("/whoami", NewClientCertAuth(nil), func(c *Ctx) error {
+		id := c.ClientCert()
+		return c.SendString(id.CommonName + " " + id.SPIFFEID)
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() { _ = app.RunListenerTls(ln, reloader.TLSConfig()) }()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	get := func(withCert bool) (string, string, error) {
+		config := &tls.Config{RootCAs: roots}
+		if withCert {
+			config.Certificates = []tls.Certificate{{Certificate: [][]byte{client.der}, PrivateKey: client.key}}
+		}
+
+		hc := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+		defer hc.CloseIdleConnections()
+
+		resp, err := hc.Get("https://" + ln.Addr().String() + "/whoami")
+		if err != nil {
+			return "", "", err
+		}
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+		return string(body), resp.TLS.PeerCertificates[0].Subject.CommonName, nil
+	}
+
+	body, server, err := get(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "billing spiffe://example.org/ns/prod/sa/billing" || server != "server one" {
+		t.Errorf("Expected client identity from server one, got '%s' from '%s'", body, server)
+	}
+
+	if _, _, err = get(false); err == nil {
+		t.Error("Expected handshake to fail without client certificate")
+	}
+
+	newTestCert(t, serverTemplate("server two"), ca).write(t, certFile, keyFile)
+	if err = reloader.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, server, err = get(true); err != nil || server != "server two" {
+		t.Errorf("Expected reloaded certificate, got '%s' (%v)", server, err)
+	}
+
+	// a broken file keeps the previous certificate
+	_ = os.WriteFile(keyFile, []byte("garbage"), 0o600)
+	if err = reloader.Reload(); err == nil {
+		t.Error("Expected reload error for a broken key")
+	}
+
+	if _, server, err = get(true); err != nil || server != "server two" {
+		t.Errorf("Expected previous certificate after failed reload, got '%s' (%v)", server, err)
+	}
+}
@@ -0,0 +1,616 @@
+package ursa
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,creation-with-upload,expiration,termination"
+	tusMIME       = "application/offset+octet-stream"
+)
+
+var (
+	// ErrTusNotFound is returned by TusStore implementations for unknown uploads
+	ErrTusNotFound = errors.New("tus: upload not found")
+
+	// ErrTusOffset is returned by TusStore.Append when the offset is not
+	// the current size of the upload
+	ErrTusOffset = errors.New("tus: offset mismatch")
+)
+
+// TusUpload describes a resumable upload
+type TusUpload struct {
+	ID       string            `json:"id"`
+	Size     int64             `json:"size"`
+	Offset   int64             `json:"-"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Expires  time.Time         `json:"expires"`
+}
+
+// Complete reports whether all the bytes of the upload were received
+func (u TusUpload) Complete() bool {
+	return u.Offset >= u.Size
+}
+
+// TusStore keeps the uploads of a tus server, see NewTusFileStore
+type TusStore interface {
+	// Create stores a new empty upload.
+	Create(upload TusUpload) error
+
+	// Info returns an upload, with Offset set to the number of bytes
+	// received, or ErrTusNotFound.
+	Info(id string) (TusUpload, error)
+
+	// Append writes r at offset, which must be the current Offset of the
+	// upload or else ErrTusOffset is returned. The bytes written before a
+	// read error are kept, it returns their count.
+	Append(id string, offset int64, r io.Reader) (int64, error)
+
+	// Delete removes an upload, complete or not.
+	Delete(id string) error
+
+	// DeleteExpired removes the incomplete uploads which expired before now.
+	DeleteExpired(now time.Time) error
+}
+
+// TusConfig defines the config of a tus server, see RouterGroup.Tus
+type TusConfig struct {
+	// Store keeps the uploads.
+	// Required.
+	Store TusStore
+
+	// MaxSize is the maximum size of an upload, advertised as Tus-Max-Size.
+	// Default: 0 (unlimited)
+	MaxSize int64
+
+	// Expiration is how long an incomplete upload is kept after its
+	// creation, advertised as Upload-Expires.
+	// Default: 24h
+	Expiration time.Duration
+
+	// OnCreate is called before an upload is created, the request is
+	// answered with the error it returns, if any.
+	// Default: nil
+	OnCreate func(c *Ctx, upload TusUpload) error
+
+	// OnComplete is called once, by the request receiving the last byte of
+	// an upload, which is answered with the error it returns, if any.
+	// Default: nil
+	OnComplete func(c *Ctx, upload TusUpload) error
+}
+
+type tusServer struct {
+	config   TusConfig
+	basePath string
+
+	lock   sync.Mutex
+	busy   map[string]bool
+	lastGC int64
+}
+
+// Tus serves the tus 1.0 resumable upload protocol at relativePath, with
+// the creation, creation-with-upload, expiration and termination
+// extensions: uploads are created with POST on relativePath, and resumed
+// with HEAD and PATCH or terminated with DELETE on relativePath/:id.
+// Appends are bounded by the length of the upload rather than the body
+// limit, so that clients may send the whole file in one request.
+//
+//	store, _ := ursa.NewTusFileStore("/var/lib/uploads")
+//	app.Group("/api").Tus("/files", ursa.TusConfig{
+//		Store: store,
+//		OnComplete: func(c *ursa.Ctx, upload ursa.TusUpload) error {
+//			return store.MoveTo(upload.ID, "/srv/media/"+upload.ID)
+//		},
+//	})
+func (group *RouterGroup) Tus(relativePath string, config TusConfig) IRoutes {
+	elsePanic(config.Store != nil, "tus: Store is required")
+
+	// Set defaults
+	if config.Expiration <= 0 {
+		config.Expiration = 24 * time.Hour
+	}
+
+	s := &tusServer{
+		config:   config,
+		basePath: strings.TrimSuffix(group.calculateAbsolutePath(relativePath), "/"),
+		busy:     make(map[string]bool),
+	}
+
+	unlimited := group.WithMeta(MetaBodyLimit, int64(-1))
+	relativePath = strings.TrimSuffix(relativePath, "/")
+
+	group.Options(relativePath, s.options)
+	group.Options(relativePath+"/:id", s.options)
+	unlimited.Post(relativePath, s.create)
+	group.Head(relativePath+"/:id", s.head)
+	unlimited.Patch(relativePath+"/:id", s.patch)
+	group.Delete(relativePath+"/:id", s.terminate)
+
+	return group.returnObj()
+}
+
+func (s *tusServer) options(c *Ctx) error {
+	h := c.Writer.Header()
+	h.Set("Tus-Resumable", tusVersion)
+	h.Set("Tus-Version", tusVersion)
+	h.Set("Tus-Extension", tusExtensions)
+	if s.config.MaxSize > 0 {
+		h.Set("Tus-Max-Size", strconv.FormatInt(s.config.MaxSize, 10))
+	}
+
+	return c.SendStatus(http.StatusNoContent)
+}
+
+// check sets Tus-Resumable and verifies the version requested by the client
+func (s *tusServer) check(c *Ctx) error {
+	c.Set("Tus-Resumable", tusVersion)
+
+	if c.Get("Tus-Resumable") != tusVersion {
+		c.Set("Tus-Version", tusVersion)
+		return NewNFError(http.StatusPreconditionFailed, "Unsupported tus version")
+	}
+
+	return nil
+}
+
+func (s *tusServer) create(c *Ctx) error {
+	if err := s.check(c); err != nil {
+		return err
+	}
+
+	if c.Get("Upload-Defer-Length") != "" {
+		return NewNFError(http.StatusBadRequest, "Upload-Defer-Length is not supported")
+	}
+
+	size, err := strconv.ParseInt(c.Get("Upload-Length"), 10, 64)
+	if err != nil || size < 0 {
+		return NewNFError(http.StatusBadRequest, "Invalid Upload-Length")
+	}
+	if s.config.MaxSize > 0 && size > s.config.MaxSize {
+		return NewNFError(http.StatusRequestEntityTooLarge, "Upload-Length exceeds Tus-Max-Size")
+	}
+
+	metadata, err := parseTusMetadata(c.Get("Upload-Metadata"))
+	if err != nil {
+		return NewNFError(http.StatusBadRequest, "Invalid Upload-Metadata")
+	}
+
+	now := time.Now()
+	s.gc(now)
+
+	upload := TusUpload{
+		ID:       tusID(),
+		Size:     size,
+		Metadata: metadata,
+		Expires:  now.Add(s.config.Expiration),
+	}
+
+	if s.config.OnCreate != nil {
+		if err = s.config.OnCreate(c, upload); err != nil {
+			return err
+		}
+	}
+
+	if err = s.config.Store.Create(upload); err != nil {
+		return err
+	}
+
+	h := c.Writer.Header()
+	h.Set("Location", s.basePath+"/"+upload.ID)
+	h.Set("Upload-Expires", upload.Expires.UTC().Format(http.TimeFormat))
+
+	// creation-with-upload, the body holds the first bytes
+	if c.Get("Content-Type") == tusMIME {
+		if upload, err = s.append(c, upload); err != nil {
+			return err
+		}
+		h.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	}
+
+	// an empty upload is complete from its creation
+	if size == 0 && s.config.OnComplete != nil {
+		if err = s.config.OnComplete(c, upload); err != nil {
+			return err
+		}
+	}
+
+	return c.SendStatus(http.StatusCreated)
+}
+
+// info returns the upload named by the :id param, answering 404 for
+// unknown uploads and 410 for expired ones
+func (s *tusServer) info(c *Ctx) (TusUpload, error) {
+	upload, err := s.config.Store.Info(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, ErrTusNotFound) {
+			return upload, NewNFError(http.StatusNotFound, "Not Found")
+		}
+		return upload, err
+	}
+
+	if !upload.Complete() && time.Now().After(upload.Expires) {
+		_ = s.config.Store.Delete(upload.ID)
+		return upload, NewNFError(http.StatusGone, "Gone")
+	}
+
+	return upload, nil
+}
+
+func (s *tusServer) head(c *Ctx) error {
+	if err := s.check(c); err != nil {
+		return err
+	}
+
+	upload, err := s.info(c)
+	if err != nil {
+		return err
+	}
+
+	h := c.Writer.Header()
+	h.Set("Cache-Control", "no-store")
+	h.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	h.Set("Upload-Length", strconv.FormatInt(upload.Size, 10))
+	if len(upload.Metadata) > 0 {
+		h.Set("Upload-Metadata", encodeTusMetadata(upload.Metadata))
+	}
+	if !upload.Complete() {
+		h.Set("Upload-Expires", upload.Expires.UTC().Format(http.TimeFormat))
+	}
+
+	return c.SendStatus(http.StatusOK)
+}
+
+func (s *tusServer) patch(c *Ctx) error {
+	if err := s.check(c); err != nil {
+		return err
+	}
+
+	if c.Get("Content-Type") != tusMIME {
+		return NewNFError(http.StatusUnsupportedMediaType, "Content-Type must be "+tusMIME)
+	}
+
+	offset, err := strconv.ParseInt(c.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return NewNFError(http.StatusBadRequest, "Invalid Upload-Offset")
+	}
+
+	upload, err := s.info(c)
+	if err != nil {
+		return err
+	}
+
+	if offset != upload.Offset {
+		return NewNFError(http.StatusConflict, "Upload-Offset mismatch")
+	}
+
+	h := c.Writer.Header()
+
+	// nothing is left to append, OnComplete was already called
+	if upload.Complete() {
+		h.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		return c.SendStatus(http.StatusNoContent)
+	}
+
+	if upload, err = s.append(c, upload); err != nil {
+		return err
+	}
+
+	h.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	if !upload.Complete() {
+		h.Set("Upload-Expires", upload.Expires.UTC().Format(http.TimeFormat))
+	}
+
+	return c.SendStatus(http.StatusNoContent)
+}
+
+// append writes the body at the offset of upload, one request at a time
+// per upload, and calls OnComplete when it receives the last byte
+func (s *tusServer) append(c *Ctx, upload TusUpload) (TusUpload, error) {
+	complete := upload.Complete()
+
+	s.lock.Lock()
+	if s.busy[upload.ID] {
+		s.lock.Unlock()
+		return upload, NewNFError(http.StatusLocked, "Upload is locked by another request")
+	}
+	s.busy[upload.ID] = true
+	s.lock.Unlock()
+
+	defer func() {
+		s.lock.Lock()
+		delete(s.busy, upload.ID)
+		s.lock.Unlock()
+	}()
+
+	n, err := s.config.Store.Append(upload.ID, upload.Offset, io.LimitReader(c.Request.Body, upload.Size-upload.Offset))
+	upload.Offset += n
+
+	if err != nil {
+		if errors.Is(err, ErrTusOffset) {
+			return upload, NewNFError(http.StatusConflict, "Upload-Offset mismatch")
+		}
+		return upload, err
+	}
+
+	if !complete && upload.Complete() && s.config.OnComplete != nil {
+		if err = s.config.OnComplete(c, upload); err != nil {
+			return upload, err
+		}
+	}
+
+	return upload, nil
+}
+
+func (s *tusServer) terminate(c *Ctx) error {
+	if err := s.check(c); err != nil {
+		return err
+	}
+
+	if _, err := s.info(c); err != nil {
+		return err
+	}
+
+	if err := s.config.Store.Delete(c.Param("id")); err != nil {
+		return err
+	}
+
+	return c.SendStatus(http.StatusNoContent)
+}
+
+// gc removes expired uploads at most once per minute
+func (s *tusServer) gc(now time.Time) {
+	s.lock.Lock()
+	if now.UnixNano()-s.lastGC < int64(memoryStorageGC) {
+		s.lock.Unlock()
+		return
+	}
+	s.lastGC = now.UnixNano()
+	s.lock.Unlock()
+
+	_ = s.config.Store.DeleteExpired(now)
+}
+
+func tusID() string {
+	bs := make([]byte, 16)
+	if _, err := rand.Read(bs); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(bs)
+}
+
+// parseTusMetadata parses "key base64value,key2 base64value2", values
+// being optional
+func parseTusMetadata(header string) (map[string]string, error) {
+	if strings.TrimSpace(header) == "" {
+		return nil, nil
+	}
+
+	metadata := make(map[string]string)
+
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("tus: empty metadata key")
+		}
+
+		bs, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return nil, err
+		}
+
+		metadata[key] = string(bs)
+	}
+
+	return metadata, nil
+}
+
+func encodeTusMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if metadata[key] == "" {
+			pairs = append(pairs, key)
+			continue
+		}
+		pairs = append(pairs, key+" "+base64.StdEncoding.EncodeToString([]byte(metadata[key])))
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+// TusFileStore is a TusStore keeping each upload as two files in a
+// directory: <id> holds the received bytes and <id>.info its description.
+type TusFileStore struct {
+	dir string
+}
+
+var _ TusStore = (*TusFileStore)(nil)
+
+// NewTusFileStore returns a TusFileStore in dir, creating it if needed
+func NewTusFileStore(dir string) (*TusFileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &TusFileStore{dir: dir}, nil
+}
+
+// Path returns the file holding the bytes of an upload, to read it. Use
+// MoveTo to keep it, its description would be left behind otherwise.
+func (s *TusFileStore) Path(id string) string {
+	return filepath.Join(s.dir, id)
+}
+
+// MoveTo renames the file holding the bytes of a complete upload to path,
+// typically from OnComplete, and removes the upload from the store.
+func (s *TusFileStore) MoveTo(id, path string) error {
+	upload, err := s.Info(id)
+	if err != nil {
+		return err
+	}
+	if !upload.Complete() {
+		return errors.New("tus: upload " + id + " is incomplete")
+	}
+
+	if err = os.Rename(s.Path(id), path); err != nil {
+		return err
+	}
+
+	if err = os.Remove(s.Path(id) + ".info"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// validTusID rejects ids which are not generated by the server, so that
+// they are safe to use as file names
+func validTusID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+
+	_, err := hex.DecodeString(id)
+
+	return err == nil && strings.ToLower(id) == id
+}
+
+func (s *TusFileStore) Create(upload TusUpload) error {
+	if !validTusID(upload.ID) {
+		return ErrTusNotFound
+	}
+
+	bs, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(s.Path(upload.ID), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	_ = f.Close()
+
+	if err = os.WriteFile(s.Path(upload.ID)+".info", bs, 0o600); err != nil {
+		_ = os.Remove(s.Path(upload.ID))
+		return err
+	}
+
+	return nil
+}
+
+func (s *TusFileStore) Info(id string) (TusUpload, error) {
+	var upload TusUpload
+
+	if !validTusID(id) {
+		return upload, ErrTusNotFound
+	}
+
+	bs, err := os.ReadFile(s.Path(id) + ".info")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return upload, ErrTusNotFound
+		}
+		return upload, err
+	}
+
+	if err = json.Unmarshal(bs, &upload); err != nil {
+		return upload, err
+	}
+
+	// the offset is the size of the data file, exact even after a crash
+	info, err := os.Stat(s.Path(id))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return upload, ErrTusNotFound
+		}
+		return upload, err
+	}
+	upload.Offset = info.Size()
+
+	return upload, nil
+}
+
+func (s *TusFileStore) Append(id string, offset int64, r io.Reader) (int64, error) {
+	if !validTusID(id) {
+		return 0, ErrTusNotFound
+	}
+
+	f, err := os.OpenFile(s.Path(id), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, ErrTusNotFound
+		}
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if info.Size() != offset {
+		return 0, ErrTusOffset
+	}
+
+	return copyZeroAlloc(f, r)
+}
+
+func (s *TusFileStore) Delete(id string) error {
+	if !validTusID(id) {
+		return ErrTusNotFound
+	}
+
+	for _, name := range []string{s.Path(id), s.Path(id) + ".info"} {
+		if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *TusFileStore) DeleteExpired(now time.Time) error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".info")
+		if !ok || !validTusID(id) {
+			continue
+		}
+
+		upload, err := s.Info(id)
+		if err != nil {
+			continue
+		}
+
+		if !upload.Complete() && now.After(upload.Expires) {
+			_ = s.Delete(id)
+		}
+	}
+
+	return nil
+}
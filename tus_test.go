@@ -0,0 +1,168 @@
+package ursa
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestTus tests creation, resuming, completion and termination of uploads
+func TestTus(t *testing.T) {
+	store, err := NewTusFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	completed := make(map[string]string)
+	calls := 0
+	app := New(Config{DisableLogger: true, BodyLimit: 4})
+	app.Group("/api").Tus("/files", TusConfig{
+		Store:   store,
+		MaxSize: 1024,
+		OnComplete: func(c *Ctx, upload TusUpload) error {
+			calls++
+			bs, err := os.ReadFile(store.Path(upload.ID))
+			completed[upload.Metadata["filename"]] = string(bs)
+			return err
+		},
+	})
+
+	w := doRequest(app, http.MethodOptions, "/api/files", nil, "Tus-Resumable", "1.0.0")
+	if w.Code != 204 || w.Header().Get("Tus-Version") != "1.0.0" || w.Header().Get("Tus-Max-Size") != "1024" || !strings.Contains(w.Header().Get("Tus-Extension"), "termination") {
+		t.Errorf("Unexpected OPTIONS response %d %v", w.Code, w.Header())
+	}
+
+	// "hello.txt" and "text/plain"
+	w = doRequest(app, http.MethodPost, "/api/files", nil, "Tus-Resumable", "1.0.0", "Upload-Length", "11", "Upload-Metadata", "filename aGVsbG8udHh0,filetype dGV4dC9wbGFpbg==,empty")
+	location := w.Header().Get("Location")
+	if w.Code != 201 || !strings.HasPrefix(location, "/api/files/") || w.Header().Get("Upload-Expires") == "" {
+		t.Fatalf("Unexpected creation response %d %v", w.Code, w.Header())
+	}
+
+	// appends are not bound by the body limit of 4 bytes
+	w = doRequest(app, http.MethodPatch, location, strings.NewReader("hello "), "Tus-Resumable", "1.0.0", "Content-Type", "application/offset+octet-stream", "Upload-Offset", "0")
+	if w.Code != 204 || w.Header().Get("Upload-Offset") != "6" {
+		t.Fatalf("Unexpected PATCH response %d %v (%s)", w.Code, w.Header(), w.Body.String())
+	}
+
+	w = doRequest(app, http.MethodHead, location, nil, "Tus-Resumable", "1.0.0")
+	if w.Code != 200 || w.Header().Get("Upload-Offset") != "6" || w.Header().Get("Upload-Length") != "11" || w.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("Unexpected HEAD response %d %v", w.Code, w.Header())
+	}
+	if md := w.Header().Get("Upload-Metadata"); md != "empty,filename aGVsbG8udHh0,filetype dGV4dC9wbGFpbg==" {
+		t.Errorf("Unexpected Upload-Metadata '%s'", md)
+	}
+
+	if w = doRequest(app, http.MethodPatch, location, strings.NewReader("world"), "Tus-Resumable", "1.0.0", "Content-Type", "application/offset+octet-stream", "Upload-Offset", "3"); w.Code != 409 {
+		t.Errorf("Expected 409 for a wrong offset, got %d", w.Code)
+	}
+	if w = doRequest(app, http.MethodPatch, location, strings.NewReader("world"), "Tus-Resumable", "1.0.0", "Content-Type", "text/plain", "Upload-Offset", "6"); w.Code != 415 {
+		t.Errorf("Expected 415 for a wrong content type, got %d", w.Code)
+	}
+
+	// bytes past the length are not written
+	w = doRequest(app, http.MethodPatch, location, strings.NewReader("world!!!"), "Tus-Resumable", "1.0.0", "Content-Type", "application/offset+octet-stream", "Upload-Offset", "6")
+	if w.Code != 204 || w.Header().Get("Upload-Offset") != "11" {
+		t.Fatalf("Unexpected final PATCH response %d %v", w.Code, w.Header())
+	}
+	if completed["hello.txt"] != "hello world" {
+		t.Errorf("Expected completed upload, got %v", completed)
+	}
+
+	// empty appends to a complete upload do not complete it again
+	for i := 0; i < 2; i++ {
+		w = doRequest(app, http.MethodPatch, location, nil, "Tus-Resumable", "1.0.0", "Content-Type", "application/offset+octet-stream", "Upload-Offset", "11")
+		if w.Code != 204 || w.Header().Get("Upload-Offset") != "11" {
+			t.Errorf("Unexpected PATCH of a complete upload %d %v", w.Code, w.Header())
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected OnComplete called once, got %d", calls)
+	}
+
+	// creation-with-upload
+	w = doRequest(app, http.MethodPost, "/api/files", strings.NewReader("abc"), "Tus-Resumable", "1.0.0", "Upload-Length", "3", "Upload-Metadata", "filename YS50eHQ=", "Content-Type", "application/offset+octet-stream")
+	if w.Code != 201 || w.Header().Get("Upload-Offset") != "3" || completed["a.txt"] != "abc" {
+		t.Errorf("Unexpected creation with upload %d %v %v", w.Code, w.Header(), completed)
+	}
+
+	req := httptest.NewRequest(http.MethodHead, location, nil)
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	if rec.Code != 412 || rec.Header().Get("Tus-Version") != "1.0.0" {
+		t.Errorf("Expected 412 without Tus-Resumable, got %d", rec.Code)
+	}
+
+	if w = doRequest(app, http.MethodPost, "/api/files", nil, "Tus-Resumable", "1.0.0", "Upload-Length", "2048"); w.Code != 413 {
+		t.Errorf("Expected 413 over Tus-Max-Size, got %d", w.Code)
+	}
+	if w = doRequest(app, http.MethodHead, "/api/files/../../etc/passwd", nil, "Tus-Resumable", "1.0.0"); w.Code != 404 {
+		t.Errorf("Expected 404 for an invalid id, got %d", w.Code)
+	}
+
+	if w = doRequest(app, http.MethodDelete, location, nil, "Tus-Resumable", "1.0.0"); w.Code != 204 {
+		t.Errorf("Expected 204 on termination, got %d", w.Code)
+	}
+	if w = doRequest(app, http.MethodHead, location, nil, "Tus-Resumable", "1.0.0"); w.Code != 404 {
+		t.Errorf("Expected 404 after termination, got %d", w.Code)
+	}
+}
+
+// TestTusExpiration tests that incomplete uploads expire
+func TestTusExpiration(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewTusFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := New(Config{DisableLogger: true})
+	app.Tus("/files", TusConfig{Store: store, Expiration: 20 * time.Millisecond})
+
+	location := doRequest(app, http.MethodPost, "/files", nil, "Tus-Resumable", "1.0.0", "Upload-Length", "10").Header().Get("Location")
+	time.Sleep(30 * time.Millisecond)
+
+	if w := doRequest(app, http.MethodHead, location, nil, "Tus-Resumable", "1.0.0"); w.Code != 410 {
+		t.Errorf("Expected 410 for an expired upload, got %d", w.Code)
+	}
+	if w := doRequest(app, http.MethodHead, location, nil, "Tus-Resumable", "1.0.0"); w.Code != 404 {
+		t.Errorf("Expected expired upload removed, got %d", w.Code)
+	}
+
+	// DeleteExpired sweeps incomplete uploads only
+	_ = store.Create(TusUpload{ID: tusID(), Size: 5, Expires: time.Now().Add(-time.Minute)})
+	done := TusUpload{ID: tusID(), Size: 2, Expires: time.Now().Add(-time.Minute)}
+	_ = store.Create(done)
+	if _, err = store.Append(done.ID, 0, strings.NewReader("ok")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = store.DeleteExpired(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("Expected only the complete upload kept, got %d files", len(entries))
+	}
+	if _, err = store.Append(done.ID, 0, io.LimitReader(strings.NewReader("x"), 1)); err != ErrTusOffset {
+		t.Errorf("Expected ErrTusOffset, got %v", err)
+	}
+
+	// MoveTo keeps the bytes and forgets the upload
+	moved := filepath.Join(t.TempDir(), "moved")
+	if err = store.MoveTo(done.ID, moved); err != nil {
+		t.Fatal(err)
+	}
+	if bs, _ := os.ReadFile(moved); string(bs) != "ok" {
+		t.Errorf("Unexpected moved content '%s'", bs)
+	}
+	if entries, _ = os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected no file left, got %d", len(entries))
+	}
+}
@@ -0,0 +1,336 @@
+package ursa
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// UploadConfig defines the limits of Ctx.Upload. The whole body remains
+// limited by Config.BodyLimit or MetaBodyLimit.
+type UploadConfig struct {
+	// MaxFileSize is the maximum size of each file, a negative value
+	// disables the check.
+	// Default: 32MB
+	MaxFileSize int64
+
+	// MaxFiles is the maximum number of files.
+	// Default: 10
+	MaxFiles int
+
+	// MaxFieldSize is the maximum size of each non-file field.
+	// Default: 1MB
+	MaxFieldSize int64
+
+	// AllowedTypes lists the MIME types accepted for files, e.g.
+	// "image/png" or "image/*". The type is sniffed from the first 512
+	// bytes of the content, the Content-Type sent by the client is ignored.
+	// Default: nil (any type)
+	AllowedTypes []string
+
+	// OnProgress is called as file content is read.
+	// Default: nil
+	OnProgress func(p UploadProgress)
+}
+
+// DefaultUploadConfig is the default Ctx.Upload config
+var DefaultUploadConfig = UploadConfig{
+	MaxFileSize:  32 * 1024 * 1024,
+	MaxFiles:     10,
+	MaxFieldSize: 1024 * 1024,
+}
+
+// UploadProgress reports the progress of an upload
+type UploadProgress struct {
+	FormName string
+	FileName string
+
+	// Bytes is the number of bytes read from the current file, and Total
+	// from all the files so far.
+	Bytes int64
+	Total int64
+
+	// ContentLength is the length of the request body, -1 when unknown.
+	ContentLength int64
+}
+
+// Upload iterates over the parts of a multipart request as they stream
+// in, without buffering them in memory or on disk. See Ctx.Upload.
+type Upload struct {
+	c      *Ctx
+	config UploadConfig
+	reader *multipart.Reader
+	files  int
+	total  int64
+}
+
+// UploadPart is a field or a file of an Upload, its content is read with
+// Read, Value or SaveTo before moving to the next part.
+type UploadPart struct {
+	upload *Upload
+	part   *multipart.Part
+	reader *bufio.Reader
+	limit  int64
+
+	// FormName is the name of the form field.
+	FormName string
+
+	// FileName is the base name sent by the client, empty for fields. It
+	// must not be used as a path, see SaveTo.
+	FileName string
+
+	// ContentType is sniffed from the content for files, and is the
+	// Content-Type of the part for fields.
+	ContentType string
+
+	// Size is the number of bytes read so far.
+	Size int64
+}
+
+// Upload returns an iterator over the parts of a multipart/form-data
+// request, for uploads too large to be parsed by MultipartForm. The errors
+// of Upload and its parts are Err values answered with their status when
+// returned by the handler:
+//
+//	upload, err := c.Upload(ursa.UploadConfig{AllowedTypes: []string{"image/*"}})
+//	if err != nil {
+//		return err
+//	}
+//
+//	for {
+//		part, err := upload.Next()
+//		if err == io.EOF {
+//			break
+//		}
+//		if err != nil {
+//			return err
+//		}
+//
+//		if part.FileName != "" {
+//			if _, err = part.SaveTo("/var/uploads"); err != nil {
+//				return err
+//			}
+//		}
+//	}
+func (c *Ctx) Upload(config ...UploadConfig) (*Upload, error) {
+	cfg := DefaultUploadConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	// Set defaults
+	if cfg.MaxFileSize == 0 {
+		cfg.MaxFileSize = DefaultUploadConfig.MaxFileSize
+	}
+	if cfg.MaxFiles <= 0 {
+		cfg.MaxFiles = DefaultUploadConfig.MaxFiles
+	}
+	if cfg.MaxFieldSize <= 0 {
+		cfg.MaxFieldSize = DefaultUploadConfig.MaxFieldSize
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(c.Get("Content-Type"))
+	if mediaType != MIMEMultipartForm {
+		return nil, NewNFError(415, "Unsupported Media Type")
+	}
+
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return nil, NewNFError(400, err.Error())
+	}
+
+	return &Upload{c: c, config: cfg, reader: reader}, nil
+}
+
+// Next returns the next part, skipping what is left of the previous one,
+// or io.EOF after the last part.
+func (u *Upload) Next() (*UploadPart, error) {
+	part, err := u.reader.NextPart()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, u.c.bodyError(err)
+	}
+
+	p := &UploadPart{
+		upload:   u,
+		part:     part,
+		reader:   bufio.NewReaderSize(part, 512),
+		limit:    u.config.MaxFieldSize,
+		FormName: part.FormName(),
+		FileName: part.FileName(),
+	}
+
+	if p.FileName == "" {
+		p.ContentType = part.Header.Get("Content-Type")
+		return p, nil
+	}
+
+	if u.files++; u.files > u.config.MaxFiles {
+		return nil, NewNFError(413, "Too Many Files")
+	}
+
+	p.limit = u.config.MaxFileSize
+
+	// Peek does not count towards Size, the bytes are read again by Read
+	head, err := p.reader.Peek(512)
+	if err != nil && err != io.EOF {
+		return nil, u.c.bodyError(err)
+	}
+
+	p.ContentType = http.DetectContentType(head)
+	if !uploadTypeAllowed(u.config.AllowedTypes, p.ContentType) {
+		return nil, NewNFError(415, "Unsupported Media Type")
+	}
+
+	return p, nil
+}
+
+func uploadTypeAllowed(allowed []string, contentType string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	for _, pattern := range allowed {
+		if pattern == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(mediaType, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Read reads the content of the part, failing with a 413 Err once it
+// exceeds MaxFileSize or MaxFieldSize.
+func (p *UploadPart) Read(b []byte) (int, error) {
+	if p.limit >= 0 {
+		if p.Size > p.limit {
+			return 0, NewNFError(413, "Content Too Large")
+		}
+		if remaining := p.limit - p.Size + 1; int64(len(b)) > remaining {
+			b = b[:remaining]
+		}
+	}
+
+	n, err := p.reader.Read(b)
+	p.Size += int64(n)
+
+	if p.FileName != "" && n > 0 {
+		p.upload.total += int64(n)
+
+		if p.upload.config.OnProgress != nil {
+			p.upload.config.OnProgress(UploadProgress{
+				FormName:      p.FormName,
+				FileName:      p.FileName,
+				Bytes:         p.Size,
+				Total:         p.upload.total,
+				ContentLength: p.upload.c.Request.ContentLength,
+			})
+		}
+	}
+
+	if p.limit >= 0 && p.Size > p.limit {
+		return n - int(p.Size-p.limit), NewNFError(413, "Content Too Large")
+	}
+
+	if err != nil && err != io.EOF {
+		return n, p.upload.c.bodyError(err)
+	}
+
+	return n, err
+}
+
+// Value reads the content of a field
+func (p *UploadPart) Value() (string, error) {
+	bs, err := io.ReadAll(p)
+	return string(bs), err
+}
+
+// SaveTo stores the content of a file part in the root directory, under a
+// generated name keeping the extension of FileName, and returns the name.
+// The file is removed when the upload fails.
+func (p *UploadPart) SaveTo(root string) (string, error) {
+	return saveInRoot(root, p.FileName, p)
+}
+
+// SaveFileTo stores fh in the root directory under a generated name
+// keeping the extension of its file name, and returns the name. Unlike
+// SaveFile, the client cannot choose where the file is written.
+func (c *Ctx) SaveFileTo(fh *multipart.FileHeader, root string) (string, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	return saveInRoot(root, fh.Filename, f)
+}
+
+func saveInRoot(root, filename string, r io.Reader) (string, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", errors.New("upload: " + root + " is not a directory")
+	}
+
+	name := uploadName(filename)
+
+	// O_EXCL never follows nor overwrites an existing file
+	f, err := os.OpenFile(filepath.Join(root, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err = copyZeroAlloc(f, r); err == nil {
+		err = f.Close()
+	} else {
+		_ = f.Close()
+	}
+
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+
+	return name, nil
+}
+
+// uploadName returns a random name with the extension of filename when it
+// is short and alphanumeric, e.g. "3f2a...9c.png"
+func uploadName(filename string) string {
+	bs := make([]byte, 16)
+	if _, err := rand.Read(bs); err != nil {
+		panic(err)
+	}
+
+	name := hex.EncodeToString(bs)
+
+	ext := strings.ToLower(filepath.Ext(filename))
+	if len(ext) < 2 || len(ext) > 11 {
+		return name
+	}
+
+	for _, r := range ext[1:] {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return name
+		}
+	}
+
+	return name + ext
+}
@@ -0,0 +1,189 @@
+package ursa
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testPNG = append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 64)...)
+
+type testPart struct {
+	field, filename, ctype string
+	content               []byte
+}
+
+func buildMultipart(parts ...testPart) (string, *bytes.Buffer) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for _, p := range parts {
+		if p.filename == "" {
+			_ = mw.WriteField(p.field, string(p.content))
+			continue
+		}
+		h := make(map[string][]string)
+		h["Content-Disposition"] = []string{`form-data; name="` + p.field + `"; filename="` + p.filename + `"`}
+		h["Content-Type"] = []string{p.ctype}
+		w, _ := mw.CreatePart(h)
+		_, _ = w.Write(p.content)
+	}
+	_ = mw.Close()
+	return mw.FormDataContentType(), &buf
+}
+
+// TestUpload tests the streaming multipart iterator and its limits
+func TestUpload(t *testing.T) {
+	root := t.TempDir()
+
+	var progress []UploadProgress
+	app := New(Config{DisableLogger: true})
+	app.Post("/upload", func(c *Ctx) error {
+		upload, err := c.Upload(UploadConfig{
+			MaxFileSize:  128,
+			MaxFiles:     2,
+			AllowedTypes: []string{"image/*", "text/plain"},
+			OnProgress:   func(p UploadProgress) { progress = append(progress, p) },
+		})
+		if err != nil {
+			return err
+		}
+
+		var result []string
+		for {
+			part, err := upload.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+
+			if part.FileName == "" {
+				value, err := part.Value()
+				if err != nil {
+					return err
+				}
+				result = append(result, part.FormName+"="+value)
+				continue
+			}
+
+			name, err := part.SaveTo(root)
+			if err != nil {
+				return err
+			}
+			result = append(result, part.FormName+":"+part.ContentType+":"+filepath.Ext(name))
+		}
+
+		return c.SendString(strings.Join(result, " "))
+	})
+
+	do := func(parts ...testPart) (int, string) {
+		ctype, body := buildMultipart(parts...)
+		req := httptest.NewRequest(http.MethodPost, "/upload", body)
+		req.Header.Set("Content-Type", ctype)
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+
+	code, body := do(
+		testPart{field: "title", content: []byte("holiday")},
+		testPart{field: "photo", filename: "../../etc/cron.d/x.PNG", ctype: "text/html", content: testPNG},
+		testPart{field: "notes", filename: "notes.t$t", ctype: "image/png", content: []byte("plain notes")},
+	)
+	if code != 200 || body != "title=holiday photo:image/png:.png notes:text/plain; charset=utf-8:" {
+		t.Errorf("Unexpected upload result %d '%s'", code, body)
+	}
+
+	entries, _ := os.ReadDir(root)
+	if len(entries) != 2 {
+		t.Errorf("Expected 2 files in root, got %d", len(entries))
+	}
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), "cron") || strings.Contains(entry.Name(), "notes") {
+			t.Errorf("Expected generated name, got '%s'", entry.Name())
+		}
+	}
+
+	if len(progress) == 0 {
+		t.Fatal("Expected progress reports")
+	}
+	if last := progress[len(progress)-1]; last.FileName != "notes.t$t" || last.Bytes != 11 || last.Total != int64(len(testPNG))+11 {
+		t.Errorf("Unexpected progress %+v", last)
+	}
+
+	cases := []struct {
+		name  string
+		parts []testPart
+		want  int
+	}{
+		{"sniffed type not allowed", []testPart{{field: "f", filename: "a.png", ctype: "image/png", content: []byte("<html><body>x</body></html>")}}, 415},
+		{"file too large", []testPart{{field: "f", filename: "a.txt", ctype: "text/plain", content: bytes.Repeat([]byte("x"), 129)}}, 413},
+		{"too many files", []testPart{
+			{field: "f", filename: "a.txt", content: []byte("a")},
+			{field: "f", filename: "b.txt", content: []byte("b")},
+			{field: "f", filename: "c.txt", content: []byte("c")},
+		}, 413},
+	}
+
+	for _, tc := range cases {
+		if code, body := do(tc.parts...); code != tc.want {
+			t.Errorf("%s: expected %d, got %d (%s)", tc.name, tc.want, code, body)
+		}
+	}
+
+	// a file failing mid-way is removed
+	entries, _ = os.ReadDir(root)
+	if len(entries) != 4 {
+		t.Errorf("Expected only complete files in root, got %d", len(entries))
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("{}"))
+	req.Header.Set("Content-Type", MIMEApplicationJSON)
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+	if w.Code != 415 {
+		t.Errorf("Expected 415 for a non multipart body, got %d", w.Code)
+	}
+}
+
+// TestSaveFileTo tests that buffered files are saved under generated names
+func TestSaveFileTo(t *testing.T) {
+	root := t.TempDir()
+
+	app := New(Config{DisableLogger: true})
+	app.Post("/upload", func(c *Ctx) error {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			return err
+		}
+
+		name, err := c.SaveFileTo(fh, root)
+		if err != nil {
+			return err
+		}
+
+		return c.SendString(name)
+	})
+
+	ctype, body := buildMultipart(testPart{field: "file", filename: "../evil.sh", ctype: "text/plain", content: []byte("echo")})
+	req := httptest.NewRequest(http.MethodPost, "/upload", body)
+	req.Header.Set("Content-Type", ctype)
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, req)
+
+	name := w.Body.String()
+	if w.Code != 200 || !strings.HasSuffix(name, ".sh") || strings.Contains(name, "evil") {
+		t.Fatalf("Unexpected result %d '%s'", w.Code, name)
+	}
+
+	if bs, err := os.ReadFile(filepath.Join(root, name)); err != nil || string(bs) != "echo" {
+		t.Errorf("Expected saved content, got '%s' (%v)", bs, err)
+	}
+}
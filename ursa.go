@@ -18,9 +18,18 @@ type Map map[string]interface{}
 
 type Config struct {
 	DisableMessagePrint bool `json:"-"`
+	// BodyLimit is the maximum size of request bodies, enforced while they
+	// are read so that chunked bodies of unknown length are limited too.
+	// Override it per route or group with MetaBodyLimit.
 	// Default: 4 * 1024 * 1024
 	BodyLimit int64 `json:"-"`
 
+	// MultipartMemory is the size of multipart forms kept in memory by
+	// MultipartForm and BodyParser, larger files are stored in temporary
+	// files which are removed at the end of the request.
+	// Default: 8 * 1024 * 1024
+	MultipartMemory int64 `json:"-"`
+
 	// Server timeout configurations
 	ReadTimeout  time.Duration `json:"-"` // Default: 10s, maximum duration for reading the entire request
 	WriteTimeout time.Duration `json:"-"` // Default: 10s, maximum duration before timing out writes of the response
@@ -34,6 +43,28 @@ type Config struct {
 	DisableRecover      bool `json:"-"`
 	DisableHttpErrorLog bool `json:"-"`
 
+	// CookieKeys are the secrets of signed and encrypted cookies, at least
+	// 16 bytes long. The first key signs and encrypts new cookies, the
+	// others are only used to read cookies, which allows rotating keys.
+	CookieKeys []string `json:"-"`
+
+	// TrustedProxies lists the IPs and CIDRs of the reverse proxies in
+	// front of the app, e.g. "10.0.0.0/8". The forwarding headers used by
+	// Ctx.IP(true), Ctx.Scheme and Ctx.Host are only honoured from them.
+	TrustedProxies []string `json:"-"`
+
+	// ProxyHeader is a header set by the trusted proxies to the client IP,
+	// e.g. "CF-Connecting-IP", read by Ctx.IP(true) instead of the
+	// Forwarded and X-Forwarded-For chains.
+	ProxyHeader string `json:"-"`
+
+	// ProxyProtocol enables the HAProxy PROXY protocol v1 and v2 on the
+	// listeners of Run, RunTLS, RunListener and RunListenerTls, so that the
+	// peer address is the client behind the TCP load balancer. New panics
+	// when its TrustedSources is empty.
+	// Default: nil (disabled)
+	ProxyProtocol *ProxyProtocolConfig `json:"-"`
+
 	// EnableNotImplementHandler bool        `json:"-"`
 	NotFoundHandler         HandlerFunc  `json:"-"`
 	MethodNotAllowedHandler HandlerFunc  `json:"-"`
@@ -41,10 +72,11 @@ type Config struct {
 }
 
 var defaultConfig = &Config{
-	BodyLimit:    4 * 1024 * 1024,
-	ReadTimeout:  10 * time.Second,
-	WriteTimeout: 10 * time.Second,
-	IdleTimeout:  120 * time.Second,
+	BodyLimit:       4 * 1024 * 1024,
+	MultipartMemory: 8 * 1024 * 1024,
+	ReadTimeout:     10 * time.Second,
+	WriteTimeout:    10 * time.Second,
+	IdleTimeout:     120 * time.Second,
 	NotFoundHandler: func(c *Ctx) error {
 		c.Set("Content-Type", MIMETextHTML)
 		_, err := c.Status(404).Write([]byte(_404))
@@ -75,7 +107,8 @@ func New(config ...Config) *App {
 		removeExtraSlash:       false,
 	}
 
-	app.config = defaultConfig
+	conf := *defaultConfig
+	app.config = &conf
 
 	if len(config) > 0 {
 		cfg := config[0]
@@ -108,6 +141,10 @@ func New(config ...Config) *App {
 			app.config.BodyLimit = cfg.BodyLimit
 		}
 
+		if cfg.MultipartMemory > 0 {
+			app.config.MultipartMemory = cfg.MultipartMemory
+		}
+
 		if cfg.ReadTimeout > 0 {
 			app.config.ReadTimeout = cfg.ReadTimeout
 		}
@@ -131,8 +168,28 @@ func New(config ...Config) *App {
 		if cfg.BeforeServeFn != nil {
 			app.config.BeforeServeFn = cfg.BeforeServeFn
 		}
+
+		if len(cfg.CookieKeys) > 0 {
+			app.config.CookieKeys = cfg.CookieKeys
+		}
+
+		if len(cfg.TrustedProxies) > 0 {
+			app.config.TrustedProxies = cfg.TrustedProxies
+		}
+
+		if cfg.ProxyHeader != "" {
+			app.config.ProxyHeader = cfg.ProxyHeader
+		}
+
+		if cfg.ProxyProtocol != nil {
+			elsePanic(len(cfg.ProxyProtocol.TrustedSources) > 0, "proxy protocol: TrustedSources is required")
+			app.config.ProxyProtocol = cfg.ProxyProtocol
+		}
 	}
 
+	app.cookieKeys = newCookieKeys(app.config.CookieKeys)
+	app.trustedProxies = parseTrustedProxies(app.config.TrustedProxies)
+
 	app.RouterGroup.app = app
 
 	app.Use(func(c *Ctx) error {
@@ -91,6 +91,16 @@ func Resp401(c *ursa.Ctx, data any, msgs ...string) error {
 	return Resp(c, 401, msg, err, data)
 }
 
+// Unauthorized responds with Resp401, it can be used as the Unauthorized
+// handler of the ursa auth middlewares (BasicAuth, KeyAuth, JWT).
+func Unauthorized(c *ursa.Ctx, err error) error {
+	if err == nil {
+		return Resp401(c, nil)
+	}
+
+	return Resp401(c, nil, err.Error())
+}
+
 func Resp403(c *ursa.Ctx, data any, msgs ...string) error {
 	msg := MSG403
 	err := ""
@@ -0,0 +1,194 @@
+package sse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// Config defines the config of a Client
+type Config struct {
+	// HTTPClient sends the requests, it must not have a Timeout shorter
+	// than the streams.
+	// Default: http.DefaultClient
+	HTTPClient *http.Client
+
+	// Header is added to the requests, e.g. Authorization.
+	// Default: nil
+	Header http.Header
+
+	// Retry is the delay before reconnecting, until the server sends one.
+	// Default: 3s
+	Retry time.Duration
+
+	// MaxRetries is the number of consecutive failed reconnections after
+	// which Subscribe gives up, 0 retries forever and a negative value
+	// never reconnects.
+	// Default: 0
+	MaxRetries int
+
+	// LastEventID is sent with the first request, to resume a stream.
+	// Default: ""
+	LastEventID string
+
+	// MaxEventSize, see Reader.
+	// Default: DefaultMaxEventSize
+	MaxEventSize int
+
+	// OnError is called with the errors causing a reconnection.
+	// Default: nil
+	OnError func(err error)
+}
+
+// DefaultConfig is the default Client config
+var DefaultConfig = Config{
+	Retry: 3 * time.Second,
+}
+
+// Client subscribes to an event stream, reconnecting when the connection
+// is lost and sending the Last-Event-ID of the last event received.
+type Client struct {
+	url    string
+	config Config
+
+	lastEventID string
+	retry       time.Duration
+}
+
+// NewClient returns a Client of the event stream at url
+func NewClient(url string, config ...Config) *Client {
+	cfg := DefaultConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	// Set defaults
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	if cfg.Retry <= 0 {
+		cfg.Retry = DefaultConfig.Retry
+	}
+
+	return &Client{url: url, config: cfg, lastEventID: cfg.LastEventID, retry: cfg.Retry}
+}
+
+// LastEventID returns the ID of the last event received
+func (c *Client) LastEventID() string {
+	return c.lastEventID
+}
+
+// Subscribe calls handler with the events of the stream until ctx is
+// done, handler returns an error, or the stream cannot be resumed, and
+// returns that error. It returns nil when the server ends the stream with
+// 204 No Content, and does not reconnect after a response other than 200
+// text/event-stream.
+func (c *Client) Subscribe(ctx context.Context, handler func(e Event) error) error {
+	failures := 0
+
+	for {
+		connected, err := c.stream(ctx, handler)
+
+		if err == errNoContent {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if perr, ok := err.(permanentError); ok {
+			return perr.err
+		}
+
+		if c.config.OnError != nil {
+			c.config.OnError(err)
+		}
+
+		if connected {
+			failures = 0
+		}
+		failures++
+
+		if c.config.MaxRetries < 0 || (c.config.MaxRetries > 0 && failures > c.config.MaxRetries) {
+			return err
+		}
+
+		timer := time.NewTimer(c.retry)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+var errNoContent = errors.New("sse: no content")
+
+// permanentError wraps the errors which are not retried
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+// stream reads events from a single connection, reporting whether it was
+// established
+func (c *Client) stream(ctx context.Context, handler func(e Event) error) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return false, permanentError{err: err}
+	}
+
+	for key, values := range c.config.Header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	if c.lastEventID != "" {
+		req.Header.Set("Last-Event-ID", c.lastEventID)
+	}
+
+	resp, err := c.config.HTTPClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		return true, errNoContent
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if resp.StatusCode != http.StatusOK || mediaType != "text/event-stream" {
+		return false, permanentError{err: fmt.Errorf("sse: unexpected response %d %q", resp.StatusCode, mediaType)}
+	}
+
+	reader := NewReader(resp.Body)
+	reader.MaxEventSize = c.config.MaxEventSize
+	reader.lastEventID, reader.idBuffer = c.lastEventID, c.lastEventID
+
+	for {
+		event, err := reader.Next()
+
+		if retry := reader.Retry(); retry > 0 {
+			c.retry = retry
+		}
+		c.lastEventID = reader.LastEventID()
+
+		if err == ErrEventTooLarge {
+			return true, permanentError{err: err}
+		}
+		if err != nil {
+			return true, err
+		}
+
+		if err = handler(event); err != nil {
+			return true, permanentError{err: err}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package sse
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/loveuer/ursa"
+)
+
+// TestClient tests the encoding of ursa streams, reconnection and resume
+func TestClient(t *testing.T) {
+	var (
+		connections int32
+		lastIDs     = make(chan string, 10)
+		history     = ursa.NewSSEHistory(10)
+	)
+
+	app := ursa.New(ursa.Config{DisableLogger: true})
+	app.Get("/events", func(c *ursa.Ctx) error {
+		lastIDs <- c.Get("Last-Event-ID")
+
+		return c.SSEStream(func(w *ursa.SSEWriter) error {
+			// the stream is cut after the first event
+			if atomic.AddInt32(&connections, 1) == 1 {
+				return w.Send(ursa.SSEEvent{ID: "1", Event: "text", Data: "line 1\r\nline 2\r line 3\n"})
+			}
+
+			return w.Send(ursa.SSEEvent{ID: "2", Data: ursa.Map{"n": 2}})
+		}, ursa.SSEConfig{Retry: 10 * time.Millisecond, History: history})
+	})
+	app.Get("/done", func(c *ursa.Ctx) error {
+		return c.SendStatus(204)
+	})
+	app.Get("/json", func(c *ursa.Ctx) error {
+		return c.JSON(ursa.Map{})
+	})
+
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	var (
+		events   []Event
+		stop     = errors.New("stop")
+		failures int
+	)
+
+	client := NewClient(srv.URL+"/events", Config{OnError: func(err error) { failures++ }})
+	err := client.Subscribe(context.Background(), func(e Event) error {
+		events = append(events, e)
+		if len(events) == 2 {
+			return stop
+		}
+		return nil
+	})
+
+	if err != stop {
+		t.Fatalf("Expected the handler error, got %v", err)
+	}
+
+	expected := []Event{
+		{ID: "1", Event: "text", Data: "line 1\nline 2\n line 3\n"},
+		{ID: "2", Event: "message", Data: `{"n":2}`},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, events)
+	}
+
+	if first, second := <-lastIDs, <-lastIDs; first != "" || second != "1" {
+		t.Errorf("Expected Last-Event-ID to be sent on reconnection, got '%s' '%s'", first, second)
+	}
+	if failures != 1 || client.LastEventID() != "2" {
+		t.Errorf("Unexpected failures %d or last event ID '%s'", failures, client.LastEventID())
+	}
+
+	// 204 ends the subscription
+	if err = NewClient(srv.URL+"/done").Subscribe(context.Background(), func(e Event) error { return nil }); err != nil {
+		t.Errorf("Expected nil, got %v", err)
+	}
+
+	// other responses are not retried
+	if err = NewClient(srv.URL+"/json").Subscribe(context.Background(), func(e Event) error { return nil }); err == nil {
+		t.Error("Expected an error")
+	}
+
+	// the context stops the subscription
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = NewClient(srv.URL+"/events", Config{Retry: time.Hour}).Subscribe(ctx, func(e Event) error { return nil })
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected DeadlineExceeded, got %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+// Package sse reads server-sent event streams, following the event stream
+// interpretation of the HTML Living Standard, and provides a client which
+// reconnects with the retry delay and Last-Event-ID sent by the server.
+package sse
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrEventTooLarge is returned when an event exceeds the maximum size
+var ErrEventTooLarge = errors.New("sse: event too large")
+
+// DefaultMaxEventSize is the default maximum size of an event
+const DefaultMaxEventSize = 1024 * 1024
+
+// Event is a dispatched event
+type Event struct {
+	// ID is the last event ID, which persists over the following events
+	// without id field
+	ID string
+
+	// Event is the event type, "message" when not set by the server
+	Event string
+
+	Data string
+}
+
+// Reader parses an event stream
+type Reader struct {
+	r *bufio.Reader
+
+	// MaxEventSize limits the size of lines and of the data of an event.
+	// Default: DefaultMaxEventSize
+	MaxEventSize int
+
+	lastEventID string
+	idBuffer    string
+	retry       time.Duration
+	afterCR     bool
+	started     bool
+}
+
+// NewReader returns a Reader of the stream r
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// LastEventID returns the ID of the last event dispatched
+func (r *Reader) LastEventID() string {
+	return r.lastEventID
+}
+
+// Retry returns the reconnection time last sent by the server, zero when
+// none was sent
+func (r *Reader) Retry() time.Duration {
+	return r.retry
+}
+
+// Next returns the next event, or io.EOF at the end of the stream. An
+// event not terminated by a blank line is discarded.
+func (r *Reader) Next() (Event, error) {
+	var (
+		event   string
+		data    strings.Builder
+		hasData bool
+	)
+
+	for {
+		line, err := r.readLine()
+		if err != nil {
+			return Event{}, err
+		}
+
+		if line == "" {
+			r.lastEventID = r.idBuffer
+
+			if !hasData {
+				event = ""
+				continue
+			}
+
+			if event == "" {
+				event = "message"
+			}
+
+			return Event{ID: r.lastEventID, Event: event, Data: strings.TrimSuffix(data.String(), "\n")}, nil
+		}
+
+		// a comment
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			if data.Len()+len(value) >= r.maxEventSize() {
+				return Event{}, ErrEventTooLarge
+			}
+			data.WriteString(value)
+			data.WriteByte('\n')
+			hasData = true
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				r.idBuffer = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 32); err == nil {
+				r.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+}
+
+func (r *Reader) maxEventSize() int {
+	if r.MaxEventSize > 0 {
+		return r.MaxEventSize
+	}
+
+	return DefaultMaxEventSize
+}
+
+// readLine reads a line ended by CRLF, LF or CR. A CR is not followed by a
+// read of the next byte, which may only come with the next event.
+func (r *Reader) readLine() (string, error) {
+	var line []byte
+
+	for {
+		b, err := r.r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+
+		if r.afterCR {
+			r.afterCR = false
+			if b == '\n' {
+				continue
+			}
+		}
+
+		// a leading byte order mark is ignored
+		if !r.started {
+			r.started = true
+			if b == 0xef {
+				if bom, err := r.r.Peek(2); err == nil && bom[0] == 0xbb && bom[1] == 0xbf {
+					_, _ = r.r.Discard(2)
+					continue
+				}
+			}
+		}
+
+		switch b {
+		case '\n':
+			return string(line), nil
+		case '\r':
+			r.afterCR = true
+			return string(line), nil
+		}
+
+		if len(line) >= r.maxEventSize() {
+			return "", ErrEventTooLarge
+		}
+		line = append(line, b)
+	}
+}
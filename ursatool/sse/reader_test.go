@@ -0,0 +1,89 @@
+package sse
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readAll(t *testing.T, stream string) []Event {
+	t.Helper()
+
+	var (
+		r      = NewReader(strings.NewReader(stream))
+		events []Event
+	)
+
+	for {
+		event, err := r.Next()
+		if err == io.EOF {
+			return events
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+}
+
+// TestReader tests the parsing rules of the event stream format
+func TestReader(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+		events []Event
+	}{
+		{
+			name:   "multi-line data",
+			stream: "data: first\ndata:  second\ndata\n\n",
+			events: []Event{{Event: "message", Data: "first\n second\n"}},
+		},
+		{
+			name:   "line endings",
+			stream: "\xef\xbb\xbfevent: a\r\ndata: 1\r\n\r\nevent: b\rdata: 2\r\rdata: 3\n\n",
+			events: []Event{{Event: "a", Data: "1"}, {Event: "b", Data: "2"}, {Event: "message", Data: "3"}},
+		},
+		{
+			name:   "comments and unknown fields",
+			stream: ": heartbeat\n\nfoo: bar\ndata: x\n\n",
+			events: []Event{{Event: "message", Data: "x"}},
+		},
+		{
+			name:   "id persists",
+			stream: "id: 1\ndata: a\n\ndata: b\n\nid\ndata: c\n\nid: 2\n\ndata: d\n\n",
+			events: []Event{{ID: "1", Event: "message", Data: "a"}, {ID: "1", Event: "message", Data: "b"}, {Event: "message", Data: "c"}, {ID: "2", Event: "message", Data: "d"}},
+		},
+		{
+			name:   "events without data are not dispatched",
+			stream: "event: empty\n\ndata: x\n\ndata: unterminated",
+			events: []Event{{Event: "message", Data: "x"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if events := readAll(t, tt.stream); !reflect.DeepEqual(events, tt.events) {
+				t.Errorf("Expected %+v, got %+v", tt.events, events)
+			}
+		})
+	}
+}
+
+// TestReaderRetry tests the retry field and the size limit
+func TestReaderRetry(t *testing.T) {
+	r := NewReader(strings.NewReader("retry: 1500\nretry: 1x\nretry: -1\ndata: x\n\n"))
+	if _, err := r.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if r.Retry() != 1500*time.Millisecond {
+		t.Errorf("Expected 1.5s, got %s", r.Retry())
+	}
+
+	r = NewReader(strings.NewReader("data: " + strings.Repeat("x", 100) + "\n\n"))
+	r.MaxEventSize = 50
+	if _, err := r.Next(); err != ErrEventTooLarge {
+		t.Errorf("Expected ErrEventTooLarge, got %v", err)
+	}
+}
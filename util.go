@@ -1,6 +1,8 @@
 package ursa
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"github.com/loveuer/ursa/internal/schema"
@@ -79,6 +81,67 @@ func elsePanic(guard bool, text string) {
 	}
 }
 
+// parseKeyLookup parses comma-separated "<source>:<name>" pairs, the
+// sources being "header", "form", "query" and "cookie", into functions
+// extracting the value from a request. When authScheme is set, header
+// values must start with it, e.g. "Bearer", and it is stripped.
+func parseKeyLookup(lookup, authScheme string) []func(c *Ctx) string {
+	var extractors []func(c *Ctx) string
+
+	for _, part := range strings.Split(lookup, ",") {
+		source, name, ok := strings.Cut(strings.TrimSpace(part), ":")
+		elsePanic(ok && name != "", "invalid key lookup: "+part)
+
+		switch source {
+		case "header":
+			if authScheme == "" {
+				extractors = append(extractors, func(c *Ctx) string { return c.Get(name) })
+				break
+			}
+
+			prefix := authScheme + " "
+			extractors = append(extractors, func(c *Ctx) string {
+				value := c.Get(name)
+				if len(value) > len(prefix) && strings.EqualFold(value[:len(prefix)], prefix) {
+					return strings.TrimSpace(value[len(prefix):])
+				}
+				return ""
+			})
+		case "form":
+			extractors = append(extractors, func(c *Ctx) string { return c.FormValue(name) })
+		case "query":
+			extractors = append(extractors, func(c *Ctx) string { return c.Query(name) })
+		case "cookie":
+			extractors = append(extractors, func(c *Ctx) string { return c.Cookies(name) })
+		default:
+			panic("unsupported key lookup source: " + source)
+		}
+	}
+
+	return extractors
+}
+
+// lookupKey returns the first non-empty value of extractors
+func lookupKey(c *Ctx, extractors []func(c *Ctx) string) string {
+	for _, extract := range extractors {
+		if key := extract(c); key != "" {
+			return key
+		}
+	}
+
+	return ""
+}
+
+// randomToken returns 32 random bytes, base64 url encoded
+func randomToken() string {
+	bs := make([]byte, 32)
+	if _, err := rand.Read(bs); err != nil {
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(bs)
+}
+
 func cleanPath(p string) string {
 	const stackBufSize = 128
 	// Turn empty string into "/"
@@ -350,3 +413,38 @@ func _last[T any](items []T) (v T) {
 
 	return items[len(items)-1]
 }
+
+// etagMatch reports whether etag matches one of the entity tags listed in
+// an If-Match or If-None-Match header. "*" matches any existing etag.
+// Weak tags never match with strong comparison, RFC 9110 8.8.3.2.
+func etagMatch(header, etag string, strong bool) bool {
+	if etag == "" {
+		return false
+	}
+
+	etagWeak := strings.HasPrefix(etag, "W/")
+	if strong && etagWeak {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+
+		if strings.HasPrefix(tag, "W/") {
+			if strong {
+				continue
+			}
+			tag = tag[2:]
+		}
+
+		if tag == etag {
+			return true
+		}
+	}
+
+	return false
+}
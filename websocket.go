@@ -0,0 +1,637 @@
+package ursa
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// WebSocket message types, the opcodes of RFC 6455
+const (
+	WSTextMessage   = 1
+	WSBinaryMessage = 2
+
+	wsContinuation = 0
+	wsClose        = 8
+	wsPing         = 9
+	wsPong         = 10
+)
+
+// WebSocket close codes, RFC 6455 section 7.4.1
+const (
+	WSCloseNormal          = 1000
+	WSCloseGoingAway       = 1001
+	WSCloseProtocolError   = 1002
+	WSCloseUnsupportedData = 1003
+	WSCloseNoStatus        = 1005
+	WSCloseInvalidPayload  = 1007
+	WSClosePolicyViolation = 1008
+	WSCloseMessageTooBig   = 1009
+	WSCloseInternalError   = 1011
+)
+
+const (
+	wsAcceptGUID             = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	wsCompressionThreshold   = 128
+	wsDeflateTail            = "\x00\x00\xff\xff"
+	wsDeflateFinalEmptyBlock = "\x01\x00\x00\xff\xff"
+)
+
+// WSCloseError is returned by ReadMessage once the connection is closed
+// by the peer, or by the server because of a protocol violation
+type WSCloseError struct {
+	Code int
+	Text string
+}
+
+func (e *WSCloseError) Error() string {
+	return "websocket: close " + strconv.Itoa(e.Code) + " " + e.Text
+}
+
+// ErrWSClosed is returned when writing to a closed connection
+var ErrWSClosed = errors.New("websocket: connection closed")
+
+// WebSocketConfig defines the config of WebSocket handlers
+type WebSocketConfig struct {
+	// Origins lists the allowed values of the Origin header, e.g.
+	// "https://example.com", or "*" for any origin. Requests without an
+	// Origin header, which browsers always send, are allowed.
+	// Default: nil (same host as the request only)
+	Origins []string
+
+	// Subprotocols lists the supported subprotocols, in order of preference.
+	// Default: nil
+	Subprotocols []string
+
+	// EnableCompression negotiates permessage-deflate, RFC 7692.
+	// Default: false
+	EnableCompression bool
+
+	// ReadLimit is the maximum size of a message, after decompression.
+	// Larger messages close the connection with WSCloseMessageTooBig.
+	// Default: 1MB
+	ReadLimit int64
+
+	// PingInterval is how often pings are sent, a negative value disables
+	// them.
+	// Default: 30s
+	PingInterval time.Duration
+
+	// PongTimeout closes connections from which nothing, pongs included,
+	// was received for that long. A negative value disables it.
+	// Default: 60s
+	PongTimeout time.Duration
+
+	// WriteTimeout is the time allowed to write a message.
+	// Default: 10s
+	WriteTimeout time.Duration
+}
+
+// DefaultWebSocketConfig is the default WebSocket config
+var DefaultWebSocketConfig = WebSocketConfig{
+	ReadLimit:    1024 * 1024,
+	PingInterval: 30 * time.Second,
+	PongTimeout:  60 * time.Second,
+	WriteTimeout: 10 * time.Second,
+}
+
+// WSConn is a WebSocket connection. ReadMessage must be called from one
+// goroutine at a time, while writes are safe for concurrent use.
+type WSConn struct {
+	c           *Ctx
+	conn        net.Conn
+	reader      *bufio.Reader
+	config      WebSocketConfig
+	subprotocol string
+	compress    bool
+
+	writeLock sync.Mutex
+	closed    bool
+	done      chan struct{}
+}
+
+// WebSocket returns a handler upgrading requests to WebSocket, RFC 6455,
+// and calling handler with the connection, which is closed when it
+// returns. The route params and locals of the request remain readable.
+// Requests which are not upgrades are answered with 426.
+//
+//	app.Get("/ws/:room", ursa.WebSocket(func(ws *ursa.WSConn) {
+//		for {
+//			mt, msg, err := ws.ReadMessage()
+//			if err != nil {
+//				return
+//			}
+//			_ = ws.WriteMessage(mt, msg)
+//		}
+//	}))
+func WebSocket(handler func(ws *WSConn), config ...WebSocketConfig) HandlerFunc {
+	cfg := DefaultWebSocketConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+
+	// Set defaults
+	if cfg.ReadLimit <= 0 {
+		cfg.ReadLimit = DefaultWebSocketConfig.ReadLimit
+	}
+	if cfg.PingInterval == 0 {
+		cfg.PingInterval = DefaultWebSocketConfig.PingInterval
+	}
+	if cfg.PongTimeout == 0 {
+		cfg.PongTimeout = DefaultWebSocketConfig.PongTimeout
+	}
+	if cfg.WriteTimeout <= 0 {
+		cfg.WriteTimeout = DefaultWebSocketConfig.WriteTimeout
+	}
+
+	return func(c *Ctx) error {
+		if c.Request.Method != http.MethodGet ||
+			!headerHasToken(c.Get("Connection"), "upgrade") ||
+			!headerHasToken(c.Get("Upgrade"), "websocket") {
+			c.Set("Upgrade", "websocket")
+			return NewNFError(http.StatusUpgradeRequired, "Upgrade Required")
+		}
+
+		if c.Get("Sec-WebSocket-Version") != "13" {
+			c.Set("Sec-WebSocket-Version", "13")
+			return NewNFError(http.StatusUpgradeRequired, "Unsupported WebSocket Version")
+		}
+
+		key := c.Get("Sec-WebSocket-Key")
+		if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+			return NewNFError(http.StatusBadRequest, "Invalid Sec-WebSocket-Key")
+		}
+
+		if !cfg.checkOrigin(c) {
+			return NewNFError(http.StatusForbidden, "Forbidden")
+		}
+
+		ws := &WSConn{c: c, config: cfg, done: make(chan struct{})}
+
+		sum := sha1.Sum([]byte(key + wsAcceptGUID))
+		response := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: " +
+			base64.StdEncoding.EncodeToString(sum[:]) + "\r\n"
+
+		if ws.subprotocol = cfg.negotiateSubprotocol(c.Get("Sec-WebSocket-Protocol")); ws.subprotocol != "" {
+			response += "Sec-WebSocket-Protocol: " + ws.subprotocol + "\r\n"
+		}
+
+		// without context takeover, every message is compressed on its own
+		if cfg.EnableCompression && headerHasToken(c.Get("Sec-WebSocket-Extensions"), "permessage-deflate") {
+			ws.compress = true
+			response += "Sec-WebSocket-Extensions: permessage-deflate; server_no_context_takeover; client_no_context_takeover\r\n"
+		}
+
+		// the status is set before hijacking, for the logger
+		c.Status(http.StatusSwitchingProtocols)
+
+		conn, brw, err := c.Writer.Hijack()
+		if err != nil {
+			return err
+		}
+		ws.conn, ws.reader = conn, brw.Reader
+
+		// clear the deadlines of the http server
+		_ = conn.SetDeadline(time.Now().Add(cfg.WriteTimeout))
+		if _, err = io.WriteString(conn, response+"\r\n"); err != nil {
+			_ = conn.Close()
+			return nil
+		}
+		_ = conn.SetDeadline(time.Time{})
+
+		ws.refreshReadDeadline()
+		if cfg.PingInterval > 0 {
+			go ws.keepalive()
+		}
+
+		defer ws.Close(WSCloseNormal, "")
+
+		handler(ws)
+
+		return nil
+	}
+}
+
+// headerHasToken reports whether a comma separated header holds token,
+// ignoring case and parameters
+func headerHasToken(header, token string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, _, _ := strings.Cut(part, ";")
+		if strings.EqualFold(strings.TrimSpace(name), token) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (cfg WebSocketConfig) checkOrigin(c *Ctx) bool {
+	origin := c.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	if len(cfg.Origins) == 0 {
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, c.Host())
+	}
+
+	for _, allowed := range cfg.Origins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (cfg WebSocketConfig) negotiateSubprotocol(header string) string {
+	if header == "" {
+		return ""
+	}
+
+	requested := strings.Split(header, ",")
+	for _, supported := range cfg.Subprotocols {
+		for _, protocol := range requested {
+			if strings.TrimSpace(protocol) == supported {
+				return supported
+			}
+		}
+	}
+
+	return ""
+}
+
+// Subprotocol returns the negotiated subprotocol, if any
+func (ws *WSConn) Subprotocol() string {
+	return ws.subprotocol
+}
+
+// Param returns a route param of the upgrade request
+func (ws *WSConn) Param(key string) string {
+	return ws.c.Param(key)
+}
+
+// Query returns a query value of the upgrade request
+func (ws *WSConn) Query(key string, defaultValue ...string) string {
+	return ws.c.Query(key, defaultValue...)
+}
+
+// Locals gets or sets a local value of the upgrade request, e.g. the user
+// set by an authentication middleware
+func (ws *WSConn) Locals(key string, value ...any) any {
+	return ws.c.Locals(key, value...)
+}
+
+// IP returns the client address of the upgrade request, see Ctx.IP
+func (ws *WSConn) IP() string {
+	return ws.c.IP(true)
+}
+
+// SetReadLimit replaces the ReadLimit of the connection
+func (ws *WSConn) SetReadLimit(limit int64) {
+	ws.config.ReadLimit = limit
+}
+
+func (ws *WSConn) refreshReadDeadline() {
+	if ws.config.PongTimeout > 0 {
+		_ = ws.conn.SetReadDeadline(time.Now().Add(ws.config.PongTimeout))
+	}
+}
+
+func (ws *WSConn) keepalive() {
+	ticker := time.NewTicker(ws.config.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ws.done:
+			return
+		case <-ticker.C:
+			if err := ws.writeFrame(wsPing, false, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// ReadMessage reads the next data message, answering pings and closes on
+// the way. It returns a *WSCloseError once the connection is closed.
+func (ws *WSConn) ReadMessage() (messageType int, data []byte, err error) {
+	var compressed bool
+
+	for {
+		fin, rsv1, opcode, payload, err := ws.readFrame(ws.config.ReadLimit - int64(len(data)))
+		if err != nil {
+			return 0, nil, err
+		}
+		ws.refreshReadDeadline()
+
+		switch opcode {
+		case wsPing:
+			if err = ws.writeFrame(wsPong, false, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			return 0, nil, ws.closeReceived(payload)
+		case WSTextMessage, WSBinaryMessage:
+			if messageType != 0 {
+				return 0, nil, ws.fail(WSCloseProtocolError, "unexpected data frame")
+			}
+			if rsv1 && !ws.compress {
+				return 0, nil, ws.fail(WSCloseProtocolError, "unexpected compressed frame")
+			}
+			messageType, compressed = int(opcode), rsv1
+		case wsContinuation:
+			if messageType == 0 || rsv1 {
+				return 0, nil, ws.fail(WSCloseProtocolError, "unexpected continuation frame")
+			}
+		default:
+			return 0, nil, ws.fail(WSCloseProtocolError, "unknown opcode")
+		}
+
+		data = append(data, payload...)
+		if !fin {
+			continue
+		}
+
+		if compressed {
+			if data, err = ws.inflate(data); err != nil {
+				return 0, nil, err
+			}
+		}
+
+		if messageType == WSTextMessage && !utf8.Valid(data) {
+			return 0, nil, ws.fail(WSCloseInvalidPayload, "invalid utf-8")
+		}
+
+		return messageType, data, nil
+	}
+}
+
+// ReadJSON reads the next message and decodes it into v
+func (ws *WSConn) ReadJSON(v any) error {
+	_, data, err := ws.ReadMessage()
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// readFrame reads a frame whose payload may not exceed limit bytes
+func (ws *WSConn) readFrame(limit int64) (fin, rsv1 bool, opcode byte, payload []byte, err error) {
+	var header [8]byte
+
+	if _, err = io.ReadFull(ws.reader, header[:2]); err != nil {
+		return false, false, 0, nil, ws.readError(err)
+	}
+
+	fin, rsv1, opcode = header[0]&0x80 != 0, header[0]&0x40 != 0, header[0]&0x0f
+	if header[0]&0x30 != 0 {
+		return false, false, 0, nil, ws.fail(WSCloseProtocolError, "reserved bits set")
+	}
+	if header[1]&0x80 == 0 {
+		return false, false, 0, nil, ws.fail(WSCloseProtocolError, "unmasked client frame")
+	}
+
+	length := int64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		if _, err = io.ReadFull(ws.reader, header[:2]); err != nil {
+			return false, false, 0, nil, ws.readError(err)
+		}
+		length = int64(binary.BigEndian.Uint16(header[:2]))
+	case 127:
+		if _, err = io.ReadFull(ws.reader, header[:8]); err != nil {
+			return false, false, 0, nil, ws.readError(err)
+		}
+		if header[0]&0x80 != 0 {
+			return false, false, 0, nil, ws.fail(WSCloseProtocolError, "invalid length")
+		}
+		length = int64(binary.BigEndian.Uint64(header[:8]))
+	}
+
+	if opcode >= wsClose {
+		if length > 125 || !fin || rsv1 {
+			return false, false, 0, nil, ws.fail(WSCloseProtocolError, "invalid control frame")
+		}
+	} else if length > limit {
+		return false, false, 0, nil, ws.fail(WSCloseMessageTooBig, "message too big")
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(ws.reader, mask[:]); err != nil {
+		return false, false, 0, nil, ws.readError(err)
+	}
+
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(ws.reader, payload); err != nil {
+		return false, false, 0, nil, ws.readError(err)
+	}
+
+	for i := range payload {
+		payload[i] ^= mask[i&3]
+	}
+
+	return fin, rsv1, opcode, payload, nil
+}
+
+// readError closes the connection after a read failure, e.g. a timeout
+func (ws *WSConn) readError(err error) error {
+	ws.closeConn()
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return &WSCloseError{Code: WSCloseGoingAway, Text: "timeout"}
+	}
+
+	return &WSCloseError{Code: WSCloseNoStatus, Text: err.Error()}
+}
+
+// fail closes the connection with code after a violation by the peer
+func (ws *WSConn) fail(code int, text string) error {
+	_ = ws.Close(code, text)
+	return &WSCloseError{Code: code, Text: text}
+}
+
+// closeReceived answers a close frame with the same code, RFC 6455 5.5.1
+func (ws *WSConn) closeReceived(payload []byte) error {
+	code, text := WSCloseNoStatus, ""
+
+	if len(payload) >= 2 {
+		code, text = int(binary.BigEndian.Uint16(payload)), string(payload[2:])
+		if !utf8.ValidString(text) || code < 1000 || code == WSCloseNoStatus || code == 1006 || code == 1015 || (code >= 1016 && code < 3000) {
+			return ws.fail(WSCloseProtocolError, "invalid close frame")
+		}
+	} else if len(payload) == 1 {
+		return ws.fail(WSCloseProtocolError, "invalid close frame")
+	}
+
+	if code == WSCloseNoStatus {
+		_ = ws.Close(WSCloseNormal, "")
+	} else {
+		_ = ws.Close(code, "")
+	}
+
+	return &WSCloseError{Code: code, Text: text}
+}
+
+var (
+	flateReaderPool sync.Pool
+	flateWriterPool sync.Pool
+)
+
+func (ws *WSConn) inflate(data []byte) ([]byte, error) {
+	src := io.MultiReader(bytes.NewReader(data), strings.NewReader(wsDeflateTail+wsDeflateFinalEmptyBlock))
+
+	fr, _ := flateReaderPool.Get().(io.ReadCloser)
+	if fr == nil {
+		fr = flate.NewReader(src)
+	} else {
+		_ = fr.(flate.Resetter).Reset(src, nil)
+	}
+	defer flateReaderPool.Put(fr)
+
+	out, err := io.ReadAll(io.LimitReader(fr, ws.config.ReadLimit+1))
+	if err != nil {
+		return nil, ws.fail(WSCloseInvalidPayload, "invalid compressed data")
+	}
+	if int64(len(out)) > ws.config.ReadLimit {
+		return nil, ws.fail(WSCloseMessageTooBig, "message too big")
+	}
+
+	return out, nil
+}
+
+func deflate(data []byte) []byte {
+	var buf bytes.Buffer
+
+	fw, _ := flateWriterPool.Get().(*flate.Writer)
+	if fw == nil {
+		fw, _ = flate.NewWriter(&buf, flate.BestSpeed)
+	} else {
+		fw.Reset(&buf)
+	}
+	defer flateWriterPool.Put(fw)
+
+	_, _ = fw.Write(data)
+	_ = fw.Flush()
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte(wsDeflateTail))
+}
+
+// WriteMessage sends a data message
+func (ws *WSConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != WSTextMessage && messageType != WSBinaryMessage {
+		return errors.New("websocket: invalid message type")
+	}
+
+	if ws.compress && len(data) >= wsCompressionThreshold {
+		return ws.writeFrame(byte(messageType), true, deflate(data))
+	}
+
+	return ws.writeFrame(byte(messageType), false, data)
+}
+
+// WriteJSON sends v encoded as a text message
+func (ws *WSConn) WriteJSON(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return ws.WriteMessage(WSTextMessage, data)
+}
+
+func (ws *WSConn) writeFrame(opcode byte, compressed bool, payload []byte) error {
+	ws.writeLock.Lock()
+	defer ws.writeLock.Unlock()
+
+	if ws.closed {
+		return ErrWSClosed
+	}
+
+	return ws.writeFrameLocked(opcode, compressed, payload)
+}
+
+func (ws *WSConn) writeFrameLocked(opcode byte, compressed bool, payload []byte) error {
+	frame := make([]byte, 0, 10+len(payload))
+
+	first := 0x80 | opcode
+	if compressed {
+		first |= 0x40
+	}
+	frame = append(frame, first)
+
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	frame = append(frame, payload...)
+
+	_ = ws.conn.SetWriteDeadline(time.Now().Add(ws.config.WriteTimeout))
+	_, err := ws.conn.Write(frame)
+
+	return err
+}
+
+// Close sends a close frame with code and reason, and closes the
+// connection. Closing an already closed connection does nothing.
+func (ws *WSConn) Close(code int, reason string) error {
+	ws.writeLock.Lock()
+	defer ws.writeLock.Unlock()
+
+	if ws.closed {
+		return nil
+	}
+
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	payload = append(payload, reason...)
+
+	_ = ws.writeFrameLocked(wsClose, false, payload)
+
+	ws.closed = true
+	close(ws.done)
+
+	return ws.conn.Close()
+}
+
+func (ws *WSConn) closeConn() {
+	ws.writeLock.Lock()
+	defer ws.writeLock.Unlock()
+
+	if ws.closed {
+		return
+	}
+
+	ws.closed = true
+	close(ws.done)
+	_ = ws.conn.Close()
+}
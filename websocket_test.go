@@ -0,0 +1,279 @@
+package ursa
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wsClient is a minimal client sending masked frames
+type wsClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	resp   *http.Response
+}
+
+func dialWS(t *testing.T, srv *httptest.Server, path string, headers ...string) *wsClient {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	if err = req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &wsClient{conn: conn, reader: reader, resp: resp}
+}
+
+func (ws *wsClient) writeFrame(first byte, payload []byte) {
+	frame := []byte{first}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, 0x80|byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+
+	mask := []byte{1, 2, 3, 4}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i&3])
+	}
+
+	_, _ = ws.conn.Write(frame)
+}
+
+func (ws *wsClient) readFrame(t *testing.T) (first byte, payload []byte) {
+	t.Helper()
+
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(ws.reader, header); err != nil {
+		t.Fatal(err)
+	}
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		bs := make([]byte, 2)
+		_, _ = io.ReadFull(ws.reader, bs)
+		length = uint64(binary.BigEndian.Uint16(bs))
+	case 127:
+		bs := make([]byte, 8)
+		_, _ = io.ReadFull(ws.reader, bs)
+		length = binary.BigEndian.Uint64(bs)
+	}
+
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(ws.reader, payload); err != nil {
+		t.Fatal(err)
+	}
+
+	return header[0], payload
+}
+
+func wsEcho(ws *WSConn) {
+	for {
+		mt, msg, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		_ = ws.WriteMessage(mt, msg)
+	}
+}
+
+// TestWebSocketHandshake tests the upgrade checks and the accept key
+func TestWebSocketHandshake(t *testing.T) {
+	app := New(Config{DisableLogger: true})
+	app.Get("/ws", WebSocket(wsEcho, WebSocketConfig{Subprotocols: []string{"v2.chat", "v1.chat"}}))
+	app.Get("/open", WebSocket(wsEcho, WebSocketConfig{Origins: []string{"*"}}))
+
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	// not an upgrade
+	resp, err := http.Get(srv.URL + "/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUpgradeRequired || resp.Header.Get("Upgrade") != "websocket" {
+		t.Errorf("Expected 426, got %d %v", resp.StatusCode, resp.Header)
+	}
+
+	if ws := dialWS(t, srv, "/ws", "Sec-WebSocket-Version", "8"); ws.resp.StatusCode != http.StatusUpgradeRequired || ws.resp.Header.Get("Sec-WebSocket-Version") != "13" {
+		t.Errorf("Expected 426 for an unsupported version, got %d", ws.resp.StatusCode)
+	}
+
+	if ws := dialWS(t, srv, "/ws", "Sec-WebSocket-Key", "short"); ws.resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid key, got %d", ws.resp.StatusCode)
+	}
+
+	if ws := dialWS(t, srv, "/ws", "Origin", "https://evil.example"); ws.resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected 403 for a cross origin request, got %d", ws.resp.StatusCode)
+	}
+
+	if ws := dialWS(t, srv, "/open", "Origin", "https://evil.example"); ws.resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("Expected 101 for any origin, got %d", ws.resp.StatusCode)
+	}
+
+	ws := dialWS(t, srv, "/ws", "Origin", srv.URL, "Sec-WebSocket-Protocol", "v1.chat, v2.chat")
+	if ws.resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected 101, got %d", ws.resp.StatusCode)
+	}
+	// the sample of RFC 6455 section 1.3
+	if accept := ws.resp.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Unexpected accept key '%s'", accept)
+	}
+	if protocol := ws.resp.Header.Get("Sec-WebSocket-Protocol"); protocol != "v2.chat" {
+		t.Errorf("Expected the preferred subprotocol, got '%s'", protocol)
+	}
+	if ext := ws.resp.Header.Get("Sec-WebSocket-Extensions"); ext != "" {
+		t.Errorf("Expected no extension, got '%s'", ext)
+	}
+}
+
+// TestWebSocketMessages tests echo, fragmentation, control frames and close
+func TestWebSocketMessages(t *testing.T) {
+	app := New(Config{DisableLogger: true})
+	app.Get("/ws/:room", func(c *Ctx) error {
+		c.Locals("user", "alice")
+		return c.Next()
+	}, WebSocket(func(ws *WSConn) {
+		_ = ws.WriteMessage(WSTextMessage, []byte(ws.Param("room")+":"+ws.Locals("user").(string)))
+		wsEcho(ws)
+	}))
+
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	ws := dialWS(t, srv, "/ws/lobby")
+	if ws.resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected 101, got %d", ws.resp.StatusCode)
+	}
+
+	if first, payload := ws.readFrame(t); first != 0x81 || string(payload) != "lobby:alice" {
+		t.Errorf("Expected route param and locals, got %x '%s'", first, payload)
+	}
+
+	ws.writeFrame(0x81, []byte("hello"))
+	if first, payload := ws.readFrame(t); first != 0x81 || string(payload) != "hello" {
+		t.Errorf("Unexpected echo %x '%s'", first, payload)
+	}
+
+	// a fragmented binary message with a ping in the middle
+	ws.writeFrame(0x02, []byte("ab"))
+	ws.writeFrame(0x89, []byte("ping"))
+	ws.writeFrame(0x80, []byte("cd"))
+	if first, payload := ws.readFrame(t); first != 0x8a || string(payload) != "ping" {
+		t.Errorf("Expected pong, got %x '%s'", first, payload)
+	}
+	if first, payload := ws.readFrame(t); first != 0x82 || string(payload) != "abcd" {
+		t.Errorf("Unexpected fragmented echo %x '%s'", first, payload)
+	}
+
+	// invalid utf-8 closes with 1007
+	ws.writeFrame(0x81, []byte{0xff, 0xfe})
+	if first, payload := ws.readFrame(t); first != 0x88 || binary.BigEndian.Uint16(payload) != WSCloseInvalidPayload {
+		t.Errorf("Expected close 1007, got %x %v", first, payload)
+	}
+
+	// a close is echoed
+	ws = dialWS(t, srv, "/ws/lobby")
+	ws.readFrame(t)
+	ws.writeFrame(0x88, binary.BigEndian.AppendUint16(nil, WSCloseGoingAway))
+	if first, payload := ws.readFrame(t); first != 0x88 || binary.BigEndian.Uint16(payload) != WSCloseGoingAway {
+		t.Errorf("Expected close 1001, got %x %v", first, payload)
+	}
+
+	// unmasked frames are refused
+	ws = dialWS(t, srv, "/ws/lobby")
+	ws.readFrame(t)
+	_, _ = ws.conn.Write([]byte{0x81, 0x02, 'h', 'i'})
+	if first, payload := ws.readFrame(t); first != 0x88 || binary.BigEndian.Uint16(payload) != WSCloseProtocolError {
+		t.Errorf("Expected close 1002, got %x %v", first, payload)
+	}
+}
+
+// TestWebSocketLimits tests the read limit, compression and keepalive
+func TestWebSocketLimits(t *testing.T) {
+	app := New(Config{DisableLogger: true})
+	app.Get("/ws", WebSocket(wsEcho, WebSocketConfig{
+		ReadLimit:         1024,
+		EnableCompression: true,
+		PingInterval:      50 * time.Millisecond,
+	}))
+
+	srv := httptest.NewServer(app)
+	defer srv.Close()
+
+	ws := dialWS(t, srv, "/ws", "Sec-WebSocket-Extensions", "permessage-deflate; client_max_window_bits")
+	if ext := ws.resp.Header.Get("Sec-WebSocket-Extensions"); !strings.HasPrefix(ext, "permessage-deflate") {
+		t.Fatalf("Expected permessage-deflate, got '%s'", ext)
+	}
+
+	// a compressed message is inflated, and the large echo is compressed
+	message := strings.Repeat("compress me ", 50)
+	var buf bytes.Buffer
+	fw, _ := flate.NewWriter(&buf, flate.BestCompression)
+	_, _ = fw.Write([]byte(message))
+	_ = fw.Flush()
+	ws.writeFrame(0xc1, bytes.TrimSuffix(buf.Bytes(), []byte{0, 0, 0xff, 0xff}))
+
+	first, payload := ws.readFrame(t)
+	for first == 0x89 {
+		first, payload = ws.readFrame(t)
+	}
+	if first != 0xc1 {
+		t.Fatalf("Expected a compressed text frame, got %x", first)
+	}
+	inflated, err := io.ReadAll(flate.NewReader(io.MultiReader(bytes.NewReader(payload), strings.NewReader("\x00\x00\xff\xff\x01\x00\x00\xff\xff"))))
+	if err != nil || string(inflated) != message {
+		t.Errorf("Unexpected compressed echo '%s' %v", inflated, err)
+	}
+
+	// pings are sent
+	if first, _ = ws.readFrame(t); first != 0x89 {
+		t.Errorf("Expected a ping, got %x", first)
+	}
+
+	// too large messages close with 1009
+	ws.writeFrame(0x82, make([]byte, 2048))
+	first, payload = ws.readFrame(t)
+	for first == 0x89 {
+		first, payload = ws.readFrame(t)
+	}
+	if first != 0x88 || binary.BigEndian.Uint16(payload) != WSCloseMessageTooBig {
+		t.Errorf("Expected close 1009, got %x %v", first, payload)
+	}
+}